@@ -0,0 +1,127 @@
+package assets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"css/app.css":  "body {\n  background: url('../img/bg.png');\n  color : red;\n}\n/* comment */\n",
+		"js/app.js":    "// greeting\nconst greet = () => {\n    return \"//not a comment\";\n};\n",
+		"img/bg.png":   "png-bytes",
+		"robots.txt":   "User-agent: *",
+		"build/old.js": "stale",
+	}
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest, err := Build(BuildOptions{SourceDir: dir, OutputDir: filepath.Join(dir, "build"), Minify: true, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest) != 3 {
+		t.Fatalf("expected 3 manifest entries, got %d: %v", len(manifest), manifest)
+	}
+	if _, ok := manifest["robots.txt"]; ok {
+		t.Error("robots.txt should not be fingerprinted")
+	}
+
+	css := manifest["css/app.css"]
+	if !IsFingerprinted(css) || !strings.HasPrefix(css, "build/css/app.") {
+		t.Errorf("unexpected stylesheet path %s", css)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(css)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := strings.TrimPrefix(manifest["img/bg.png"], "build/")
+	if !strings.Contains(string(content), "url('../"+image+"')") {
+		t.Errorf("stylesheet url was not rewritten: %s", content)
+	}
+	if strings.Contains(string(content), "comment") || strings.Contains(string(content), "\n") {
+		t.Errorf("stylesheet was not minified: %s", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(css)) + ".gz"); err != nil {
+		t.Error("expected a precompressed stylesheet")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build", "old.js")); !os.IsNotExist(err) {
+		t.Error("expected the output directory to be recreated")
+	}
+
+	m, err := NewManifest(filepath.Join(dir, "build", ManifestFile), "/public/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.URL("/css/app.css"); got != "/public/"+css {
+		t.Errorf("expected /public/%s, got %s", css, got)
+	}
+	if got := m.URL("robots.txt"); got != "/public/robots.txt" {
+		t.Errorf("expected /public/robots.txt, got %s", got)
+	}
+}
+
+func TestBuildRejectsOutputOutsideItsOwnFolder(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "public")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "app.js"), []byte("const a = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, output := range []string{source, dir, filepath.Join(dir, "other"), source + "/.."} {
+		if _, err := Build(BuildOptions{SourceDir: source, OutputDir: output}); err == nil {
+			t.Errorf("output %s was accepted", output)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(source, "app.js")); err != nil {
+		t.Errorf("the source files were removed: %v", err)
+	}
+
+	// a folder whose name starts with two dots is inside the source directory
+	if _, err := Build(BuildOptions{SourceDir: source, OutputDir: filepath.Join(source, "..build")}); err != nil {
+		t.Errorf("output ..build: %v", err)
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	src := "// header\nfunction a() {\n    /* block */\n    return '//kept';   \n}\n\n\nconst re = /\\/\\//;\n"
+	expected := "function a() {\nreturn '//kept';\n}\nconst re = /\\/\\//;"
+
+	if got := MinifyJS(src); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	src := "a :hover , b > c {\n  color : red ;\n  content: \"a  b\";\n}\n"
+	expected := "a :hover,b>c{color:red;content:\"a  b\"}"
+
+	if got := MinifyCSS(src); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestMinifyCSSInsideAtRules(t *testing.T) {
+	src := "@media (min-width: 600px) {\n  a :hover { color : red; }\n  @supports (display: grid) {\n    b :first-child { display : grid }\n  }\n}\n@font-face { font-family : x }\nc :focus { outline : 0 }\n"
+	expected := "@media (min-width:600px){a :hover{color:red}@supports (display:grid){b :first-child{display:grid}}}" +
+		"@font-face{font-family:x}c :focus{outline:0}"
+
+	if got := MinifyCSS(src); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,208 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BuildOptions configures an asset build
+type BuildOptions struct {
+	// SourceDir is the public directory holding the original assets
+	SourceDir string
+	// OutputDir receives the fingerprinted copies and the manifest; when it is inside
+	// SourceDir it is skipped while scanning
+	OutputDir string
+	// Minify minifies stylesheets and scripts before fingerprinting them
+	Minify bool
+	// Gzip writes a precompressed .gz sibling for text assets
+	Gzip bool
+}
+
+// fingerprintedExtensions lists the file types handled by Build
+var fingerprintedExtensions = map[string]bool{
+	".css": true, ".js": true, ".mjs": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".avif": true, ".ico": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+}
+
+// compressibleExtensions lists the file types worth precompressing
+var compressibleExtensions = map[string]bool{".css": true, ".js": true, ".mjs": true, ".svg": true}
+
+// cssURLPattern matches url(...) references inside stylesheets
+var cssURLPattern = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+)(['"]?)\s*\)`)
+
+// Build fingerprints every stylesheet, script, image and font under the source
+// directory, writes the hashed copies to the output directory and returns the
+// manifest entries, which are also saved as OutputDir/manifest.json. The output
+// directory is recreated on every build. Stylesheets are processed last so their url()
+// references can be rewritten to the hashed files.
+func Build(options BuildOptions) (map[string]string, error) {
+	sourceDir, err := filepath.Abs(options.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	outputDir, err := filepath.Abs(options.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	// the output directory is removed on every build, so it must be a folder of its own
+	// below the source directory, never the source directory itself
+	outputRel, err := filepath.Rel(sourceDir, outputDir)
+	if err != nil || outputRel == "." || outputRel == ".." || strings.HasPrefix(outputRel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("output directory %s must be a folder inside %s", outputDir, sourceDir)
+	}
+	outputRel = filepath.ToSlash(outputRel)
+
+	var files, stylesheets []string
+	err = filepath.WalkDir(sourceDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == outputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fingerprintedExtensions[strings.ToLower(filepath.Ext(p))] || IsFingerprinted(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(sourceDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.EqualFold(path.Ext(rel), ".css") {
+			stylesheets = append(stylesheets, rel)
+		} else {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	sort.Strings(stylesheets)
+
+	if err := os.RemoveAll(outputDir); err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]string)
+	for _, rel := range append(files, stylesheets...) {
+		content, err := os.ReadFile(filepath.Join(sourceDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(path.Ext(rel)) {
+		case ".css":
+			content = rewriteCSSURLs(content, rel, outputRel, manifest)
+			if options.Minify {
+				content = []byte(MinifyCSS(string(content)))
+			}
+		case ".js", ".mjs":
+			if options.Minify {
+				content = []byte(MinifyJS(string(content)))
+			}
+		}
+
+		hashed := path.Join(outputRel, fingerprintName(rel, content))
+		target := filepath.Join(sourceDir, filepath.FromSlash(hashed))
+		if err := writeFile(target, content); err != nil {
+			return nil, err
+		}
+		if options.Gzip && compressibleExtensions[strings.ToLower(path.Ext(rel))] {
+			if err := writeGzip(target+".gz", content); err != nil {
+				return nil, err
+			}
+		}
+
+		manifest[rel] = hashed
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(outputDir, ManifestFile), content); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// fingerprintName inserts the content hash before the extension of the file name
+func fingerprintName(rel string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + "." + hex.EncodeToString(sum[:])[:12] + ext
+}
+
+// rewriteCSSURLs points relative url() references of a stylesheet at the fingerprinted
+// files, keeping them relative to the stylesheet's new location in the output directory
+func rewriteCSSURLs(content []byte, rel, outputRel string, manifest map[string]string) []byte {
+	dir := path.Dir(rel)
+	hashedDir := path.Dir(path.Join(outputRel, rel))
+
+	return cssURLPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := cssURLPattern.FindSubmatch(match)
+		ref := string(parts[2])
+		if strings.Contains(ref, ":") || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "#") {
+			return match
+		}
+
+		// keep any query string or fragment, e.g. font.woff2?v=1#iefix
+		target, suffix := ref, ""
+		if i := strings.IndexAny(ref, "?#"); i >= 0 {
+			target, suffix = ref[:i], ref[i:]
+		}
+
+		hashed, ok := manifest[path.Join(dir, target)]
+		if !ok {
+			// unknown files stay where they are, so point back at the original location
+			hashed = path.Join(dir, target)
+		}
+		relative, err := filepath.Rel(filepath.FromSlash(hashedDir), filepath.FromSlash(hashed))
+		if err != nil {
+			return match
+		}
+		return []byte("url(" + string(parts[1]) + filepath.ToSlash(relative) + suffix + string(parts[3]) + ")")
+	})
+}
+
+// writeFile writes content to target, creating the parent directories
+func writeFile(target string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, content, 0644)
+}
+
+// writeGzip writes a gzip compressed copy of content to target
+func writeGzip(target string, content []byte) error {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Write(content); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return writeFile(target, buf.Bytes())
+}
@@ -0,0 +1,107 @@
+package assets
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest written by Build into the output directory
+const ManifestFile = "manifest.json"
+
+// fingerprintPattern matches file names carrying a content hash, e.g. app.3f2a1b9c04de.css
+var fingerprintPattern = regexp.MustCompile(`\.[0-9a-f]{12}\.[A-Za-z0-9]+$`)
+
+// IsFingerprinted reports whether the file name carries a content hash and can
+// therefore be cached forever
+func IsFingerprinted(name string) bool {
+	return fingerprintPattern.MatchString(name)
+}
+
+// Manifest maps logical asset paths such as "css/app.css" to their fingerprinted
+// path relative to the public directory, e.g. "build/css/app.3f2a1b9c04de.css"
+type Manifest struct {
+	// Path is the manifest file on disk
+	Path string
+	// URLPrefix is prepended to resolved paths, e.g. "/public"
+	URLPrefix string
+	// Reload re-reads the manifest whenever the file changes, useful in development
+	Reload bool
+
+	mu      sync.RWMutex
+	entries map[string]string
+	modTime time.Time
+}
+
+// NewManifest loads the manifest at manifestPath; a missing manifest is not an error,
+// assets then resolve to their unfingerprinted paths
+func NewManifest(manifestPath, urlPrefix string, reload bool) (*Manifest, error) {
+	m := &Manifest{
+		Path:      manifestPath,
+		URLPrefix: strings.TrimRight(urlPrefix, "/"),
+		Reload:    reload,
+		entries:   make(map[string]string),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// load reads the manifest file if it exists and changed since the last read
+func (m *Manifest) load() error {
+	info, err := os.Stat(m.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	unchanged := info.ModTime().Equal(m.modTime)
+	m.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	content, err := os.ReadFile(m.Path)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.entries = entries
+	m.modTime = info.ModTime()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Lookup returns the fingerprinted path of an asset and whether it is in the manifest
+func (m *Manifest) Lookup(name string) (string, bool) {
+	if m.Reload {
+		_ = m.load()
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	hashed, ok := m.entries[strings.TrimPrefix(path.Clean("/"+name), "/")]
+	return hashed, ok
+}
+
+// URL returns the public URL of an asset, using its fingerprinted path when the
+// manifest knows it
+func (m *Manifest) URL(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if hashed, ok := m.Lookup(name); ok {
+		name = hashed
+	}
+	return m.URLPrefix + "/" + name
+}
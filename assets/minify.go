@@ -0,0 +1,186 @@
+package assets
+
+import (
+	"bytes"
+	"strings"
+)
+
+// MinifyCSS removes comments and collapses whitespace in a stylesheet, leaving
+// quoted strings untouched
+func MinifyCSS(src string) string {
+	out := make([]byte, 0, len(src))
+
+	// declarations tracks the open blocks, true for blocks of declarations and
+	// false for blocks of rules such as @media
+	var declarations []bool
+	pendingSpace := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return strings.TrimSpace(string(out))
+			}
+			i += end + 3
+			continue
+
+		case c == '"' || c == '\'':
+			end := quotedEnd(src, i)
+			if pendingSpace {
+				out = append(out, ' ')
+				pendingSpace = false
+			}
+			out = append(out, src[i:end]...)
+			i = end - 1
+			continue
+
+		case isSpace(c):
+			pendingSpace = len(out) > 0
+			continue
+
+		case strings.IndexByte("{};:,>", c) >= 0:
+			// no whitespace is needed around these, but keep "a :hover" style selectors
+			inDeclarations := len(declarations) > 0 && declarations[len(declarations)-1]
+			if c == ':' && pendingSpace && !inDeclarations {
+				out = append(out, ' ')
+			}
+			switch c {
+			case '{':
+				declarations = append(declarations, !holdsRules(out))
+			case '}':
+				if len(declarations) > 0 {
+					declarations = declarations[:len(declarations)-1]
+				}
+			}
+			pendingSpace = false
+			// drop the redundant semicolon before a closing brace
+			if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+				out = out[:len(out)-1]
+			}
+			out = append(out, c)
+			skipSpaces(src, &i)
+			continue
+		}
+
+		if pendingSpace {
+			out = append(out, ' ')
+			pendingSpace = false
+		}
+		out = append(out, c)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// MinifyJS conservatively minifies a script: it strips comments, leading indentation
+// and blank lines but keeps line breaks, so automatic semicolon insertion still works.
+// Strings and template literals are preserved as written.
+func MinifyJS(src string) string {
+	out := make([]byte, 0, len(src))
+
+	atLineStart := true
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/' && !looksLikeRegexContext(out):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end - 1
+			}
+			continue
+
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = len(src)
+				continue
+			}
+			i += end + 3
+			continue
+
+		case c == '"' || c == '\'' || c == '`':
+			end := quotedEnd(src, i)
+			out = append(out, src[i:end]...)
+			i = end - 1
+			atLineStart = false
+			continue
+
+		case c == '\n' || c == '\r':
+			if !atLineStart {
+				for len(out) > 0 && (out[len(out)-1] == ' ' || out[len(out)-1] == '\t') {
+					out = out[:len(out)-1]
+				}
+				out = append(out, '\n')
+			}
+			atLineStart = true
+			continue
+
+		case isSpace(c) && atLineStart:
+			continue
+		}
+
+		atLineStart = false
+		out = append(out, c)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// quotedEnd returns the index just past the string literal starting at start
+func quotedEnd(src string, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// looksLikeRegexContext reports whether a "//" at this point is likely inside a regular
+// expression literal such as /\//, in which case it must not be treated as a comment
+func looksLikeRegexContext(before []byte) bool {
+	line := before[bytes.LastIndexByte(before, '\n')+1:]
+	slashes := 0
+	for i, c := range line {
+		if c == '/' && (i == 0 || line[i-1] != '\\') {
+			slashes++
+		}
+	}
+	return slashes%2 == 1
+}
+
+// ruleAtRules are the at-rules whose blocks hold rules rather than declarations
+var ruleAtRules = []string{"@media", "@supports", "@container", "@layer", "@document", "@scope", "@starting-style"}
+
+// holdsRules reports whether the block opened after the minified output so far holds
+// rules, i.e. its prelude is an at-rule such as @media
+func holdsRules(out []byte) bool {
+	prelude := string(out[bytes.LastIndexAny(out, "{};")+1:])
+	for _, name := range ruleAtRules {
+		if strings.HasPrefix(prelude, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipSpaces advances i past any whitespace following position i
+func skipSpaces(src string, i *int) {
+	for *i+1 < len(src) && isSpace(src[*i+1]) {
+		*i++
+	}
+}
+
+// isSpace reports whether c is an ASCII whitespace character
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,169 @@
+package gudu
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deenikarim/gudu/auth"
+	"github.com/deenikarim/gudu/mails"
+	"github.com/deenikarim/gudu/twofactor"
+)
+
+// loadAuthConfig reads the authentication settings; unset values keep the auth
+// package defaults
+func loadAuthConfig() auth.Config {
+	maxAttempts, _ := strconv.Atoi(os.Getenv("AUTH_MAX_ATTEMPTS"))
+	maxIdentifierAttempts, _ := strconv.Atoi(os.Getenv("AUTH_MAX_IDENTIFIER_ATTEMPTS"))
+	return auth.Config{
+		RememberTTL: envDuration("AUTH_REMEMBER_TTL"),
+		MaxAttempts: maxAttempts,
+		Lockout:     envDuration("AUTH_LOCKOUT"),
+		ResetTTL:    envDuration("AUTH_RESET_TTL"),
+		LoginPath:   os.Getenv("AUTH_LOGIN_PATH"),
+		HomePath:    os.Getenv("AUTH_HOME_PATH"),
+
+		VerifyNoticePath: os.Getenv("AUTH_VERIFY_NOTICE_PATH"),
+		TwoFactorPath:    os.Getenv("AUTH_TWO_FACTOR_PATH"),
+		TwoFactorTimeout: envDuration("AUTH_TWO_FACTOR_TIMEOUT"),
+
+		MaxIdentifierAttempts: maxIdentifierAttempts,
+	}
+}
+
+// createAuth creates g.Auth over the session manager. With a database the users,
+// remember_tokens, tokens and password_resets tables of `gudu make auth` are used;
+// replace g.Auth.Users to log in users stored elsewhere. Failed logins, verification
+// mails and used two-factor codes are counted in the application cache, or in memory
+// without one. Two-factor authentication is used with AUTH_TWO_FACTOR only, the users
+// tables of older applications lack its columns; secrets are encrypted with KEY when it
+// is set.
+func (g *Gudu) createAuth() {
+	config := g.config.auth
+	config.CookieSecure, _ = strconv.ParseBool(g.config.cookies.secure)
+	config.CookieDomain = g.config.cookies.domain
+	config.Unauthorized = func(w http.ResponseWriter, r *http.Request, err error) {
+		g.HandleError(w, r, NewProblem(http.StatusUnauthorized, "A valid bearer token is required."))
+	}
+	config.Unverified = func(w http.ResponseWriter, r *http.Request) {
+		if g.ResponseFor(w, r).problemMediaType() == "text/html" {
+			http.Redirect(w, r, g.Auth.Config().VerifyNoticePath, http.StatusSeeOther)
+			return
+		}
+		g.HandleError(w, r, NewProblem(http.StatusForbidden, "Your email address is not verified."))
+	}
+
+	g.Auth = auth.New(g.Sessions, nil, g.Hasher, config)
+	if db := g.DBConnection.SqlConnPool; db != nil {
+		users := auth.NewSQLUsers(db, g.DBConnection.DatabaseType)
+		g.Auth.Users = users
+		g.Auth.Verifier = users
+		if g.config.twoFactor.enabled {
+			g.Auth.TwoFactor = users
+		}
+		g.Auth.Remember = auth.NewSQLRememberTokens(db, g.DBConnection.DatabaseType)
+		g.Auth.Tokens = auth.NewSQLTokens(db, g.DBConnection.DatabaseType, users)
+		g.Auth.Resets = auth.NewSQLResetTokens(db, g.DBConnection.DatabaseType)
+	}
+
+	var store auth.Store = auth.NewMemoryStore()
+	if g.Cache != nil {
+		store = cacheStore{g.Cache}
+	}
+	g.Auth.Throttle = auth.NewThrottle(store, g.Auth.Config().MaxAttempts, g.Auth.Config().Lockout)
+	g.verifyThrottle = auth.NewThrottle(store, g.config.verification.maxResends, g.config.verification.resendWindow)
+	g.resetThrottle = auth.NewThrottle(store, g.config.passwordReset.maxMails, g.config.passwordReset.mailWindow)
+	g.Auth.TOTP = twofactor.New(twofactor.Options{
+		Issuer: g.config.twoFactor.issuer,
+		Skew:   g.config.twoFactor.skew,
+	}, store)
+	if g.EncryptionKey != "" {
+		g.Auth.Encrypter = g.Encrypter()
+	}
+}
+
+// absoluteURL resolves a path against the scheme and SERVER_NAME of the application,
+// which may include a port; links in mails never use the Host header of the request,
+// which a client can forge
+func (g *Gudu) absoluteURL(path string) string {
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		return path
+	}
+	scheme := "http"
+	if g.config.secure {
+		scheme = "https"
+	}
+	host := g.config.serverName
+	if host == "" {
+		host = "localhost:" + g.config.port
+	}
+	return scheme + "://" + host + "/" + strings.TrimPrefix(path, "/")
+}
+
+// sendAuthMail sends a mail of the auth flows from the html and plain text templates of
+// the mails folder; APP_NAME is added to the data as AppName
+func (g *Gudu) sendAuthMail(to, subject, template string, data map[string]interface{}) error {
+	if g.MailerMail == nil {
+		return errors.New("no mailer configured")
+	}
+	data["AppName"] = os.Getenv("APP_NAME")
+
+	message := &mails.Message{
+		From:    g.MailerMail.Config.From,
+		To:      []mails.EmailAddress{{Address: to}},
+		Subject: subject,
+	}
+	if err := g.MailerMail.SetHTMLBodyFromTemplate(message, template, data); err != nil {
+		return err
+	}
+	if err := g.MailerMail.SetBodyFromTemplate(message, template, data); err != nil {
+		return err
+	}
+	message.ContentType = mails.TextHTML
+	return g.MailerMail.SendEmail(message)
+}
+
+// AuthUser returns the logged-in user of the request, nil for guests. Deactivated
+// users and sessions older than a password change count as guests, see auth.Auth.User.
+func (g *Gudu) AuthUser(r *http.Request) auth.User {
+	user, err := g.Auth.User(r)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// authProblem maps the errors of logins to problems for APIs: 429 with Retry-After
+// while locked out, 401 otherwise; logins waiting for the second factor are marked
+// with two_factor, the code is then posted to AUTH_TWO_FACTOR_PATH
+func authProblem(err error) error {
+	var lockout *auth.LockoutError
+	if errors.As(err, &lockout) {
+		return NewProblem(http.StatusTooManyRequests, auth.LoginMessage(err)).
+			With("retry_after", int(lockout.RetryAfter.Seconds()))
+	}
+	if errors.Is(err, auth.ErrTwoFactorRequired) {
+		return NewProblem(http.StatusUnauthorized, auth.LoginMessage(err)).With("two_factor", true)
+	}
+	for _, target := range []error{auth.ErrInvalidCredentials, auth.ErrInactive} {
+		if errors.Is(err, target) {
+			return NewProblem(http.StatusUnauthorized, auth.LoginMessage(err))
+		}
+	}
+	return err
+}
+
+// Login checks the credentials and logs the user in, returning problems for rejected
+// logins, e.g. in a JSON login handler registered with Gudu.Handle:
+//
+//	user, err := g.Login(w, r, input.Email, input.Password, input.Remember)
+func (g *Gudu) Login(w http.ResponseWriter, r *http.Request, identifier, password string, remember bool) (auth.User, error) {
+	user, err := g.Auth.Attempt(w, r, strings.TrimSpace(identifier), password, remember)
+	if err != nil {
+		return nil, authProblem(err)
+	}
+	return user, nil
+}
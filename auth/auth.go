@@ -0,0 +1,463 @@
+// Package auth authenticates the users of an application: password logins with
+// throttling and lockout, sessions renewed on login, remember-me cookies and guards
+// for web pages and bearer token APIs. Users are found through a UserProvider, so
+// any storage works; SQLUsers reads the users table of `gudu make auth`.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/deenikarim/gudu/twofactor"
+)
+
+var (
+	// ErrUserNotFound is returned by providers for unknown users
+	ErrUserNotFound = errors.New("auth: user not found")
+	// ErrInvalidCredentials is returned for an unknown identifier or a wrong password
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+	// ErrInactive is returned when the password matches but the user is not active
+	ErrInactive = errors.New("auth: user is not active")
+	// ErrTooManyAttempts matches the LockoutError of a throttled login
+	ErrTooManyAttempts = errors.New("auth: too many login attempts")
+	// ErrUnauthenticated is returned when a request carries no valid credentials
+	ErrUnauthenticated = errors.New("auth: unauthenticated")
+)
+
+// LockoutError is returned while an identifier is locked out after too many failed
+// logins; errors.Is reports it as ErrTooManyAttempts
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("auth: too many login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// User is an authenticatable user
+type User interface {
+	// AuthID returns the identifier stored in the session
+	AuthID() string
+	// AuthPassword returns the password hash
+	AuthPassword() string
+}
+
+// ActiveUser is implemented by users that can be deactivated; inactive users can not
+// log in
+type ActiveUser interface {
+	AuthActive() bool
+}
+
+// UserProvider finds users, returning ErrUserNotFound for unknown ones
+type UserProvider interface {
+	UserByID(ctx context.Context, id string) (User, error)
+	// UserByIdentifier finds the user logging in, e.g. by email address
+	UserByIdentifier(ctx context.Context, identifier string) (User, error)
+}
+
+// PasswordUpdater is implemented by providers that can store a new password hash;
+// passwords are then rehashed on login when the hashing settings change
+type PasswordUpdater interface {
+	UpdatePassword(ctx context.Context, user User, hash string) error
+}
+
+// PasswordHasher hashes and verifies passwords, it is satisfied by *hashing.Hasher
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// Config configures an Auth; zero values select the defaults
+type Config struct {
+	// SessionKey is the session key of the user id, "user_id" by default
+	SessionKey string
+	// RememberCookie is the name of the remember-me cookie, "remember_token" by default
+	RememberCookie string
+	// RememberTTL is the lifetime of remember-me cookies, 30 days by default
+	RememberTTL time.Duration
+	// CookieSecure and CookieDomain apply to the remember-me cookie
+	CookieSecure bool
+	CookieDomain string
+	// MaxAttempts is the number of failed logins of a client before a lockout, 5 by
+	// default
+	MaxAttempts int
+	// MaxIdentifierAttempts is the number of failed logins of an identifier from any
+	// client before a lockout, 4 times MaxAttempts by default
+	MaxIdentifierAttempts int
+	// Lockout is how long a locked identifier waits, and the window in which failed
+	// attempts are counted, 15 minutes by default
+	Lockout time.Duration
+	// ResetTTL is the lifetime of password reset tokens, 1 hour by default
+	ResetTTL time.Duration
+	// LoginPath is where RequireWeb sends guests, "/login" by default
+	LoginPath string
+	// HomePath is where logins without an intended page go, "/" by default
+	HomePath string
+	// LogoutPath is where LogoutHandler redirects, "/" by default
+	LogoutPath string
+	// VerifyNoticePath is where RequireVerified sends unverified users,
+	// "/verify-email" by default
+	VerifyNoticePath string
+	// TwoFactorPath is the page asking for the second factor of pending logins,
+	// "/two-factor-challenge" by default
+	TwoFactorPath string
+	// TwoFactorTimeout is how long a login waits for the second factor, 10 minutes by
+	// default
+	TwoFactorTimeout time.Duration
+	// IdentifierField, PasswordField and RememberField are the login form fields,
+	// "email", "password" and "remember" by default
+	IdentifierField string
+	PasswordField   string
+	RememberField   string
+	// LoginFailed answers failed logins of LoginHandler. By default the error message
+	// is put in the session under "error" and the client is sent back to LoginPath.
+	LoginFailed func(w http.ResponseWriter, r *http.Request, err error)
+	// Unauthorized answers requests rejected by RequireAPI, a plain 401 when nil
+	Unauthorized func(w http.ResponseWriter, r *http.Request, err error)
+	// Unverified answers requests of unverified users rejected by RequireVerified
+	Unverified func(w http.ResponseWriter, r *http.Request)
+}
+
+// Auth authenticates users. Users and Hasher are required for logins; Remember
+// enables remember-me cookies, Tokens the bearer tokens of RequireAPI, Resets password
+// resets, Verifier email verification and TwoFactor two-factor authentication, with
+// the secrets encrypted by Encrypter.
+type Auth struct {
+	Sessions  *scs.SessionManager
+	Users     UserProvider
+	Hasher    PasswordHasher
+	Remember  RememberTokenStore
+	Tokens    TokenProvider
+	Resets    ResetTokenStore
+	Verifier  EmailVerifier
+	TwoFactor TwoFactorStore
+	Encrypter Encrypter
+	Throttle  *Throttle
+	TOTP      *twofactor.TOTP
+
+	config    Config
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// New creates an Auth over the session manager; failed logins are throttled, and used
+// two-factor codes recorded, in memory until Throttle and TOTP are replaced
+func New(sessions *scs.SessionManager, users UserProvider, hasher PasswordHasher, config Config) *Auth {
+	if config.SessionKey == "" {
+		config.SessionKey = "user_id"
+	}
+	if config.RememberCookie == "" {
+		config.RememberCookie = "remember_token"
+	}
+	if config.RememberTTL <= 0 {
+		config.RememberTTL = 30 * 24 * time.Hour
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.MaxIdentifierAttempts <= 0 {
+		config.MaxIdentifierAttempts = 4 * config.MaxAttempts
+	}
+	if config.Lockout <= 0 {
+		config.Lockout = 15 * time.Minute
+	}
+	if config.ResetTTL <= 0 {
+		config.ResetTTL = time.Hour
+	}
+	if config.LoginPath == "" {
+		config.LoginPath = "/login"
+	}
+	if config.HomePath == "" {
+		config.HomePath = "/"
+	}
+	if config.LogoutPath == "" {
+		config.LogoutPath = "/"
+	}
+	if config.VerifyNoticePath == "" {
+		config.VerifyNoticePath = "/verify-email"
+	}
+	if config.TwoFactorPath == "" {
+		config.TwoFactorPath = "/two-factor-challenge"
+	}
+	if config.TwoFactorTimeout <= 0 {
+		config.TwoFactorTimeout = 10 * time.Minute
+	}
+	if config.IdentifierField == "" {
+		config.IdentifierField = "email"
+	}
+	if config.PasswordField == "" {
+		config.PasswordField = "password"
+	}
+	if config.RememberField == "" {
+		config.RememberField = "remember"
+	}
+	return &Auth{
+		Sessions: sessions,
+		Users:    users,
+		Hasher:   hasher,
+		Throttle: NewThrottle(NewMemoryStore(), config.MaxAttempts, config.Lockout),
+		TOTP:     twofactor.New(twofactor.Options{}, NewMemoryStore()),
+		config:   config,
+	}
+}
+
+// Config returns the configuration with the defaults applied
+func (a *Auth) Config() Config {
+	return a.config
+}
+
+// Attempt checks the credentials and logs the user in. Failed attempts are counted per
+// identifier and client address, and per identifier alone since client addresses can
+// be spoofed; once MaxAttempts or MaxIdentifierAttempts is reached a *LockoutError is
+// returned until the lockout ends. Unknown identifiers and wrong passwords both return
+// ErrInvalidCredentials after hashing, so they can not be told apart by their timing.
+// Users with two-factor authentication are returned with ErrTwoFactorRequired, see
+// LoginOrChallenge.
+func (a *Auth) Attempt(w http.ResponseWriter, r *http.Request, identifier, password string, remember bool) (User, error) {
+	if a.Users == nil || a.Hasher == nil {
+		return nil, errors.New("auth: a user provider and a hasher are required")
+	}
+	key, idKey := throttleKey(identifier, r), identifierKey(identifier)
+	if wait, err := a.lockedOut(key, idKey); err != nil {
+		return nil, err
+	} else if wait > 0 {
+		return nil, &LockoutError{RetryAfter: wait}
+	}
+
+	user, err := a.Users.UserByIdentifier(r.Context(), identifier)
+	if errors.Is(err, ErrUserNotFound) {
+		a.verifyDummy(password)
+		return nil, a.failed(key, idKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := a.Hasher.Verify(password, user.AuthPassword())
+	if err != nil {
+		return nil, err
+	}
+	if !matched {
+		return nil, a.failed(key, idKey)
+	}
+	if active, ok := user.(ActiveUser); ok && !active.AuthActive() {
+		return nil, ErrInactive
+	}
+	if err := a.Throttle.Clear(key); err != nil {
+		return nil, err
+	}
+	if err := a.Throttle.Clear(idKey); err != nil {
+		return nil, err
+	}
+
+	user, err = a.rehash(r.Context(), user, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.LoginOrChallenge(w, r, user, remember); errors.Is(err, ErrTwoFactorRequired) {
+		return user, err
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// lockedOut returns the lockout of the identifier and client address, or else of the
+// identifier alone
+func (a *Auth) lockedOut(key, idKey string) (time.Duration, error) {
+	wait, err := a.Throttle.Locked(key)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	return a.Throttle.Locked(idKey)
+}
+
+// failed counts a failed attempt of the identifier and client address and of the
+// identifier alone, returning the lockout it caused or ErrInvalidCredentials
+func (a *Auth) failed(key, idKey string) error {
+	wait, err := a.Throttle.Hit(key)
+	if err != nil {
+		return err
+	}
+	idWait, err := a.Throttle.WithMax(a.config.MaxIdentifierAttempts).Hit(idKey)
+	if err != nil {
+		return err
+	}
+	if wait = max(wait, idWait); wait > 0 {
+		return &LockoutError{RetryAfter: wait}
+	}
+	return ErrInvalidCredentials
+}
+
+// verifyDummy verifies the password against a throwaway hash, so unknown users take as
+// long as known ones
+func (a *Auth) verifyDummy(password string) {
+	a.dummyOnce.Do(func() {
+		a.dummyHash, _ = a.Hasher.Hash("gudu dummy password")
+	})
+	if a.dummyHash != "" {
+		_, _ = a.Hasher.Verify(password, a.dummyHash)
+	}
+}
+
+// rehash stores a new hash when the hashing settings changed since the password was
+// set and returns the reloaded user. Failed updates fail the login, so a password
+// column too short for the hashes does not go unnoticed.
+func (a *Auth) rehash(ctx context.Context, user User, password string) (User, error) {
+	updater, ok := a.Users.(PasswordUpdater)
+	if !ok || !a.Hasher.NeedsRehash(user.AuthPassword()) {
+		return user, nil
+	}
+	hash, err := a.Hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+	if err := updater.UpdatePassword(ctx, user, hash); err != nil {
+		return nil, fmt.Errorf("auth: upgrading the password hash: %w", err)
+	}
+	return a.Users.UserByID(ctx, user.AuthID())
+}
+
+// Login logs the user in without checking credentials, e.g. after a registration.
+// The session token is renewed first so a token planted before the login is useless.
+// The session is bound to the password hash of the user, so changing the password
+// ends it.
+func (a *Auth) Login(w http.ResponseWriter, r *http.Request, user User, remember bool) error {
+	ctx := r.Context()
+	if err := a.Sessions.RenewToken(ctx); err != nil {
+		return err
+	}
+	forgetCachedUser(ctx)
+	a.Sessions.Put(ctx, a.config.SessionKey, user.AuthID())
+	a.Sessions.Put(ctx, passwordKey, passwordStamp(user))
+	if remember && a.Remember != nil {
+		return a.remember(ctx, w, user.AuthID())
+	}
+	return nil
+}
+
+// Logout logs the user out: the session is destroyed and the remember-me token of the
+// request is deleted
+func (a *Auth) Logout(w http.ResponseWriter, r *http.Request) error {
+	if err := a.forgetCookie(w, r); err != nil {
+		return err
+	}
+	forgetCachedUser(r.Context())
+	return a.Sessions.Destroy(r.Context())
+}
+
+// Check reports whether the session of the request belongs to a logged-in user
+func (a *Auth) Check(r *http.Request) bool {
+	return a.ID(r) != ""
+}
+
+// ID returns the id of the logged-in user, empty for guests
+func (a *Auth) ID(r *http.Request) string {
+	if user, ok := FromContext(r.Context()); ok {
+		return user.AuthID()
+	}
+	return sessionID(a.Sessions.Get(r.Context(), a.config.SessionKey))
+}
+
+// User returns the user of the request, set by the guards, or loads the user of the
+// session with the checks of the guards: deleted and deactivated users, and sessions
+// older than a password change, are guests. Within CacheUser the user is loaded once
+// per request.
+func (a *Auth) User(r *http.Request) (User, error) {
+	if user, ok := FromContext(r.Context()); ok {
+		return user, nil
+	}
+	cache, _ := r.Context().Value(userCacheKey{}).(*userCache)
+	if cache == nil {
+		return a.sessionUser(r)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !cache.resolved {
+		user, err := a.sessionUser(r)
+		if err != nil && !errors.Is(err, ErrUnauthenticated) {
+			return nil, err
+		}
+		cache.user, cache.resolved = user, true
+	}
+	if cache.user == nil {
+		return nil, ErrUnauthenticated
+	}
+	return cache.user, nil
+}
+
+// userCacheKey is the type of the request context key of the user cache
+type userCacheKey struct{}
+
+// userCache keeps the user of the session for the rest of a request
+type userCache struct {
+	mu       sync.Mutex
+	resolved bool
+	user     User
+}
+
+// CacheUser middleware lets User load the user of the session once per request, e.g.
+// for the authorization checks of a page
+func CacheUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCacheKey{}, &userCache{})))
+	})
+}
+
+// forgetCachedUser drops the user cached for the request, on login and logout
+func forgetCachedUser(ctx context.Context) {
+	if cache, ok := ctx.Value(userCacheKey{}).(*userCache); ok {
+		cache.mu.Lock()
+		cache.user, cache.resolved = nil, false
+		cache.mu.Unlock()
+	}
+}
+
+// passwordKey is the session key of the password stamp
+const passwordKey = "auth.password"
+
+// passwordStamp identifies the password hash of the user without storing it in the
+// session
+func passwordStamp(user User) string {
+	sum := sha256.Sum256([]byte(user.AuthPassword()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sessionID converts the session value to the user id; older applications stored ints
+func sessionID(value interface{}) string {
+	switch id := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+// contextKey is the type of the request context key of the user
+type contextKey struct{}
+
+// NewContext returns a context carrying the authenticated user
+func NewContext(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// FromContext returns the user placed in the context by the guards
+func FromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok
+}
@@ -0,0 +1,706 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/deenikarim/gudu/hashing"
+	"github.com/deenikarim/gudu/twofactor"
+)
+
+// memoryUsers is a UserProvider and RememberTokenStore for tests
+type memoryUsers struct {
+	mu        sync.Mutex
+	users     map[string]*SQLUser
+	remember  map[string]string
+	tokens    map[string]string
+	resets    map[string]string
+	verified  map[string]bool
+	twoFactor map[string]TwoFactor
+}
+
+func newMemoryUsers(t *testing.T, hasher PasswordHasher) *memoryUsers {
+	t.Helper()
+	hash, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memoryUsers{
+		users: map[string]*SQLUser{
+			"1": {ID: "1", Email: "ada@example.com", Password: hash, Active: true},
+			"2": {ID: "2", Email: "bob@example.com", Password: hash},
+		},
+		remember:  make(map[string]string),
+		tokens:    map[string]string{"api-token": "1"},
+		resets:    make(map[string]string),
+		verified:  make(map[string]bool),
+		twoFactor: make(map[string]TwoFactor),
+	}
+}
+
+func (m *memoryUsers) UserByID(_ context.Context, id string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *memoryUsers) UserByIdentifier(_ context.Context, identifier string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == identifier {
+			return user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *memoryUsers) CreateRememberToken(_ context.Context, userID, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remember[tokenHash] = userID
+	return nil
+}
+
+func (m *memoryUsers) RememberTokenUser(_ context.Context, tokenHash string, _ time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.remember[tokenHash]; ok {
+		return id, nil
+	}
+	return "", ErrTokenNotFound
+}
+
+func (m *memoryUsers) DeleteRememberToken(_ context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.remember, tokenHash)
+	return nil
+}
+
+func (m *memoryUsers) DeleteUserRememberTokens(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, id := range m.remember {
+		if id == userID {
+			delete(m.remember, hash)
+		}
+	}
+	return nil
+}
+
+func (m *memoryUsers) UpdatePassword(_ context.Context, user User, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updated := *m.users[user.AuthID()]
+	updated.Password = hash
+	m.users[user.AuthID()] = &updated
+	return nil
+}
+
+func (m *memoryUsers) CreateResetToken(_ context.Context, userID, tokenHash string, _ time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets[tokenHash] = userID
+	return nil
+}
+
+func (m *memoryUsers) ConsumeResetToken(_ context.Context, tokenHash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.resets[tokenHash]
+	if !ok {
+		return "", ErrTokenNotFound
+	}
+	delete(m.resets, tokenHash)
+	return id, nil
+}
+
+func (m *memoryUsers) EmailVerified(_ context.Context, userID string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.users[userID].Email, m.verified[userID], nil
+}
+
+func (m *memoryUsers) MarkEmailVerified(_ context.Context, userID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updated := *m.users[userID]
+	updated.Email = email
+	m.users[userID] = &updated
+	m.verified[userID] = true
+	return nil
+}
+
+func (m *memoryUsers) TwoFactor(_ context.Context, userID string) (TwoFactor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.twoFactor[userID], nil
+}
+
+func (m *memoryUsers) SaveTwoFactor(_ context.Context, userID string, state TwoFactor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.twoFactor[userID] = state
+	return nil
+}
+
+func (m *memoryUsers) UserByToken(ctx context.Context, token string) (User, error) {
+	m.mu.Lock()
+	id, ok := m.tokens[token]
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return m.UserByID(ctx, id)
+}
+
+// testApp serves a login form handler, a guarded page and a guarded API
+func testApp(t *testing.T) (*Auth, *memoryUsers, *httptest.Server) {
+	t.Helper()
+	hasher := hashing.New(hashing.Options{Driver: hashing.Bcrypt, BcryptCost: 4})
+	users := newMemoryUsers(t, hasher)
+	a := New(scs.New(), users, hasher, Config{MaxAttempts: 3})
+	a.Remember = users
+	a.Tokens = users
+	a.Resets = users
+	a.Verifier = users
+	a.TwoFactor = users
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", a.LoginHandler)
+	mux.HandleFunc("/two-factor-challenge", func(w http.ResponseWriter, r *http.Request) {
+		_, err := a.ChallengeTwoFactor(w, r, r.FormValue("code"), r.FormValue("recovery_code"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		}
+	})
+	mux.HandleFunc("/logout", a.LogoutHandler)
+	mux.Handle("/dashboard", a.RequireWeb(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := FromContext(r.Context())
+		_, _ = w.Write([]byte("hello " + user.AuthID()))
+	})))
+	mux.Handle("/settings", a.RequireVerified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("settings"))
+	})))
+	mux.Handle("/api", a.RequireAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := FromContext(r.Context())
+		_, _ = w.Write([]byte(user.AuthID()))
+	})))
+	server := httptest.NewServer(a.Sessions.LoadAndSave(mux))
+	t.Cleanup(server.Close)
+	return a, users, server
+}
+
+// client does not follow redirects and keeps cookies
+func client(t *testing.T) *http.Client {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+}
+
+func login(t *testing.T, c *http.Client, server *httptest.Server, email, password string, remember bool) *http.Response {
+	t.Helper()
+	form := url.Values{"email": {email}, "password": {password}}
+	if remember {
+		form.Set("remember", "on")
+	}
+	resp, err := c.PostForm(server.URL+"/login", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func get(t *testing.T, c *http.Client, target string) (*http.Response, string) {
+	t.Helper()
+	resp, err := c.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestLoginRenewsSessionAndRedirectsToIntended(t *testing.T) {
+	_, _, server := testApp(t)
+	c := client(t)
+
+	resp, _ := get(t, c, server.URL+"/dashboard")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("expected a redirect to the login page, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	serverURL, _ := url.Parse(server.URL)
+	before := c.Jar.Cookies(serverURL)
+
+	resp = login(t, c, server, "ada@example.com", "secret", false)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/dashboard" {
+		t.Fatalf("expected a redirect to the intended page, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	after := c.Jar.Cookies(serverURL)
+	if len(before) == 0 || len(after) == 0 || before[0].Value == after[0].Value {
+		t.Error("expected the session token to be renewed on login")
+	}
+
+	if _, body := get(t, c, server.URL+"/dashboard"); body != "hello 1" {
+		t.Errorf("expected the dashboard, got %q", body)
+	}
+
+	resp, _ = get(t, c, server.URL+"/logout")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after logout, got %d", resp.StatusCode)
+	}
+	if resp, _ := get(t, c, server.URL+"/dashboard"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("expected to be logged out, got %d", resp.StatusCode)
+	}
+}
+
+func TestAttemptThrottling(t *testing.T) {
+	a, _, server := testApp(t)
+	c := client(t)
+
+	for i := 0; i < 2; i++ {
+		login(t, c, server, "ada@example.com", "wrong", false)
+	}
+	resp := login(t, c, server, "ada@example.com", "wrong", false)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("expected the third failure to lock the user out")
+	}
+
+	// the right password is refused during the lockout
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	ctx, _ := a.Sessions.Load(r.Context(), "")
+	_, err := a.Attempt(httptest.NewRecorder(), r.WithContext(ctx), "ada@example.com", "secret", false)
+	var lockout *LockoutError
+	if !errors.As(err, &lockout) || !errors.Is(err, ErrTooManyAttempts) || lockout.RetryAfter <= 0 {
+		t.Errorf("expected a lockout, got %v", err)
+	}
+
+	// unknown users count as failures too, and inactive ones can not log in
+	r.RemoteAddr = "10.0.0.1:1234"
+	if _, err := a.Attempt(httptest.NewRecorder(), r.WithContext(ctx), "nobody@example.com", "secret", false); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := a.Attempt(httptest.NewRecorder(), r.WithContext(ctx), "bob@example.com", "secret", false); !errors.Is(err, ErrInactive) {
+		t.Errorf("expected ErrInactive, got %v", err)
+	}
+}
+
+func TestAttemptThrottlesIdentifierAcrossAddresses(t *testing.T) {
+	hasher := hashing.New(hashing.Options{Driver: hashing.Bcrypt, BcryptCost: 4})
+	a := New(scs.New(), newMemoryUsers(t, hasher), hasher, Config{MaxAttempts: 3, MaxIdentifierAttempts: 4})
+
+	// a client rotating its address, as with a spoofed X-Forwarded-For, is still
+	// locked out once the identifier reaches its own limit
+	attempt := func(addr, password string) error {
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = addr
+		ctx, _ := a.Sessions.Load(r.Context(), "")
+		_, err := a.Attempt(httptest.NewRecorder(), r.WithContext(ctx), "ada@example.com", password, false)
+		return err
+	}
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.2:1234", "10.0.0.3:1234"} {
+		if err := attempt(addr, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt from %s: %v", addr, err)
+		}
+	}
+	if err := attempt("10.0.0.9:1234", "wrong"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected the identifier to be locked out, got %v", err)
+	}
+	if err := attempt("10.0.0.10:1234", "secret"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("expected the lockout from a new address, got %v", err)
+	}
+}
+
+func TestThrottleHitIsAtomic(t *testing.T) {
+	throttle := NewThrottle(NewMemoryStore(), 10, time.Minute)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	lockouts := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := throttle.Hit("key")
+			if err != nil {
+				t.Error(err)
+			}
+			if wait > 0 {
+				mu.Lock()
+				lockouts++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if lockouts != 5 {
+		t.Errorf("50 concurrent failures locked out %d times, want 5", lockouts)
+	}
+}
+
+// failingUpdater is a user provider whose password updates fail, like a password
+// column too short for the new hashes
+type failingUpdater struct{ *memoryUsers }
+
+func (failingUpdater) UpdatePassword(context.Context, User, string) error {
+	return errors.New("value too long for type character varying(60)")
+}
+
+func TestAttemptRehashes(t *testing.T) {
+	a, users, _ := testApp(t)
+	a.Hasher = hashing.New(hashing.Options{Driver: hashing.Bcrypt, BcryptCost: 5})
+	attempt := func(email string) error {
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		ctx, _ := a.Sessions.Load(r.Context(), "")
+		_, err := a.Attempt(httptest.NewRecorder(), r.WithContext(ctx), email, "secret", false)
+		return err
+	}
+
+	old := users.users["1"].Password
+	if err := attempt("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if hash := users.users["1"].Password; hash == old || a.Hasher.NeedsRehash(hash) {
+		t.Error("expected the hash to be upgraded on login")
+	}
+
+	// failed upgrades are not ignored
+	a.Users = failingUpdater{users}
+	users.users["2"].Active = true
+	if err := attempt("bob@example.com"); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("expected the failed upgrade, got %v", err)
+	}
+}
+
+func TestRememberMe(t *testing.T) {
+	a, users, server := testApp(t)
+	c := client(t)
+	login(t, c, server, "ada@example.com", "secret", true)
+
+	serverURL, _ := url.Parse(server.URL)
+	var remember *http.Cookie
+	for _, cookie := range c.Jar.Cookies(serverURL) {
+		if cookie.Name == a.Config().RememberCookie {
+			remember = cookie
+		}
+	}
+	if remember == nil || len(users.remember) != 1 {
+		t.Fatal("expected a remember-me cookie and a stored token")
+	}
+	if _, ok := users.remember[remember.Value]; ok {
+		t.Error("expected the token to be stored hashed")
+	}
+
+	// a new browser session with only the cookie is logged in, and the token rotated
+	fresh := client(t)
+	fresh.Jar.SetCookies(serverURL, []*http.Cookie{{Name: remember.Name, Value: remember.Value}})
+	if _, body := get(t, fresh, server.URL+"/dashboard"); body != "hello 1" {
+		t.Fatalf("expected the remembered user, got %q", body)
+	}
+	if _, ok := users.remember[hashToken(remember.Value)]; ok || len(users.remember) != 1 {
+		t.Error("expected the remember-me token to be rotated")
+	}
+
+	// the replaced cookie no longer works
+	stolen := client(t)
+	stolen.Jar.SetCookies(serverURL, []*http.Cookie{{Name: remember.Name, Value: remember.Value}})
+	if resp, _ := get(t, stolen, server.URL+"/dashboard"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("expected the used token to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestResetPasswordEndsSessions(t *testing.T) {
+	a, users, server := testApp(t)
+	c := client(t)
+	login(t, c, server, "ada@example.com", "secret", true)
+
+	ctx := context.Background()
+	if _, _, err := a.CreateResetToken(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	_, token, err := a.CreateResetToken(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ResetPassword(ctx, token, "n3w-Secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ResetPassword(ctx, token, "another"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("expected the token to work once, got %v", err)
+	}
+	if len(users.remember) != 0 {
+		t.Error("expected the remember-me tokens to be deleted")
+	}
+
+	// the session of the old password has ended
+	if resp, _ := get(t, c, server.URL+"/dashboard"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("expected the old session to be logged out, got %d", resp.StatusCode)
+	}
+	if resp := login(t, client(t), server, "ada@example.com", "n3w-Secret", false); resp.Header.Get("Location") != "/" {
+		t.Errorf("expected to log in with the new password, got %s", resp.Header.Get("Location"))
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	a, users, server := testApp(t)
+	c := client(t)
+	login(t, c, server, "ada@example.com", "secret", false)
+
+	if resp, _ := get(t, c, server.URL+"/settings"); resp.Header.Get("Location") != "/verify-email" {
+		t.Fatalf("expected unverified users to be sent to the notice, got %d", resp.StatusCode)
+	}
+
+	ctx := context.Background()
+	if err := a.VerifyEmail(ctx, "1", "ada@example.com", EmailStamp("other@example.com")); !errors.Is(err, ErrVerificationMismatch) {
+		t.Errorf("expected ErrVerificationMismatch, got %v", err)
+	}
+	if err := a.VerifyEmail(ctx, "1", "ada@example.com", EmailStamp("ada@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := get(t, c, server.URL+"/settings"); body != "settings" {
+		t.Errorf("expected verified users to pass, got %q", body)
+	}
+
+	// changing to the address of another user fails, a free one is taken over
+	if err := a.CheckEmailChange(ctx, "1", "bob@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken, got %v", err)
+	}
+	if err := a.VerifyEmail(ctx, "1", "ada@example.org", EmailStamp("ada@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if users.users["1"].Email != "ada@example.org" {
+		t.Errorf("expected the email to change, got %s", users.users["1"].Email)
+	}
+	if err := a.VerifyEmail(ctx, "1", "ada@example.org", EmailStamp("ada@example.com")); !errors.Is(err, ErrVerificationMismatch) {
+		t.Errorf("expected links for the old address to stop working, got %v", err)
+	}
+}
+
+// prefixEncrypter marks secrets as encrypted
+type prefixEncrypter struct{}
+
+func (prefixEncrypter) Encrypt(text string) (string, error) { return "sealed:" + text, nil }
+
+func (prefixEncrypter) Decrypt(ciphertext string) (string, error) {
+	return strings.TrimPrefix(ciphertext, "sealed:"), nil
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	a, users, server := testApp(t)
+	// a wider window, so the codes of the test stay valid across a period boundary
+	a.TOTP = twofactor.New(twofactor.Options{Skew: 2}, NewMemoryStore())
+	a.Encrypter = prefixEncrypter{}
+
+	// a device remembered before two-factor authentication is enabled
+	remembered := client(t)
+	login(t, remembered, server, "ada@example.com", "secret", true)
+	serverURL, _ := url.Parse(server.URL)
+	cookies := remembered.Jar.Cookies(serverURL)
+
+	ctx := context.Background()
+	secret, err := a.SetupTwoFactor(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.twoFactor["1"].Secret != "sealed:"+secret {
+		t.Error("expected the secret to be stored encrypted")
+	}
+	if _, err := a.ConfirmTwoFactor(ctx, "1", "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+	previous, _ := a.TOTP.Code(secret, time.Now().Add(-30*time.Second))
+	recovery, err := a.ConfirmTwoFactor(ctx, "1", previous)
+	if err != nil || len(recovery) != recoveryCodeCount {
+		t.Fatalf("confirm = %v, %v", recovery, err)
+	}
+	if _, err := a.SetupTwoFactor(ctx, "1"); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("expected ErrTwoFactorEnabled, got %v", err)
+	}
+	for _, cookie := range cookies {
+		if cookie.Name == a.Config().RememberCookie {
+			fresh := client(t)
+			fresh.Jar.SetCookies(serverURL, []*http.Cookie{{Name: cookie.Name, Value: cookie.Value}})
+			if resp, _ := get(t, fresh, server.URL+"/dashboard"); resp.StatusCode != http.StatusSeeOther {
+				t.Errorf("expected remember-me tokens issued before to be rejected, got %d", resp.StatusCode)
+			}
+		}
+	}
+	if len(users.remember) != 0 {
+		t.Error("expected the remember-me tokens to be deleted")
+	}
+
+	challenge := func(c *http.Client, field, code string) int {
+		resp, err := c.PostForm(server.URL+"/two-factor-challenge", url.Values{field: {code}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the password alone leaves the login pending
+	c := client(t)
+	if resp := login(t, c, server, "ada@example.com", "secret", false); resp.Header.Get("Location") != "/two-factor-challenge" {
+		t.Fatalf("expected the challenge, got %s", resp.Header.Get("Location"))
+	}
+	if resp, _ := get(t, c, server.URL+"/dashboard"); resp.Header.Get("Location") != "/two-factor-challenge" {
+		t.Fatalf("expected pending logins to be sent to the challenge, got %d", resp.StatusCode)
+	}
+	if status := challenge(c, "code", "000000"); status != http.StatusUnprocessableEntity {
+		t.Errorf("expected a wrong code to fail, got %d", status)
+	}
+	current, _ := a.TOTP.Code(secret, time.Now())
+	if status := challenge(c, "code", current); status != http.StatusOK {
+		t.Fatalf("expected the code to complete the login, got %d", status)
+	}
+	if _, body := get(t, c, server.URL+"/dashboard"); body != "hello 1" {
+		t.Errorf("expected the dashboard, got %q", body)
+	}
+
+	// codes and recovery codes work once
+	other := client(t)
+	login(t, other, server, "ada@example.com", "secret", false)
+	if status := challenge(other, "code", current); status != http.StatusUnprocessableEntity {
+		t.Errorf("expected a replayed code to fail, got %d", status)
+	}
+	if status := challenge(other, "recovery_code", recovery[0]); status != http.StatusOK {
+		t.Errorf("expected the recovery code to complete the login, got %d", status)
+	}
+	third := client(t)
+	login(t, third, server, "ada@example.com", "secret", false)
+	if status := challenge(third, "recovery_code", recovery[0]); status != http.StatusUnprocessableEntity {
+		t.Errorf("expected a used recovery code to fail, got %d", status)
+	}
+	if status := challenge(client(t), "code", current); status != http.StatusUnprocessableEntity {
+		t.Errorf("expected requests without a pending login to fail, got %d", status)
+	}
+}
+
+func TestRecoveryCodesWorkOnceUnderConcurrency(t *testing.T) {
+	a, users, _ := testApp(t)
+	codes, _ := twofactor.GenerateRecoveryCodes(2)
+	state := TwoFactor{Secret: "secret", Confirmed: true, RecoveryCodes: twofactor.HashRecoveryCodes(codes)}
+	_ = users.SaveTwoFactor(context.Background(), "1", state)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every request read the state before any of them saved it
+			if ok, err := a.checkSecondFactor(context.Background(), "1", state, "", codes[0]); ok && err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("the recovery code was accepted %d times, want once", accepted)
+	}
+	if remaining := users.twoFactor["1"].RecoveryCodes; len(remaining) != 1 {
+		t.Errorf("expected one recovery code left, got %d", len(remaining))
+	}
+}
+
+func TestRequireAPI(t *testing.T) {
+	_, _, server := testApp(t)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api", nil)
+	req.Header.Set("Authorization", "Bearer api-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the token to authenticate, got %d", resp.StatusCode)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("expected 401 with WWW-Authenticate, got %d", resp.StatusCode)
+	}
+}
+
+// countingUsers counts the user lookups by id
+type countingUsers struct {
+	*memoryUsers
+	lookups int
+}
+
+func (c *countingUsers) UserByID(ctx context.Context, id string) (User, error) {
+	c.lookups++
+	return c.memoryUsers.UserByID(ctx, id)
+}
+
+func TestUserChecksTheSessionOncePerRequest(t *testing.T) {
+	hasher := hashing.New(hashing.Options{Driver: hashing.Bcrypt, BcryptCost: 4})
+	users := &countingUsers{memoryUsers: newMemoryUsers(t, hasher)}
+	a := New(scs.New(), users, hasher, Config{})
+
+	var got []User
+	handler := a.Sessions.LoadAndSave(CacheUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ada, _ := users.UserByID(r.Context(), "1")
+		if err := a.Login(w, r, ada, false); err != nil {
+			t.Fatal(err)
+		}
+		users.lookups = 0
+		for i := 0; i < 3; i++ {
+			user, _ := a.User(r)
+			got = append(got, user)
+		}
+
+		// a password change ends the session, as it does for the guards
+		_ = users.UpdatePassword(r.Context(), ada, "new hash")
+		forgetCachedUser(r.Context())
+		if user, err := a.User(r); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("expected a guest after the password change, got %v %v", user, err)
+		}
+	})))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(got) != 3 || got[0] == nil || got[2] != got[0] {
+		t.Fatalf("unexpected users %v", got)
+	}
+	if users.lookups != 2 {
+		t.Errorf("the user was loaded %d times, want once per resolution", users.lookups)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "select id from users where email = ? and id = ?"
+	if got := newSQLDB(nil, "postgres").rebind(query); got != "select id from users where email = $1 and id = $2" {
+		t.Errorf("unexpected postgres query %s", got)
+	}
+	if got := newSQLDB(nil, "mysql").rebind(query); got != query {
+		t.Errorf("unexpected mysql query %s", got)
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// intendedKey is the session key of the page a guest was sent to the login from
+const intendedKey = "auth.intended"
+
+// resolve finds the user of a web request: the session user, or the user of a
+// remember-me cookie, who is then logged in
+func (a *Auth) resolve(w http.ResponseWriter, r *http.Request) (User, error) {
+	user, err := a.User(r)
+	if err == nil || !errors.Is(err, ErrUnauthenticated) {
+		return user, err
+	}
+	return a.viaRemember(w, r)
+}
+
+// sessionUser loads the user of the session, who must be active and logged in with the
+// current password; other sessions are logged out
+func (a *Auth) sessionUser(r *http.Request) (User, error) {
+	id := sessionID(a.Sessions.Get(r.Context(), a.config.SessionKey))
+	if id == "" || a.Users == nil {
+		return nil, ErrUnauthenticated
+	}
+	user, err := a.Users.UserByID(r.Context(), id)
+	if err == nil && a.sessionValid(r, user) {
+		return user, nil
+	} else if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+	// the user was deleted, deactivated or changed the password since logging in
+	a.Sessions.Remove(r.Context(), a.config.SessionKey)
+	a.Sessions.Remove(r.Context(), passwordKey)
+	return nil, ErrUnauthenticated
+}
+
+// sessionValid reports whether the session user is active and logged in with the
+// current password; sessions older than the password stamp adopt it
+func (a *Auth) sessionValid(r *http.Request, user User) bool {
+	if active, ok := user.(ActiveUser); ok && !active.AuthActive() {
+		return false
+	}
+	stamp := a.Sessions.GetString(r.Context(), passwordKey)
+	if stamp == "" {
+		a.Sessions.Put(r.Context(), passwordKey, passwordStamp(user))
+		return true
+	}
+	return stamp == passwordStamp(user)
+}
+
+// Authenticate middleware places the user of the session or remember-me cookie in the
+// request context, see FromContext; guests pass through
+func (a *Auth) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, err := a.resolve(w, r); err == nil {
+			r = r.WithContext(NewContext(r.Context(), user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireWeb middleware guards pages: guests are redirected to LoginPath, and sent back
+// to the page they asked for after logging in. Logins waiting for the second factor are
+// redirected to TwoFactorPath.
+func (a *Auth) RequireWeb(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.resolve(w, r)
+		if err != nil {
+			if r.Method == http.MethodGet {
+				a.Sessions.Put(r.Context(), intendedKey, r.URL.RequestURI())
+			}
+			target := a.config.LoginPath
+			if _, pending := a.PendingTwoFactor(r); pending {
+				target = a.config.TwoFactorPath
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), user)))
+	})
+}
+
+// Guest middleware redirects logged-in users to HomePath, e.g. on the login page
+func (a *Auth) Guest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := a.resolve(w, r); err == nil {
+			http.Redirect(w, r, a.config.HomePath, http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAPI middleware guards APIs by the bearer token of the request, found through
+// Tokens. Other requests are answered by Unauthorized, or with a plain 401; the
+// WWW-Authenticate header is set either way.
+func (a *Auth) RequireAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.apiUser(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			if a.config.Unauthorized != nil {
+				a.config.Unauthorized(w, r, err)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), user)))
+	})
+}
+
+// apiUser finds the user of the bearer token of the request
+func (a *Auth) apiUser(r *http.Request) (User, error) {
+	if a.Tokens == nil {
+		return nil, errors.New("auth: no token provider configured")
+	}
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrUnauthenticated
+	}
+	user, err := a.Tokens.UserByToken(r.Context(), token)
+	if errors.Is(err, ErrTokenNotFound) || errors.Is(err, ErrUserNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if active, ok := user.(ActiveUser); ok && !active.AuthActive() {
+		return nil, ErrInactive
+	}
+	return user, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginHandler logs users in from a posted form with the IdentifierField,
+// PasswordField and RememberField fields. Successful logins are redirected to the page
+// RequireWeb sent them from, or HomePath, and logins waiting for the second factor to
+// TwoFactorPath; failures are answered by LoginFailed.
+func (a *Auth) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.loginFailed(w, r, ErrInvalidCredentials)
+		return
+	}
+	remember, _ := strconv.ParseBool(r.PostForm.Get(a.config.RememberField))
+	if r.PostForm.Get(a.config.RememberField) == "on" {
+		remember = true
+	}
+
+	_, err := a.Attempt(w, r, r.PostForm.Get(a.config.IdentifierField), r.PostForm.Get(a.config.PasswordField), remember)
+	if errors.Is(err, ErrTwoFactorRequired) {
+		http.Redirect(w, r, a.config.TwoFactorPath, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		a.loginFailed(w, r, err)
+		return
+	}
+	http.Redirect(w, r, a.Intended(r), http.StatusSeeOther)
+}
+
+// Intended pops the page RequireWeb redirected from, HomePath when there is none
+func (a *Auth) Intended(r *http.Request) string {
+	target := a.Sessions.PopString(r.Context(), intendedKey)
+	// only local paths, so the session can not redirect elsewhere
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return a.config.HomePath
+	}
+	return target
+}
+
+// loginFailed answers a failed login with LoginFailed, or flashes the error and sends
+// the client back to the login page
+func (a *Auth) loginFailed(w http.ResponseWriter, r *http.Request, err error) {
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	if a.config.LoginFailed != nil {
+		a.config.LoginFailed(w, r, err)
+		return
+	}
+	a.Sessions.Put(r.Context(), "error", LoginMessage(err))
+	http.Redirect(w, r, a.config.LoginPath, http.StatusSeeOther)
+}
+
+// LoginMessage returns a message for users about a failed login
+func LoginMessage(err error) string {
+	var lockout *LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		minutes := int(lockout.RetryAfter.Round(time.Minute) / time.Minute)
+		if minutes <= 1 {
+			return "Too many login attempts. Please try again in a minute."
+		}
+		return fmt.Sprintf("Too many login attempts. Please try again in %d minutes.", minutes)
+	case errors.Is(err, ErrInactive):
+		return "This account is not active."
+	case errors.Is(err, ErrInvalidCredentials):
+		return "These credentials do not match our records."
+	case errors.Is(err, ErrTwoFactorRequired):
+		return "Enter the code of your authenticator app to finish logging in."
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		return "The authentication code is invalid."
+	default:
+		return "The login failed, please try again."
+	}
+}
+
+// LogoutHandler logs the user out and redirects to LogoutPath; use it on a POST route
+// protected against cross-site requests
+func (a *Auth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.Logout(w, r); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, a.config.LogoutPath, http.StatusSeeOther)
+}
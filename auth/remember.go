@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrTokenNotFound is returned by token stores for unknown or expired tokens
+var ErrTokenNotFound = errors.New("auth: token not found")
+
+// RememberTokenStore keeps remember-me tokens. Only the sha256 hex of a token is
+// stored, the token itself lives in the cookie.
+type RememberTokenStore interface {
+	CreateRememberToken(ctx context.Context, userID, tokenHash string) error
+	// RememberTokenUser returns the user id of a token created after issuedAfter, or
+	// ErrTokenNotFound
+	RememberTokenUser(ctx context.Context, tokenHash string, issuedAfter time.Time) (string, error)
+	DeleteRememberToken(ctx context.Context, tokenHash string) error
+	// DeleteUserRememberTokens logs the user out of every remembered device
+	DeleteUserRememberTokens(ctx context.Context, userID string) error
+}
+
+// TokenProvider finds the user of an API bearer token, returning ErrTokenNotFound for
+// unknown or expired tokens
+type TokenProvider interface {
+	UserByToken(ctx context.Context, token string) (User, error)
+}
+
+// remember issues a remember-me token and sets its cookie
+func (a *Auth) remember(ctx context.Context, w http.ResponseWriter, userID string) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	if err := a.Remember.CreateRememberToken(ctx, userID, hashToken(token)); err != nil {
+		return err
+	}
+	http.SetCookie(w, a.rememberCookie(token, int(a.config.RememberTTL/time.Second)))
+	return nil
+}
+
+// viaRemember logs in the user of a valid remember-me cookie. The token is used once:
+// it is replaced by a new one, so a stolen cookie stops working after the next visit
+// of its owner. Invalid cookies are removed.
+func (a *Auth) viaRemember(w http.ResponseWriter, r *http.Request) (User, error) {
+	if a.Remember == nil || a.Users == nil {
+		return nil, ErrUnauthenticated
+	}
+	cookie, err := r.Cookie(a.config.RememberCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	ctx := r.Context()
+	hash := hashToken(cookie.Value)
+	id, err := a.Remember.RememberTokenUser(ctx, hash, time.Now().Add(-a.config.RememberTTL))
+	if err == nil {
+		err = a.Remember.DeleteRememberToken(ctx, hash)
+	}
+	if errors.Is(err, ErrTokenNotFound) {
+		http.SetCookie(w, a.rememberCookie("", -1))
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.Users.UserByID(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		http.SetCookie(w, a.rememberCookie("", -1))
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if active, ok := user.(ActiveUser); ok && !active.AuthActive() {
+		http.SetCookie(w, a.rememberCookie("", -1))
+		return nil, ErrInactive
+	}
+	if err := a.Login(w, r, user, true); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// forgetCookie deletes the remember-me token of the request and expires its cookie
+func (a *Auth) forgetCookie(w http.ResponseWriter, r *http.Request) error {
+	cookie, err := r.Cookie(a.config.RememberCookie)
+	if err != nil {
+		return nil
+	}
+	http.SetCookie(w, a.rememberCookie("", -1))
+	if a.Remember == nil || cookie.Value == "" {
+		return nil
+	}
+	err = a.Remember.DeleteRememberToken(r.Context(), hashToken(cookie.Value))
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ForgetUser deletes every remember-me token of the user, e.g. after a password change
+func (a *Auth) ForgetUser(ctx context.Context, userID string) error {
+	if a.Remember == nil {
+		return nil
+	}
+	return a.Remember.DeleteUserRememberTokens(ctx, userID)
+}
+
+// rememberCookie builds the remember-me cookie; a negative maxAge deletes it
+func (a *Auth) rememberCookie(token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     a.config.RememberCookie,
+		Value:    token,
+		Path:     "/",
+		Domain:   a.config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   a.config.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the sha256 hex of a token, as it is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInvalidResetToken is returned for unknown, used or expired password reset tokens
+var ErrInvalidResetToken = errors.New("auth: invalid or expired password reset token")
+
+// ResetTokenStore keeps password reset tokens. Only the sha256 hex of a token is
+// stored, the token itself is sent to the user.
+type ResetTokenStore interface {
+	// CreateResetToken stores a token until expires, replacing the earlier tokens of
+	// the user
+	CreateResetToken(ctx context.Context, userID, tokenHash string, expires time.Time) error
+	// ConsumeResetToken deletes an unexpired token and returns its user id, or
+	// ErrTokenNotFound; of concurrent calls with the same token only one succeeds
+	ConsumeResetToken(ctx context.Context, tokenHash string) (string, error)
+}
+
+// CreateResetToken issues a password reset token for the user of the identifier,
+// valid for ResetTTL. It returns ErrUserNotFound for unknown identifiers and
+// ErrInactive for inactive users; callers should answer both like a success, so the
+// response does not reveal whether an account exists.
+func (a *Auth) CreateResetToken(ctx context.Context, identifier string) (User, string, error) {
+	if a.Resets == nil || a.Users == nil {
+		return nil, "", errors.New("auth: password resets need a reset token store and a user provider")
+	}
+	user, err := a.Users.UserByIdentifier(ctx, identifier)
+	if err != nil {
+		return nil, "", err
+	}
+	if active, ok := user.(ActiveUser); ok && !active.AuthActive() {
+		return nil, "", ErrInactive
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := a.Resets.CreateResetToken(ctx, user.AuthID(), hashToken(token), time.Now().Add(a.config.ResetTTL)); err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// ResetPassword sets a new password for the user of a reset token, which is used up.
+// Every session of the user ends, as sessions are bound to the password hash, and
+// the remember-me tokens of the user are deleted. The new password must be validated
+// by the caller.
+func (a *Auth) ResetPassword(ctx context.Context, token, password string) (User, error) {
+	if a.Resets == nil || a.Users == nil || a.Hasher == nil {
+		return nil, errors.New("auth: password resets need a reset token store, a user provider and a hasher")
+	}
+	updater, ok := a.Users.(PasswordUpdater)
+	if !ok {
+		return nil, errors.New("auth: the user provider can not update passwords")
+	}
+
+	id, err := a.Resets.ConsumeResetToken(ctx, hashToken(token))
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.Users.UserByID(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := a.Hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+	if err := updater.UpdatePassword(ctx, user, hash); err != nil {
+		return nil, err
+	}
+	if err := a.ForgetUser(ctx, id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
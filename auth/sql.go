@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLUser is a row of the users table created by `gudu make auth`
+type SQLUser struct {
+	ID        string
+	FirstName string
+	LastName  string
+	Email     string
+	Password  string
+	Active    bool
+}
+
+func (u *SQLUser) AuthID() string       { return u.ID }
+func (u *SQLUser) AuthPassword() string { return u.Password }
+func (u *SQLUser) AuthActive() bool     { return u.Active }
+
+// sqlDB runs queries written with ? placeholders on postgres, mysql and mariadb
+type sqlDB struct {
+	db       *sql.DB
+	postgres bool
+}
+
+func newSQLDB(db *sql.DB, databaseType string) sqlDB {
+	switch strings.ToLower(databaseType) {
+	case "postgres", "postgresql", "pgx":
+		return sqlDB{db: db, postgres: true}
+	}
+	return sqlDB{db: db}
+}
+
+// rebind rewrites ? placeholders to $1, $2... for postgres
+func (s sqlDB) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// sqlID passes numeric ids as integers, the users table has a serial key
+func sqlID(id string) interface{} {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
+
+// SQLUsers is a UserProvider over the users table, logging in by email address. It is
+// an EmailVerifier too, over the email_verified_at column of `gudu make verification`,
+// and a TwoFactorStore over the two_factor_ columns of `gudu make two-factor`.
+type SQLUsers struct {
+	sqlDB
+}
+
+// NewSQLUsers creates a SQLUsers for the database type of DATABASE_TYPE
+func NewSQLUsers(db *sql.DB, databaseType string) *SQLUsers {
+	return &SQLUsers{newSQLDB(db, databaseType)}
+}
+
+const selectUser = "select id, first_name, last_name, email, password, user_active from users where "
+
+// UserByID finds a user by id
+func (s *SQLUsers) UserByID(ctx context.Context, id string) (User, error) {
+	return s.find(ctx, selectUser+"id = ?", sqlID(id))
+}
+
+// UserByIdentifier finds a user by email address
+func (s *SQLUsers) UserByIdentifier(ctx context.Context, identifier string) (User, error) {
+	return s.find(ctx, selectUser+"email = ?", strings.TrimSpace(identifier))
+}
+
+func (s *SQLUsers) find(ctx context.Context, query string, arg interface{}) (User, error) {
+	var user SQLUser
+	var active int
+	err := s.db.QueryRowContext(ctx, s.rebind(query), arg).
+		Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Active = active == 1
+	return &user, nil
+}
+
+// UpdatePassword stores a new password hash
+func (s *SQLUsers) UpdatePassword(ctx context.Context, user User, hash string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind("update users set password = ?, updated_at = ? where id = ?"),
+		hash, time.Now(), sqlID(user.AuthID()))
+	return err
+}
+
+// EmailVerified returns the email address of the user and whether email_verified_at
+// is set
+func (s *SQLUsers) EmailVerified(ctx context.Context, userID string) (string, bool, error) {
+	var email string
+	var verifiedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, s.rebind("select email, email_verified_at from users where id = ?"), sqlID(userID)).
+		Scan(&email, &verifiedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, ErrUserNotFound
+	}
+	return email, verifiedAt.Valid, err
+}
+
+// MarkEmailVerified sets the email address and its email_verified_at
+func (s *SQLUsers) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx,
+		s.rebind("update users set email = ?, email_verified_at = ?, updated_at = ? where id = ?"),
+		email, now, now, sqlID(userID))
+	return err
+}
+
+// TwoFactor returns the two-factor state of the user; recovery code hashes are stored
+// comma separated
+func (s *SQLUsers) TwoFactor(ctx context.Context, userID string) (TwoFactor, error) {
+	var secret, codes sql.NullString
+	var confirmedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		s.rebind("select two_factor_secret, two_factor_recovery_codes, two_factor_confirmed_at from users where id = ?"),
+		sqlID(userID)).Scan(&secret, &codes, &confirmedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TwoFactor{}, ErrUserNotFound
+	}
+	if err != nil {
+		return TwoFactor{}, err
+	}
+	state := TwoFactor{Secret: secret.String, Confirmed: confirmedAt.Valid}
+	if codes.String != "" {
+		state.RecoveryCodes = strings.Split(codes.String, ",")
+	}
+	return state, nil
+}
+
+// SaveTwoFactor stores the two-factor state of the user; two_factor_confirmed_at keeps
+// the time of the first confirmation
+func (s *SQLUsers) SaveTwoFactor(ctx context.Context, userID string, state TwoFactor) error {
+	var secret, codes interface{}
+	if state.Secret != "" {
+		secret = state.Secret
+	}
+	if len(state.RecoveryCodes) > 0 {
+		codes = strings.Join(state.RecoveryCodes, ",")
+	}
+	now := time.Now()
+	args := []interface{}{secret, codes}
+	confirmed := "null"
+	if state.Confirmed {
+		confirmed = "coalesce(two_factor_confirmed_at, ?)"
+		args = append(args, now)
+	}
+	args = append(args, now, sqlID(userID))
+	_, err := s.db.ExecContext(ctx, s.rebind("update users set two_factor_secret = ?, two_factor_recovery_codes = ?, "+
+		"two_factor_confirmed_at = "+confirmed+", updated_at = ? where id = ?"), args...)
+	return err
+}
+
+// SQLRememberTokens is a RememberTokenStore over the remember_tokens table
+type SQLRememberTokens struct {
+	sqlDB
+}
+
+// NewSQLRememberTokens creates a SQLRememberTokens for the database type
+func NewSQLRememberTokens(db *sql.DB, databaseType string) *SQLRememberTokens {
+	return &SQLRememberTokens{newSQLDB(db, databaseType)}
+}
+
+// CreateRememberToken stores the hash of a new token
+func (s *SQLRememberTokens) CreateRememberToken(ctx context.Context, userID, tokenHash string) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx,
+		s.rebind("insert into remember_tokens (user_id, remember_token, created_at, updated_at) values (?, ?, ?, ?)"),
+		sqlID(userID), tokenHash, now, now)
+	return err
+}
+
+// RememberTokenUser returns the user id of a token created after issuedAfter
+func (s *SQLRememberTokens) RememberTokenUser(ctx context.Context, tokenHash string, issuedAfter time.Time) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		s.rebind("select user_id from remember_tokens where remember_token = ? and created_at > ?"),
+		tokenHash, issuedAfter).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTokenNotFound
+	}
+	return userID, err
+}
+
+// DeleteRememberToken deletes a token
+func (s *SQLRememberTokens) DeleteRememberToken(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind("delete from remember_tokens where remember_token = ?"), tokenHash)
+	return err
+}
+
+// DeleteUserRememberTokens deletes every token of the user
+func (s *SQLRememberTokens) DeleteUserRememberTokens(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind("delete from remember_tokens where user_id = ?"), sqlID(userID))
+	return err
+}
+
+// SQLTokens is a TokenProvider over the tokens table, which stores the sha256 of the
+// API tokens issued by the token model of `gudu make auth`
+type SQLTokens struct {
+	sqlDB
+	users UserProvider
+}
+
+// NewSQLTokens creates a SQLTokens loading the users of tokens from users
+func NewSQLTokens(db *sql.DB, databaseType string, users UserProvider) *SQLTokens {
+	return &SQLTokens{sqlDB: newSQLDB(db, databaseType), users: users}
+}
+
+// UserByToken finds the user of an unexpired token
+func (s *SQLTokens) UserByToken(ctx context.Context, token string) (User, error) {
+	hash := sha256.Sum256([]byte(token))
+	var userID string
+	err := s.db.QueryRowContext(ctx, s.rebind("select user_id from tokens where token_hash = ? and expiry > ?"),
+		hash[:], time.Now()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.users.UserByID(ctx, userID)
+}
+
+// SQLResetTokens is a ResetTokenStore over the password_resets table
+type SQLResetTokens struct {
+	sqlDB
+}
+
+// NewSQLResetTokens creates a SQLResetTokens for the database type
+func NewSQLResetTokens(db *sql.DB, databaseType string) *SQLResetTokens {
+	return &SQLResetTokens{newSQLDB(db, databaseType)}
+}
+
+// CreateResetToken stores the hash of a new token, deleting the earlier ones of the user
+func (s *SQLResetTokens) CreateResetToken(ctx context.Context, userID, tokenHash string, expires time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, s.rebind("delete from password_resets where user_id = ?"), sqlID(userID)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		s.rebind("insert into password_resets (user_id, token_hash, expires_at, created_at) values (?, ?, ?, ?)"),
+		sqlID(userID), tokenHash, expires, time.Now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsumeResetToken deletes an unexpired token and returns its user id
+func (s *SQLResetTokens) ConsumeResetToken(ctx context.Context, tokenHash string) (string, error) {
+	now := time.Now()
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		s.rebind("select user_id from password_resets where token_hash = ? and expires_at > ?"),
+		tokenHash, now).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// only the request that deletes the row may use the token
+	result, err := s.db.ExecContext(ctx,
+		s.rebind("delete from password_resets where token_hash = ? and expires_at > ?"), tokenHash, now)
+	if err != nil {
+		return "", err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return "", err
+	} else if deleted != 1 {
+		return "", ErrTokenNotFound
+	}
+	return userID, nil
+}
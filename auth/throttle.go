@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps the counters of failed logins and the used two-factor codes. It is
+// satisfied by the gudu cache.Cache drivers, so every instance of an application
+// shares them; Get returns nil for missing keys.
+type Store interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}, expires ...time.Duration) error
+	Delete(key string) error
+	// Increment atomically adds one to a counter, which expires after the optional
+	// duration when it is created, and returns the new count
+	Increment(key string, expires ...time.Duration) (int64, error)
+	// SetIfAbsent atomically stores the value unless the key exists, reporting whether
+	// it stored it
+	SetIfAbsent(key string, value interface{}, expires ...time.Duration) (bool, error)
+}
+
+// Throttle counts failed attempts per key and locks a key out once it reaches the
+// maximum
+type Throttle struct {
+	store       Store
+	maxAttempts int
+	lockout     time.Duration
+}
+
+// NewThrottle creates a Throttle locking keys out for lockout after maxAttempts
+// failures within lockout
+func NewThrottle(store Store, maxAttempts int, lockout time.Duration) *Throttle {
+	return &Throttle{store: store, maxAttempts: maxAttempts, lockout: lockout}
+}
+
+// Locked returns the remaining lockout of the key, zero when it is not locked
+func (t *Throttle) Locked(key string) (time.Duration, error) {
+	value, err := t.store.Get(lockoutKey(key))
+	if err != nil || value == nil {
+		return 0, err
+	}
+	stored, _ := value.(string)
+	until, _ := strconv.ParseInt(stored, 10, 64)
+	return max(time.Until(time.Unix(until, 0)), 0), nil
+}
+
+// WithMax returns a Throttle sharing the counters and lockout of t, locking keys out
+// after maxAttempts failures
+func (t *Throttle) WithMax(maxAttempts int) *Throttle {
+	return &Throttle{store: t.store, maxAttempts: maxAttempts, lockout: t.lockout}
+}
+
+// Hit counts a failed attempt, returning the lockout when it was the last one allowed.
+// The count is incremented atomically, so concurrent attempts can not exceed the
+// maximum.
+func (t *Throttle) Hit(key string) (time.Duration, error) {
+	attempts, err := t.store.Increment(attemptsKey(key), t.lockout)
+	if err != nil {
+		return 0, err
+	}
+	if attempts < int64(t.maxAttempts) {
+		return 0, nil
+	}
+	if err := t.store.Delete(attemptsKey(key)); err != nil {
+		return 0, err
+	}
+	until := time.Now().Add(t.lockout)
+	return t.lockout, t.store.Set(lockoutKey(key), strconv.FormatInt(until.Unix(), 10), t.lockout)
+}
+
+// Clear resets the failed attempts of the key
+func (t *Throttle) Clear(key string) error {
+	return t.store.Delete(attemptsKey(key))
+}
+
+// throttleKey is the key of a login: the identifier and the client address, so one
+// client can not lock a user out everywhere
+func throttleKey(identifier string, r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(identifier)) + "|" + host))
+	return hex.EncodeToString(sum[:16])
+}
+
+// identifierKey is the key of every login of the identifier, whatever the client
+// address, which may come from spoofable proxy headers
+func identifierKey(identifier string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(identifier))))
+	return "id:" + hex.EncodeToString(sum[:16])
+}
+
+// attemptsKey and lockoutKey are the store keys of the throttle state
+func attemptsKey(key string) string {
+	return "auth:attempts:" + key
+}
+
+func lockoutKey(key string) string {
+	return "auth:lockout:" + key
+}
+
+// MemoryStore is a Store for a single process and tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// memoryEntry is a value with its expiry, zero for none
+type memoryEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get returns the value, nil when missing or expired
+func (s *MemoryStore) Get(key string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+	return entry.value, nil
+}
+
+// Set stores the value, expiring after the optional duration
+func (s *MemoryStore) Set(key string, value interface{}, expires ...time.Duration) error {
+	entry := memoryEntry{value: value}
+	if len(expires) > 0 && expires[0] > 0 {
+		entry.expires = time.Now().Add(expires[0])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+// Increment adds one to the counter, starting a missing or expired one at 1
+func (s *MemoryStore) Increment(key string, expires ...time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		entry = memoryEntry{value: int64(0)}
+		if len(expires) > 0 && expires[0] > 0 {
+			entry.expires = time.Now().Add(expires[0])
+		}
+	}
+	count, _ := entry.value.(int64)
+	entry.value = count + 1
+	s.entries[key] = entry
+	return count + 1, nil
+}
+
+// SetIfAbsent stores the value unless the key exists and has not expired
+func (s *MemoryStore) SetIfAbsent(key string, value interface{}, expires ...time.Duration) (bool, error) {
+	entry := memoryEntry{value: value}
+	if len(expires) > 0 && expires[0] > 0 {
+		entry.expires = time.Now().Add(expires[0])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.entries[key]; ok && (existing.expires.IsZero() || time.Now().Before(existing.expires)) {
+		return false, nil
+	}
+	s.entries[key] = entry
+	return true, nil
+}
+
+// Delete removes the value
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
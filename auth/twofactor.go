@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deenikarim/gudu/twofactor"
+)
+
+var (
+	// ErrTwoFactorRequired is returned by Attempt and LoginOrChallenge for users with
+	// two-factor authentication: the login is pending until ChallengeTwoFactor
+	ErrTwoFactorRequired = errors.New("auth: two-factor authentication required")
+	// ErrInvalidTwoFactorCode is returned for wrong, used and expired codes
+	ErrInvalidTwoFactorCode = errors.New("auth: invalid two-factor code")
+	// ErrTwoFactorEnabled is returned when setting up two-factor authentication twice
+	ErrTwoFactorEnabled = errors.New("auth: two-factor authentication is already enabled")
+	// ErrTwoFactorDisabled is returned when two-factor authentication is not set up
+	ErrTwoFactorDisabled = errors.New("auth: two-factor authentication is not enabled")
+)
+
+// recoveryCodeCount is the number of recovery codes a user gets
+const recoveryCodeCount = 8
+
+// session keys of a login waiting for the second factor
+const (
+	twoFactorUserKey     = "auth.2fa.user"
+	twoFactorRememberKey = "auth.2fa.remember"
+	twoFactorExpiresKey  = "auth.2fa.expires"
+)
+
+// TwoFactor is the two-factor authentication state of a user
+type TwoFactor struct {
+	// Secret is the TOTP secret as stored, encrypted when Auth.Encrypter is set
+	Secret string
+	// Confirmed is set once the user entered a code of the secret; logins ask for
+	// codes from then on
+	Confirmed bool
+	// RecoveryCodes are the hashes of the unused recovery codes
+	RecoveryCodes []string
+}
+
+// Enabled reports whether logins need a second factor
+func (t TwoFactor) Enabled() bool {
+	return t.Secret != "" && t.Confirmed
+}
+
+// TwoFactorStore keeps the two-factor state of users
+type TwoFactorStore interface {
+	// TwoFactor returns the state of the user, the zero TwoFactor when it was never
+	// set up
+	TwoFactor(ctx context.Context, userID string) (TwoFactor, error)
+	SaveTwoFactor(ctx context.Context, userID string, state TwoFactor) error
+}
+
+// Encrypter encrypts the TOTP secrets at rest, it is satisfied by *gudu.Encryption
+type Encrypter interface {
+	Encrypt(text string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+// LoginOrChallenge logs the user in like Login, unless the user enabled two-factor
+// authentication: the session token is renewed and the login is left pending for
+// ChallengeTwoFactor, returning ErrTwoFactorRequired. Guards treat pending users as
+// guests. Use it for every login that is not a second factor itself.
+func (a *Auth) LoginOrChallenge(w http.ResponseWriter, r *http.Request, user User, remember bool) error {
+	enabled, err := a.twoFactorEnabled(r.Context(), user.AuthID())
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return a.Login(w, r, user, remember)
+	}
+
+	ctx := r.Context()
+	if err := a.Sessions.RenewToken(ctx); err != nil {
+		return err
+	}
+	a.Sessions.Remove(ctx, a.config.SessionKey)
+	a.Sessions.Put(ctx, twoFactorUserKey, user.AuthID())
+	a.Sessions.Put(ctx, twoFactorRememberKey, remember)
+	a.Sessions.Put(ctx, twoFactorExpiresKey, time.Now().Add(a.config.TwoFactorTimeout).Unix())
+	return ErrTwoFactorRequired
+}
+
+// twoFactorEnabled reports whether the user has to pass a second factor
+func (a *Auth) twoFactorEnabled(ctx context.Context, userID string) (bool, error) {
+	if a.TwoFactor == nil {
+		return false, nil
+	}
+	state, err := a.TwoFactor.TwoFactor(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return state.Enabled(), nil
+}
+
+// PendingTwoFactor returns the id of the user whose login waits for the second factor
+// in the session of the request; expired logins are forgotten
+func (a *Auth) PendingTwoFactor(r *http.Request) (string, bool) {
+	ctx := r.Context()
+	id := a.Sessions.GetString(ctx, twoFactorUserKey)
+	if id == "" {
+		return "", false
+	}
+	if time.Now().Unix() > a.Sessions.GetInt64(ctx, twoFactorExpiresKey) {
+		a.clearTwoFactor(ctx)
+		return "", false
+	}
+	return id, true
+}
+
+// clearTwoFactor ends the pending login
+func (a *Auth) clearTwoFactor(ctx context.Context) {
+	a.Sessions.Remove(ctx, twoFactorUserKey)
+	a.Sessions.Remove(ctx, twoFactorRememberKey)
+	a.Sessions.Remove(ctx, twoFactorExpiresKey)
+}
+
+// ChallengeTwoFactor completes the pending login of the request with a code of the
+// authenticator app, or with one of the recovery codes when recoveryCode is set.
+// Requests without a pending login get ErrUnauthenticated. Wrong codes return
+// ErrInvalidTwoFactorCode and are throttled per user like passwords, so a *LockoutError
+// is returned once MaxAttempts is reached. Each code works once.
+func (a *Auth) ChallengeTwoFactor(w http.ResponseWriter, r *http.Request, code, recoveryCode string) (User, error) {
+	if a.TwoFactor == nil || a.Users == nil {
+		return nil, errors.New("auth: two-factor authentication needs a two-factor store and a user provider")
+	}
+	id, ok := a.PendingTwoFactor(r)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	key := "2fa:" + id
+	if wait, err := a.Throttle.Locked(key); err != nil {
+		return nil, err
+	} else if wait > 0 {
+		return nil, &LockoutError{RetryAfter: wait}
+	}
+
+	ctx := r.Context()
+	user, err := a.Users.UserByID(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		a.clearTwoFactor(ctx)
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, err := a.TwoFactor.TwoFactor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := a.checkSecondFactor(ctx, id, state, code, recoveryCode)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		wait, err := a.Throttle.Hit(key)
+		if err != nil {
+			return nil, err
+		}
+		if wait > 0 {
+			return nil, &LockoutError{RetryAfter: wait}
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if err := a.Throttle.Clear(key); err != nil {
+		return nil, err
+	}
+
+	remember, _ := a.Sessions.Get(ctx, twoFactorRememberKey).(bool)
+	a.clearTwoFactor(ctx)
+	if err := a.Login(w, r, user, remember); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkSecondFactor verifies the code, or the recovery code which is used up
+func (a *Auth) checkSecondFactor(ctx context.Context, userID string, state TwoFactor, code, recoveryCode string) (bool, error) {
+	switch {
+	case !state.Enabled():
+		// the password was checked, a second factor disabled since then is not asked for
+		return true, nil
+	case recoveryCode != "":
+		remaining, ok := twofactor.UseRecoveryCode(state.RecoveryCodes, recoveryCode)
+		if !ok {
+			return false, nil
+		}
+		// claim the code first, so concurrent logins with it can not both pass before
+		// the remaining codes are saved
+		claimKey := "twofactor:recovery:" + userID + ":" + twofactor.HashRecoveryCode(recoveryCode)
+		first, err := a.Throttle.store.SetIfAbsent(claimKey, "used", a.config.TwoFactorTimeout)
+		if err != nil || !first {
+			return false, err
+		}
+		state.RecoveryCodes = remaining
+		return true, a.TwoFactor.SaveTwoFactor(ctx, userID, state)
+	default:
+		return a.verifyTwoFactorCode(userID, state, code)
+	}
+}
+
+// verifyTwoFactorCode checks a code of the secret of the state
+func (a *Auth) verifyTwoFactorCode(userID string, state TwoFactor, code string) (bool, error) {
+	secret, err := a.openSecret(state.Secret)
+	if err != nil {
+		return false, err
+	}
+	return a.TOTP.Verify(userID, secret, code)
+}
+
+// SetupTwoFactor generates a new TOTP secret for the user and returns it for the QR
+// code of the authenticator app. Logins ask for codes once the user confirmed the
+// secret with ConfirmTwoFactor; users who did get ErrTwoFactorEnabled.
+func (a *Auth) SetupTwoFactor(ctx context.Context, userID string) (string, error) {
+	state, err := a.twoFactorState(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if state.Enabled() {
+		return "", ErrTwoFactorEnabled
+	}
+	secret, err := twofactor.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := a.sealSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return secret, a.TwoFactor.SaveTwoFactor(ctx, userID, TwoFactor{Secret: sealed})
+}
+
+// TwoFactorSecret returns the TOTP secret of the user, empty when there is none, and
+// whether it was confirmed, e.g. to show the QR code again during the setup
+func (a *Auth) TwoFactorSecret(ctx context.Context, userID string) (string, bool, error) {
+	state, err := a.twoFactorState(ctx, userID)
+	if err != nil || state.Secret == "" {
+		return "", false, err
+	}
+	secret, err := a.openSecret(state.Secret)
+	return secret, state.Confirmed, err
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user entered a code of
+// the secret of SetupTwoFactor. It returns the recovery codes, which are stored hashed:
+// show them to the user this once. The remember-me tokens of the user are deleted, they
+// were issued without a second factor.
+func (a *Auth) ConfirmTwoFactor(ctx context.Context, userID, code string) ([]string, error) {
+	state, err := a.twoFactorState(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Enabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	if state.Secret == "" {
+		return nil, ErrTwoFactorDisabled
+	}
+	valid, err := a.verifyTwoFactorCode(userID, state, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, err := twofactor.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	state.Confirmed = true
+	state.RecoveryCodes = twofactor.HashRecoveryCodes(codes)
+	if err := a.TwoFactor.SaveTwoFactor(ctx, userID, state); err != nil {
+		return nil, err
+	}
+	return codes, a.ForgetUser(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, returning the new
+// ones to show once
+func (a *Auth) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	state, err := a.twoFactorState(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !state.Enabled() {
+		return nil, ErrTwoFactorDisabled
+	}
+	codes, err := twofactor.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	state.RecoveryCodes = twofactor.HashRecoveryCodes(codes)
+	return codes, a.TwoFactor.SaveTwoFactor(ctx, userID, state)
+}
+
+// DisableTwoFactor removes the secret and recovery codes of the user
+func (a *Auth) DisableTwoFactor(ctx context.Context, userID string) error {
+	if a.TwoFactor == nil {
+		return errors.New("auth: two-factor authentication needs a two-factor store")
+	}
+	return a.TwoFactor.SaveTwoFactor(ctx, userID, TwoFactor{})
+}
+
+// twoFactorState loads the state of the user
+func (a *Auth) twoFactorState(ctx context.Context, userID string) (TwoFactor, error) {
+	if a.TwoFactor == nil {
+		return TwoFactor{}, errors.New("auth: two-factor authentication needs a two-factor store")
+	}
+	return a.TwoFactor.TwoFactor(ctx, userID)
+}
+
+// sealSecret and openSecret encrypt and decrypt secrets with the Encrypter, if any
+func (a *Auth) sealSecret(secret string) (string, error) {
+	if a.Encrypter == nil {
+		return secret, nil
+	}
+	return a.Encrypter.Encrypt(secret)
+}
+
+func (a *Auth) openSecret(sealed string) (string, error) {
+	if a.Encrypter == nil {
+		return sealed, nil
+	}
+	return a.Encrypter.Decrypt(sealed)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrEmailTaken is returned when an email address belongs to another user
+	ErrEmailTaken = errors.New("auth: email address is taken")
+	// ErrVerificationMismatch is returned for verification links made for an email
+	// address the user no longer has
+	ErrVerificationMismatch = errors.New("auth: verification link is outdated")
+)
+
+// EmailVerifier records the verification of email addresses
+type EmailVerifier interface {
+	// EmailVerified returns the current email address of the user and whether it is
+	// verified
+	EmailVerified(ctx context.Context, userID string) (email string, verified bool, err error)
+	// MarkEmailVerified records the verification of email; an address that is not
+	// the current one of the user replaces it
+	MarkEmailVerified(ctx context.Context, userID, email string) error
+}
+
+// EmailStamp identifies an email address in verification links, so a link stops
+// working once the address it was sent for changes
+func EmailStamp(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// VerifyEmail records the verification of email for the user, after the link carrying
+// them has been checked by the caller. The stamp of the link must match the current
+// address of the user. An email differing from the current address completes an email
+// change, it fails with ErrEmailTaken when another user has it by now.
+func (a *Auth) VerifyEmail(ctx context.Context, userID, email, stamp string) error {
+	if a.Verifier == nil || a.Users == nil {
+		return errors.New("auth: email verification needs an email verifier and a user provider")
+	}
+	current, verified, err := a.Verifier.EmailVerified(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if EmailStamp(current) != stamp {
+		return ErrVerificationMismatch
+	}
+	if strings.EqualFold(current, email) {
+		if verified {
+			return nil
+		}
+		return a.Verifier.MarkEmailVerified(ctx, userID, current)
+	}
+
+	if err := a.emailAvailable(ctx, userID, email); err != nil {
+		return err
+	}
+	return a.Verifier.MarkEmailVerified(ctx, userID, email)
+}
+
+// emailAvailable returns ErrEmailTaken when another user has the email address
+func (a *Auth) emailAvailable(ctx context.Context, userID, email string) error {
+	other, err := a.Users.UserByIdentifier(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.AuthID() != userID {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// CheckEmailChange checks that the user can change to the email address before a
+// verification link is sent to it
+func (a *Auth) CheckEmailChange(ctx context.Context, userID, email string) error {
+	if a.Users == nil {
+		return errors.New("auth: a user provider is required")
+	}
+	return a.emailAvailable(ctx, userID, email)
+}
+
+// RequireVerified middleware guards pages and APIs for users with a verified email
+// address. Guests are treated as by RequireWeb; unverified users are answered by
+// Unverified, or redirected to VerifyNoticePath.
+func (a *Auth) RequireVerified(next http.Handler) http.Handler {
+	return a.RequireWeb(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := FromContext(r.Context())
+		verified := false
+		if a.Verifier != nil {
+			_, ok, err := a.Verifier.EmailVerified(r.Context(), user.AuthID())
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			verified = ok
+		}
+		if !verified {
+			if a.config.Unverified != nil {
+				a.config.Unverified(w, r)
+				return
+			}
+			http.Redirect(w, r, a.config.VerifyNoticePath, http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
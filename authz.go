@@ -0,0 +1,70 @@
+package gudu
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/deenikarim/gudu/authz"
+)
+
+// createAuthz creates g.Authz for the logged-in users of g.Auth. With a database the
+// roles and permissions tables of `gudu make rbac` are used, and the lookups are kept
+// in the application cache for AUTHZ_CACHE_TTL.
+func (g *Gudu) createAuthz() {
+	var store authz.Store
+	if db := g.DBConnection.SqlConnPool; db != nil {
+		store = authz.NewSQLStore(db, g.DBConnection.DatabaseType)
+	}
+	var cache authz.Cache
+	if g.Cache != nil {
+		cache = cacheStore{g.Cache}
+	}
+
+	gate := authz.New(store, cache)
+	if ttl := envDuration("AUTHZ_CACHE_TTL"); ttl > 0 {
+		gate.CacheTTL = ttl
+	}
+	// the user is checked like by the auth guards and loaded once per request
+	gate.User = func(r *http.Request) authz.User {
+		if user := g.AuthUser(r); user != nil {
+			return user
+		}
+		return nil
+	}
+	gate.Forbidden = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, authz.ErrForbidden) {
+			g.ResponseFor(w, r).ErrorForbidden()
+			return
+		}
+		g.HandleError(w, r, err)
+	}
+	g.Authz = gate
+}
+
+// Authorize returns a 403 problem unless the logged-in user may perform the ability on
+// subject, nil for abilities without one, e.g. in handlers registered with Gudu.Handle:
+//
+//	if err := app.Authorize(r, "update", post); err != nil {
+//		return err
+//	}
+func (g *Gudu) Authorize(r *http.Request, ability string, subject any) error {
+	err := g.Authz.AuthorizeRequest(r, ability, subject)
+	if errors.Is(err, authz.ErrForbidden) {
+		return NewProblem(http.StatusForbidden, "")
+	}
+	return err
+}
+
+// Can middleware lets requests through when the logged-in user may perform the ability,
+// others get Response.ErrorForbidden; put it after the Auth guards:
+//
+//	mux.With(app.Auth.RequireWeb, app.Can("manage-users")).Get("/admin/users", handlers.Users)
+func (g *Gudu) Can(ability string) func(http.Handler) http.Handler {
+	return g.Authz.Can(ability)
+}
+
+// canFunc is the can template function, reporting whether the user of the request may
+// perform the ability
+func (g *Gudu) canFunc(r *http.Request, ability string, subject any) bool {
+	return g.Authz != nil && g.Authz.Check(r, ability, subject)
+}
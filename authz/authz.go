@@ -0,0 +1,285 @@
+// Package authz authorizes the users of an application: gates are named abilities
+// checked by a function, policies group the abilities of one model type, and roles
+// carry permissions stored in the tables of `gudu make rbac`. A Gate answers whether a
+// user may do something, in handlers, in route middleware and in templates.
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrForbidden is returned when the user may not perform the ability
+	ErrForbidden = errors.New("authz: forbidden")
+	// ErrNoRoleManager is returned when roles are changed without a RoleManager store
+	ErrNoRoleManager = errors.New("authz: the store can not manage roles")
+)
+
+// User is an authorizable user, it is satisfied by auth.User
+type User interface {
+	AuthID() string
+}
+
+// Rule decides whether the user may perform an ability, on subject for policies and
+// on nil for most gates
+type Rule func(ctx context.Context, user User, subject any) (bool, error)
+
+// For adapts a rule taking a typed subject; subjects of another type are denied
+//
+//	authz.For(func(ctx context.Context, user authz.User, post *data.Post) (bool, error) {
+//		return strconv.Itoa(post.UserID) == user.AuthID(), nil
+//	})
+func For[T any](rule func(ctx context.Context, user User, subject T) (bool, error)) Rule {
+	return func(ctx context.Context, user User, subject any) (bool, error) {
+		typed, ok := subject.(T)
+		if !ok {
+			return false, nil
+		}
+		return rule(ctx, user, typed)
+	}
+}
+
+// Policy holds the rules of the abilities on one model type, by ability name
+type Policy map[string]Rule
+
+// Hook runs before every check; decided reports whether allowed is final, e.g. to let
+// administrators do everything
+type Hook func(ctx context.Context, user User, ability string) (allowed, decided bool, err error)
+
+// Gate checks abilities. A check runs the Before hooks, then the policy rule of the
+// subject type, then the gate defined for the ability, and finally grants abilities
+// named like a permission of the roles of the user. Guests are denied.
+type Gate struct {
+	// Store loads the roles and permissions of users, nil when only rules are used
+	Store Store
+	// Cache keeps the roles and permissions of users for CacheTTL, nil to always ask
+	// the store
+	Cache    Cache
+	CacheTTL time.Duration
+	// User returns the user of a request, nil for guests; it is required by the
+	// request methods and the Can middleware
+	User func(r *http.Request) User
+	// Forbidden answers requests rejected by Can, a plain 403 when nil. err is
+	// ErrForbidden for denials, or the error of the subject loader or the store.
+	Forbidden func(w http.ResponseWriter, r *http.Request, err error)
+
+	mu        sync.RWMutex
+	abilities map[string]Rule
+	policies  map[reflect.Type]Policy
+	before    []Hook
+}
+
+// New creates a Gate over the roles and permissions of store, cached in cache for 10
+// minutes; both may be nil
+func New(store Store, cache Cache) *Gate {
+	return &Gate{
+		Store:     store,
+		Cache:     cache,
+		CacheTTL:  10 * time.Minute,
+		abilities: make(map[string]Rule),
+		policies:  make(map[reflect.Type]Policy),
+	}
+}
+
+// Define registers the gate of an ability, replacing an existing one
+func (g *Gate) Define(ability string, rule Rule) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.abilities[ability] = rule
+}
+
+// Policy registers the policy of the type of model, which may be a nil pointer such
+// as (*data.Post)(nil); subjects of the type and pointers to it use the policy
+func (g *Gate) Policy(model any, policy Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policies[modelType(model)] = policy
+}
+
+// Before registers a hook running before every check
+func (g *Gate) Before(hook Hook) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.before = append(g.before, hook)
+}
+
+// modelType returns the type policies are registered under, pointers resolved to the
+// type they point to
+func modelType(model any) reflect.Type {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Allows reports whether the user may perform the ability on subject, nil for abilities
+// without one
+func (g *Gate) Allows(ctx context.Context, user User, ability string, subject any) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+
+	g.mu.RLock()
+	hooks := g.before
+	rule, defined := g.abilities[ability]
+	if subject != nil {
+		if policyRule, ok := g.policies[modelType(subject)][ability]; ok {
+			rule, defined = policyRule, true
+		}
+	}
+	g.mu.RUnlock()
+
+	for _, hook := range hooks {
+		allowed, decided, err := hook(ctx, user, ability)
+		if err != nil || decided {
+			return allowed, err
+		}
+	}
+	if defined {
+		return rule(ctx, user, subject)
+	}
+	return g.HasPermission(ctx, user, ability)
+}
+
+// Authorize returns ErrForbidden unless the user may perform the ability on subject
+func (g *Gate) Authorize(ctx context.Context, user User, ability string, subject any) error {
+	allowed, err := g.Allows(ctx, user, ability, subject)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Check reports whether the user of the request may perform the ability on subject;
+// errors deny
+func (g *Gate) Check(r *http.Request, ability string, subject any) bool {
+	return g.AuthorizeRequest(r, ability, subject) == nil
+}
+
+// AuthorizeRequest is Authorize for the user of the request
+func (g *Gate) AuthorizeRequest(r *http.Request, ability string, subject any) error {
+	var user User
+	if g.User != nil {
+		user = g.User(r)
+	}
+	return g.Authorize(r.Context(), user, ability, subject)
+}
+
+// Can middleware lets requests through when their user may perform the ability:
+//
+//	mux.With(app.Authz.Can("manage-users")).Get("/admin/users", handlers.Users)
+func (g *Gate) Can(ability string) func(http.Handler) http.Handler {
+	return g.CanFor(ability, nil)
+}
+
+// CanFor middleware is Can for an ability on the subject loaded from the request, e.g.
+// the model of a route parameter; errors of subject are passed to Forbidden
+func (g *Gate) CanFor(ability string, subject func(r *http.Request) (any, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var model any
+			if subject != nil {
+				var err error
+				if model, err = subject(r); err != nil {
+					g.forbidden(w, r, err)
+					return
+				}
+			}
+			if err := g.AuthorizeRequest(r, ability, model); err != nil {
+				g.forbidden(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forbidden answers a rejected request
+func (g *Gate) forbidden(w http.ResponseWriter, r *http.Request, err error) {
+	if g.Forbidden != nil {
+		g.Forbidden(w, r, err)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// HasRole reports whether the user has the role
+func (g *Gate) HasRole(ctx context.Context, user User, role string) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	roles, _, err := g.grants(ctx, user.AuthID())
+	return slices.Contains(roles, role), err
+}
+
+// HasPermission reports whether a role of the user carries the permission
+func (g *Gate) HasPermission(ctx context.Context, user User, permission string) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	_, permissions, err := g.grants(ctx, user.AuthID())
+	return slices.Contains(permissions, permission), err
+}
+
+// Roles returns the role names of a user
+func (g *Gate) Roles(ctx context.Context, userID string) ([]string, error) {
+	roles, _, err := g.grants(ctx, userID)
+	return roles, err
+}
+
+// grants returns the roles and permissions of a user, from the cache when possible
+func (g *Gate) grants(ctx context.Context, userID string) (roles, permissions []string, err error) {
+	if g.Store == nil {
+		return nil, nil, nil
+	}
+	key := ""
+	if g.Cache != nil {
+		key, err = g.cacheKey(userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := g.Cache.Get(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stored, ok := value.(string); ok {
+			roles, permissions = decodeGrants(stored)
+			return roles, permissions, nil
+		}
+	}
+
+	roles, permissions, err = g.Store.UserGrants(ctx, userID)
+	if err != nil || key == "" {
+		return roles, permissions, err
+	}
+	return roles, permissions, g.Cache.Set(key, encodeGrants(roles, permissions), g.CacheTTL)
+}
+
+// encodeGrants stores roles and permissions as one string, which every cache driver
+// keeps as is
+func encodeGrants(roles, permissions []string) string {
+	return strings.Join(roles, ",") + "|" + strings.Join(permissions, ",")
+}
+
+func decodeGrants(stored string) (roles, permissions []string) {
+	rolePart, permissionPart, _ := strings.Cut(stored, "|")
+	return splitNames(rolePart), splitNames(permissionPart)
+}
+
+func splitNames(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
@@ -0,0 +1,204 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testUser string
+
+func (u testUser) AuthID() string { return string(u) }
+
+type post struct {
+	AuthorID string
+}
+
+// memoryCache is a Cache in a map
+type memoryCache map[string]interface{}
+
+func (c memoryCache) Get(key string) (interface{}, error) { return c[key], nil }
+func (c memoryCache) Set(key string, value interface{}, expires ...time.Duration) error {
+	c[key] = value
+	return nil
+}
+func (c memoryCache) Delete(key string) error {
+	delete(c, key)
+	return nil
+}
+
+type countingStore struct {
+	*MemoryStore
+	loads int
+}
+
+func (s *countingStore) UserGrants(ctx context.Context, userID string) ([]string, []string, error) {
+	s.loads++
+	return s.MemoryStore.UserGrants(ctx, userID)
+}
+
+func TestGatesPoliciesAndPermissions(t *testing.T) {
+	ctx := context.Background()
+	gate := New(NewMemoryStore(), nil)
+	gate.Define("view-reports", func(ctx context.Context, user User, _ any) (bool, error) {
+		return user.AuthID() == "1", nil
+	})
+	gate.Policy((*post)(nil), Policy{
+		"update": For(func(ctx context.Context, user User, p *post) (bool, error) {
+			return p.AuthorID == user.AuthID(), nil
+		}),
+	})
+	if err := gate.GrantPermission(ctx, "editor", "publish"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.AssignRole(ctx, "2", "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user    User
+		ability string
+		subject any
+		want    bool
+	}{
+		{testUser("1"), "view-reports", nil, true},
+		{testUser("2"), "view-reports", nil, false},
+		{nil, "view-reports", nil, false},
+		{testUser("1"), "update", &post{AuthorID: "1"}, true},
+		{testUser("2"), "update", &post{AuthorID: "1"}, false},
+		{testUser("2"), "publish", nil, true},
+		{testUser("1"), "publish", nil, false},
+		{testUser("2"), "delete", &post{AuthorID: "2"}, false},
+	}
+	for _, test := range tests {
+		got, err := gate.Allows(ctx, test.user, test.ability, test.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%v %s %v = %v, want %v", test.user, test.ability, test.subject, got, test.want)
+		}
+	}
+
+	gate.Before(func(ctx context.Context, user User, ability string) (bool, bool, error) {
+		admin, err := gate.HasRole(ctx, user, "admin")
+		return admin, admin, err
+	})
+	if err := gate.AssignRole(ctx, "3", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.Authorize(ctx, testUser("3"), "update", &post{AuthorID: "1"}); err != nil {
+		t.Errorf("admin update = %v, want allowed", err)
+	}
+	if err := gate.Authorize(ctx, testUser("2"), "update", &post{AuthorID: "1"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("editor update = %v, want ErrForbidden", err)
+	}
+	if err := gate.AssignRole(ctx, "3", "a,b"); err == nil {
+		t.Error("role names with commas must be rejected")
+	}
+}
+
+func TestCachedGrants(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	gate := New(store, memoryCache{})
+	if err := gate.GrantPermission(ctx, "editor", "publish"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := gate.HasPermission(ctx, testUser("1"), "publish"); ok {
+			t.Fatal("user without roles has a permission")
+		}
+	}
+	if store.loads != 1 {
+		t.Errorf("store loads = %d, want 1", store.loads)
+	}
+
+	// assigning a role forgets the user
+	if err := gate.AssignRole(ctx, "1", "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := gate.HasPermission(ctx, testUser("1"), "publish"); !ok {
+		t.Error("permission of an assigned role is missing")
+	}
+
+	// revoking a permission flushes every user
+	if err := gate.RevokePermission(ctx, "editor", "publish"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := gate.HasPermission(ctx, testUser("1"), "publish"); ok {
+		t.Error("revoked permission is still cached")
+	}
+	if roles, _ := gate.Roles(ctx, "1"); len(roles) != 1 || roles[0] != "editor" {
+		t.Errorf("roles = %v, want [editor]", roles)
+	}
+}
+
+func TestCanMiddleware(t *testing.T) {
+	gate := New(NewMemoryStore(), nil)
+	gate.User = func(r *http.Request) User {
+		if id := r.Header.Get("X-User"); id != "" {
+			return testUser(id)
+		}
+		return nil
+	}
+	gate.Policy(post{}, Policy{
+		"update": For(func(ctx context.Context, user User, p post) (bool, error) {
+			return p.AuthorID == user.AuthID(), nil
+		}),
+	})
+	errMissing := errors.New("missing post")
+	gate.Forbidden = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, errMissing) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}
+
+	loadPost := func(r *http.Request) (any, error) {
+		if r.URL.Query().Get("author") == "" {
+			return nil, errMissing
+		}
+		return post{AuthorID: r.URL.Query().Get("author")}, nil
+	}
+	handler := gate.CanFor("update", loadPost)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		user, query string
+		want        int
+	}{
+		{"1", "?author=1", http.StatusNoContent},
+		{"2", "?author=1", http.StatusForbidden},
+		{"", "?author=1", http.StatusForbidden},
+		{"1", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/posts"+test.query, nil)
+		if test.user != "" {
+			r.Header.Set("X-User", test.user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("user %q %s: status %d, want %d", test.user, test.query, w.Code, test.want)
+		}
+	}
+}
+
+func TestInsertIgnore(t *testing.T) {
+	pg := NewSQLStore(nil, "postgres")
+	if got := pg.insertIgnore("roles (name) values (?)"); got != "insert into roles (name) values ($1) on conflict do nothing" {
+		t.Errorf("postgres insert = %q", got)
+	}
+	mysql := NewSQLStore(nil, "mysql")
+	if got := mysql.insertIgnore("roles (name) values (?)"); got != "insert ignore into roles (name) values (?)" {
+		t.Errorf("mysql insert = %q", got)
+	}
+}
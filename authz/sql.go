@@ -0,0 +1,156 @@
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore is a Store and RoleManager over the roles, permissions, role_permissions
+// and user_roles tables created by `gudu make rbac`
+type SQLStore struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// NewSQLStore creates a SQLStore for the database type of DATABASE_TYPE
+func NewSQLStore(db *sql.DB, databaseType string) *SQLStore {
+	switch strings.ToLower(databaseType) {
+	case "postgres", "postgresql", "pgx":
+		return &SQLStore{db: db, postgres: true}
+	}
+	return &SQLStore{db: db}
+}
+
+// rebind rewrites ? placeholders to $1, $2... for postgres
+func (s *SQLStore) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// insertIgnore writes an insert skipping rows that violate a unique key
+func (s *SQLStore) insertIgnore(insert string) string {
+	if s.postgres {
+		return s.rebind("insert into " + insert + " on conflict do nothing")
+	}
+	return "insert ignore into " + insert
+}
+
+// sqlID passes numeric ids as integers, the users table has a serial key
+func sqlID(id string) interface{} {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
+
+// UserGrants returns the roles of the user and the permissions of these roles
+func (s *SQLStore) UserGrants(ctx context.Context, userID string) (roles, permissions []string, err error) {
+	roles, err = s.names(ctx, `select r.name from roles r
+		join user_roles ur on ur.role_id = r.id
+		where ur.user_id = ? order by r.name`, sqlID(userID))
+	if err != nil {
+		return nil, nil, err
+	}
+	permissions, err = s.names(ctx, `select distinct p.name from permissions p
+		join role_permissions rp on rp.permission_id = p.id
+		join user_roles ur on ur.role_id = rp.role_id
+		where ur.user_id = ? order by p.name`, sqlID(userID))
+	return roles, permissions, err
+}
+
+// names runs a query selecting one name column
+func (s *SQLStore) names(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// AssignRole gives the user the role, creating the role when needed
+func (s *SQLStore) AssignRole(ctx context.Context, userID, role string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.createName(ctx, tx, "roles", role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.insertIgnore("user_roles (user_id, role_id) select ?, id from roles where name = ?"),
+			sqlID(userID), role)
+		return err
+	})
+}
+
+// RemoveRole takes the role from the user
+func (s *SQLStore) RemoveRole(ctx context.Context, userID, role string) error {
+	_, err := s.db.ExecContext(ctx,
+		s.rebind("delete from user_roles where user_id = ? and role_id in (select id from roles where name = ?)"),
+		sqlID(userID), role)
+	return err
+}
+
+// GrantPermission gives the permission to the role, creating both when needed
+func (s *SQLStore) GrantPermission(ctx context.Context, role, permission string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.createName(ctx, tx, "roles", role); err != nil {
+			return err
+		}
+		if err := s.createName(ctx, tx, "permissions", permission); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.insertIgnore(`role_permissions (role_id, permission_id)
+			select r.id, p.id from roles r, permissions p where r.name = ? and p.name = ?`), role, permission)
+		return err
+	})
+}
+
+// RevokePermission takes the permission from the role
+func (s *SQLStore) RevokePermission(ctx context.Context, role, permission string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`delete from role_permissions
+		where role_id in (select id from roles where name = ?)
+		and permission_id in (select id from permissions where name = ?)`), role, permission)
+	return err
+}
+
+// createName inserts a role or permission unless it exists
+func (s *SQLStore) createName(ctx context.Context, tx *sql.Tx, table, name string) error {
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, s.insertIgnore(table+" (name, created_at, updated_at) values (?, ?, ?)"), name, now, now)
+	return err
+}
+
+// inTx runs fn in a transaction, committed when fn succeeds
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,204 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store loads the roles of users and the permissions those roles carry
+type Store interface {
+	// UserGrants returns the role names of the user and the permission names of
+	// these roles
+	UserGrants(ctx context.Context, userID string) (roles, permissions []string, err error)
+}
+
+// RoleManager is implemented by stores that can change roles and permissions; roles
+// and permissions that do not exist yet are created
+type RoleManager interface {
+	AssignRole(ctx context.Context, userID, role string) error
+	RemoveRole(ctx context.Context, userID, role string) error
+	GrantPermission(ctx context.Context, role, permission string) error
+	RevokePermission(ctx context.Context, role, permission string) error
+}
+
+// Cache keeps the roles and permissions of users. It is satisfied by the gudu
+// cache.Cache drivers through an adapter returning nil for missing keys, so every
+// instance of an application shares the entries.
+type Cache interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}, expires ...time.Duration) error
+	Delete(key string) error
+}
+
+// versionKey holds the generation of the cache entries; flushing starts a new one,
+// leaving the old entries to expire
+const versionKey = "authz:version"
+
+// cacheKey returns the cache key of the grants of a user in the current generation
+func (g *Gate) cacheKey(userID string) (string, error) {
+	value, err := g.Cache.Get(versionKey)
+	if err != nil {
+		return "", err
+	}
+	version, _ := value.(string)
+	return "authz:" + version + ":user:" + userID, nil
+}
+
+// Forget drops the cached roles and permissions of a user
+func (g *Gate) Forget(userID string) error {
+	if g.Cache == nil {
+		return nil
+	}
+	key, err := g.cacheKey(userID)
+	if err != nil {
+		return err
+	}
+	return g.Cache.Delete(key)
+}
+
+// Flush drops the cached roles and permissions of every user, e.g. after the
+// permissions of a role changed in the database
+func (g *Gate) Flush() error {
+	if g.Cache == nil {
+		return nil
+	}
+	return g.Cache.Set(versionKey, strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+// manager returns the store as a RoleManager
+func (g *Gate) manager() (RoleManager, error) {
+	manager, ok := g.Store.(RoleManager)
+	if !ok {
+		return nil, ErrNoRoleManager
+	}
+	return manager, nil
+}
+
+// checkName rejects role and permission names the cache can not store
+func checkName(kind, name string) error {
+	if name == "" || strings.ContainsAny(name, ",|") {
+		return fmt.Errorf("authz: invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// AssignRole gives the user the role
+func (g *Gate) AssignRole(ctx context.Context, userID, role string) error {
+	manager, err := g.manager()
+	if err != nil {
+		return err
+	}
+	if err := checkName("role", role); err != nil {
+		return err
+	}
+	if err := manager.AssignRole(ctx, userID, role); err != nil {
+		return err
+	}
+	return g.Forget(userID)
+}
+
+// RemoveRole takes the role from the user
+func (g *Gate) RemoveRole(ctx context.Context, userID, role string) error {
+	manager, err := g.manager()
+	if err != nil {
+		return err
+	}
+	if err := manager.RemoveRole(ctx, userID, role); err != nil {
+		return err
+	}
+	return g.Forget(userID)
+}
+
+// GrantPermission gives the permission to every user with the role
+func (g *Gate) GrantPermission(ctx context.Context, role, permission string) error {
+	manager, err := g.manager()
+	if err != nil {
+		return err
+	}
+	if err := checkName("role", role); err != nil {
+		return err
+	}
+	if err := checkName("permission", permission); err != nil {
+		return err
+	}
+	if err := manager.GrantPermission(ctx, role, permission); err != nil {
+		return err
+	}
+	return g.Flush()
+}
+
+// RevokePermission takes the permission from the role
+func (g *Gate) RevokePermission(ctx context.Context, role, permission string) error {
+	manager, err := g.manager()
+	if err != nil {
+		return err
+	}
+	if err := manager.RevokePermission(ctx, role, permission); err != nil {
+		return err
+	}
+	return g.Flush()
+}
+
+// MemoryStore is a Store and RoleManager keeping roles in memory, for tests and
+// applications defining their roles in code
+type MemoryStore struct {
+	mu          sync.Mutex
+	userRoles   map[string][]string
+	permissions map[string][]string
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{userRoles: make(map[string][]string), permissions: make(map[string][]string)}
+}
+
+func (m *MemoryStore) UserGrants(ctx context.Context, userID string) (roles, permissions []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	roles = slices.Clone(m.userRoles[userID])
+	for _, role := range roles {
+		for _, permission := range m.permissions[role] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return roles, permissions, nil
+}
+
+func (m *MemoryStore) AssignRole(ctx context.Context, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.userRoles[userID], role) {
+		m.userRoles[userID] = append(m.userRoles[userID], role)
+	}
+	return nil
+}
+
+func (m *MemoryStore) RemoveRole(ctx context.Context, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userRoles[userID] = slices.DeleteFunc(m.userRoles[userID], func(r string) bool { return r == role })
+	return nil
+}
+
+func (m *MemoryStore) GrantPermission(ctx context.Context, role, permission string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.permissions[role], permission) {
+		m.permissions[role] = append(m.permissions[role], permission)
+	}
+	return nil
+}
+
+func (m *MemoryStore) RevokePermission(ctx context.Context, role, permission string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.permissions[role] = slices.DeleteFunc(m.permissions[role], func(p string) bool { return p == permission })
+	return nil
+}
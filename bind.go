@@ -0,0 +1,415 @@
+package gudu
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BindOptions holds the settings of Gudu.Bind
+type BindOptions struct {
+	// MaxBodySize limits the request body in bytes; larger bodies fail with a 413
+	MaxBodySize int64
+	// DisallowUnknownFields rejects JSON bodies with fields the destination lacks
+	DisallowUnknownFields bool
+	// MultipartMemory is the part of a multipart body kept in memory, the rest is
+	// stored in temporary files
+	MultipartMemory int64
+}
+
+// loadBindConfig reads the request binding settings from the environment
+func loadBindConfig() BindOptions {
+	maxBodySize, err := strconv.ParseInt(os.Getenv("BIND_MAX_BODY_SIZE"), 10, 64)
+	if err != nil || maxBodySize <= 0 {
+		maxBodySize = 10 << 20
+	}
+	disallowUnknown, _ := strconv.ParseBool(os.Getenv("BIND_DISALLOW_UNKNOWN_FIELDS"))
+
+	return BindOptions{
+		MaxBodySize:           maxBodySize,
+		DisallowUnknownFields: disallowUnknown,
+		MultipartMemory:       32 << 20,
+	}
+}
+
+// Bind decodes the request into the struct pointed to by dst and validates it.
+//
+// The body is decoded according to its Content-Type: JSON and XML through their
+// struct tags, url encoded and multipart forms through `form` tags, where
+// *multipart.FileHeader and []*multipart.FileHeader fields receive uploads. Fields
+// tagged `query` are then read from the query string and fields tagged `path` from
+// the chi URL parameters.
+//
+// Validation rules are declared with the `validate` tag, separated by semicolons, e.g.
+// `validate:"required;email"` or `validate:"required;in:draft,published"`; they are the
+// rules of Validator. A failed validation returns ValidationErrors. Malformed bodies
+// return a *Problem with status 400, 413 or 415.
+func (g *Gudu) Bind(r *http.Request, dst interface{}, opts ...BindOptions) error {
+	options := g.config.bind
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Pointer || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: destination must be a non nil pointer to a struct, got %T", dst)
+	}
+	target = target.Elem()
+
+	if options.MaxBodySize > 0 && r.Body != nil {
+		r.Body = http.MaxBytesReader(nil, r.Body, options.MaxBodySize)
+	}
+
+	files, err := bindBody(r, target, options)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return NewProblem(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("The request body must not exceed %d bytes.", maxBytesErr.Limit))
+		}
+		return err
+	}
+
+	if err := bindValues(target, "query", r.URL.Query()); err != nil {
+		return err
+	}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		params := url.Values{}
+		for i, key := range rctx.URLParams.Keys {
+			params.Set(key, rctx.URLParams.Values[i])
+		}
+		if err := bindValues(target, "path", params); err != nil {
+			return err
+		}
+	}
+
+	return g.validateStruct(target, files)
+}
+
+// bindBody decodes the request body into target, returning the uploaded files
+func bindBody(r *http.Request, target reflect.Value, options BindOptions) (map[string][]*multipart.FileHeader, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return nil, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(contentType))
+	if err != nil {
+		if r.ContentLength == 0 {
+			return nil, nil
+		}
+		return nil, NewProblem(http.StatusUnsupportedMediaType, "The request Content-Type is missing or invalid.")
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		decoder := json.NewDecoder(r.Body)
+		if options.DisallowUnknownFields {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(target.Addr().Interface()); err != nil && !errors.Is(err, io.EOF) {
+			return nil, bindDecodeError(err)
+		}
+		return nil, nil
+
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if err := xml.NewDecoder(r.Body).Decode(target.Addr().Interface()); err != nil && !errors.Is(err, io.EOF) {
+			return nil, bindDecodeError(err)
+		}
+		return nil, nil
+
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, bindDecodeError(err)
+		}
+		return nil, bindValues(target, "form", r.PostForm)
+
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(options.MultipartMemory); err != nil {
+			return nil, bindDecodeError(err)
+		}
+		if err := bindValues(target, "form", r.MultipartForm.Value); err != nil {
+			return nil, err
+		}
+		bindFiles(target, r.MultipartForm.File)
+		return r.MultipartForm.File, nil
+	}
+
+	return nil, NewProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("The Content-Type %s is not supported.", mediaType))
+}
+
+// bindDecodeError turns a decoding failure into a 400 problem, keeping body size errors
+func bindDecodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+	return NewProblem(http.StatusBadRequest, "The request body is malformed: "+err.Error())
+}
+
+// fieldName returns the name of a struct field for a tag, "" when the field is not
+// bound through that tag
+func fieldName(field reflect.StructField, tag string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" && tag == "form" {
+		// forms fall back to the json name, so one struct serves both encodings
+		name, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			name = field.Name
+		}
+	}
+	return name
+}
+
+// bindValues sets the fields of target tagged with tag from values, recursing into
+// embedded structs
+func bindValues(target reflect.Value, tag string, values url.Values) error {
+	if len(values) == 0 {
+		return nil
+	}
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindValues(target.Field(i), tag, values); err != nil {
+				return err
+			}
+			continue
+		}
+		name := fieldName(field, tag)
+		if name == "" {
+			continue
+		}
+		value, ok := values[name]
+		if !ok || len(value) == 0 {
+			continue
+		}
+		if err := setField(target.Field(i), value); err != nil {
+			problem := NewProblem(http.StatusUnprocessableEntity, "The given data was invalid.")
+			return problem.With("errors", ValidationErrors{name: {fmt.Sprintf("The %s field is invalid: %v", name, err)}})
+		}
+	}
+	return nil
+}
+
+// bindFiles sets the file upload fields of target
+func bindFiles(target reflect.Value, files map[string][]*multipart.FileHeader) {
+	fileType := reflect.TypeOf((*multipart.FileHeader)(nil))
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			bindFiles(target.Field(i), files)
+			continue
+		}
+		headers := files[fieldName(field, "form")]
+		if len(headers) == 0 {
+			continue
+		}
+		switch {
+		case field.Type == fileType:
+			target.Field(i).Set(reflect.ValueOf(headers[0]))
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem() == fileType:
+			target.Field(i).Set(reflect.ValueOf(headers))
+		}
+	}
+}
+
+// setField converts the string values to the type of the field
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return setField(field.Elem(), values)
+	}
+
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		return setTime(field, strings.TrimSpace(values[0]))
+	}
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(values[0]))
+	}
+
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	value := strings.TrimSpace(values[0])
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(values[0])
+	case reflect.Bool:
+		if value == "on" {
+			value = "true"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		field.SetBytes([]byte(values[0]))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// setTime parses RFC 3339 timestamps and YYYY-MM-DD dates
+func setTime(field reflect.Value, value string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			field.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q", value)
+}
+
+// validateStruct runs the `validate` tag rules of target through a Validator
+func (g *Gudu) validateStruct(target reflect.Value, files map[string][]*multipart.FileHeader) error {
+	data := url.Values{}
+	rules := map[string][]string{}
+	fileData := map[string]*multipart.FileHeader{}
+	collectRules(target, data, rules, fileData)
+	if len(rules) == 0 {
+		return nil
+	}
+	for name, headers := range files {
+		if _, ok := fileData[name]; !ok && len(headers) > 0 {
+			fileData[name] = headers[0]
+		}
+	}
+
+	v := g.NewValidator(data, fileData, rules, g.DBConnection.SqlConnPool)
+	if v.Validate() {
+		return nil
+	}
+	if len(v.Errors) == 0 {
+		return errors.New("bind: validation hooks failed")
+	}
+	return v.Errors
+}
+
+// collectRules gathers the `validate` rules and the string values of the fields of target
+func collectRules(target reflect.Value, data url.Values, rules map[string][]string, fileData map[string]*multipart.FileHeader) {
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectRules(target.Field(i), data, rules, fileData)
+			continue
+		}
+		name := fieldName(field, "form")
+		if name == "" {
+			name = field.Name
+		}
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ";") {
+			if rule = strings.TrimSpace(rule); rule != "" && rule != "-" {
+				rules[name] = append(rules[name], rule)
+			}
+		}
+
+		// every field is part of the data, rules such as confirmed compare fields
+		switch value := target.Field(i).Interface().(type) {
+		case *multipart.FileHeader:
+			if value != nil {
+				fileData[name] = value
+			}
+		case []*multipart.FileHeader:
+			if len(value) > 0 {
+				fileData[name] = value[0]
+			}
+		default:
+			if s, ok := fieldString(target.Field(i)); ok {
+				data.Set(name, s)
+			}
+		}
+	}
+}
+
+// fieldString returns the text form of a field value, false for nil pointers and zero
+// times so "required" reports them as missing
+func fieldString(field reflect.Value) (string, bool) {
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return "", false
+		}
+		field = field.Elem()
+	}
+	switch value := field.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return "", false
+		}
+		return value.Format("2006-01-02"), true
+	case encoding.TextMarshaler:
+		text, err := value.MarshalText()
+		return string(text), err == nil
+	case []string:
+		return strings.Join(value, ","), true
+	}
+	return fmt.Sprint(field.Interface()), true
+}
@@ -0,0 +1,146 @@
+package gudu
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type bindPost struct {
+	ID        int       `path:"id"`
+	Page      int       `query:"page"`
+	Title     string    `json:"title" validate:"required;max:20"`
+	Email     string    `json:"email" validate:"required;email"`
+	Status    string    `json:"status" validate:"in:draft,published"`
+	Tags      []string  `json:"tags" form:"tag"`
+	Draft     bool      `json:"draft"`
+	Published time.Time `json:"published"`
+}
+
+// bindRequest builds a request with the body and the chi URL parameters
+func bindRequest(method, target, mediaType, body string, params map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if mediaType != "" {
+		r.Header.Set("Content-Type", mediaType)
+	}
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestBindJSONQueryAndPath(t *testing.T) {
+	g := testGudu(t)
+	body := `{"title": "Hello", "email": "ada@example.com", "status": "draft", "tags": ["go", "web"], "published": "2024-05-01T10:00:00Z"}`
+	r := bindRequest(http.MethodPost, "/posts/7?page=3", "application/json; charset=utf-8", body, map[string]string{"id": "7"})
+
+	var post bindPost
+	if err := g.Bind(r, &post); err != nil {
+		t.Fatal(err)
+	}
+	if post.ID != 7 || post.Page != 3 || post.Title != "Hello" || post.Status != "draft" {
+		t.Errorf("bound %+v", post)
+	}
+	if len(post.Tags) != 2 || post.Tags[1] != "web" || post.Published.Day() != 1 {
+		t.Errorf("bound %+v", post)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	g := testGudu(t)
+	form := url.Values{
+		"title":     {"Hello"},
+		"email":     {"ada@example.com"},
+		"status":    {"published"},
+		"tag":       {"go", "web"},
+		"draft":     {"on"},
+		"published": {"2024-05-01"},
+	}
+	r := bindRequest(http.MethodPost, "/posts", "application/x-www-form-urlencoded", form.Encode(), nil)
+
+	var post bindPost
+	if err := g.Bind(r, &post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Hello" || !post.Draft || len(post.Tags) != 2 || post.Published.Month() != time.May {
+		t.Errorf("bound %+v", post)
+	}
+
+	form.Set("published", "yesterday")
+	r = bindRequest(http.MethodPost, "/posts", "application/x-www-form-urlencoded", form.Encode(), nil)
+	err := g.Bind(r, &bindPost{})
+	if problemStatus(err) != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid date: %v, want a 422 problem", err)
+	}
+	var problem *Problem
+	errors.As(err, &problem)
+	if invalid, _ := problem.Extensions["errors"].(ValidationErrors); len(invalid["published"]) == 0 {
+		t.Errorf("the problem does not name the field: %v", problem.Extensions)
+	}
+}
+
+func TestBindValidationErrors(t *testing.T) {
+	g := testGudu(t)
+	body := `{"title": "A title far longer than twenty characters", "email": "not an email", "status": "deleted"}`
+	r := bindRequest(http.MethodPost, "/posts", "application/json", body, nil)
+
+	err := g.Bind(r, &bindPost{})
+	var invalid ValidationErrors
+	if !errors.As(err, &invalid) {
+		t.Fatalf("%v, want ValidationErrors", err)
+	}
+	for _, field := range []string{"title", "email", "status"} {
+		if len(invalid[field]) == 0 {
+			t.Errorf("no error for %s: %v", field, invalid)
+		}
+	}
+
+	problem := ProblemFromError(err)
+	if errs, _ := problem.Extensions["errors"].(ValidationErrors); problem.Status != http.StatusUnprocessableEntity || len(errs) != 3 {
+		t.Errorf("problem %d %v, want a 422 with the errors", problem.Status, problem.Extensions)
+	}
+
+	r = bindRequest(http.MethodPost, "/posts", "application/json", `{"title": "Hello"}`, nil)
+	if err := g.Bind(r, &bindPost{}); !errors.As(err, &invalid) || len(invalid["email"]) == 0 {
+		t.Errorf("missing email: %v", err)
+	}
+}
+
+func TestBindRejectsMalformedBodies(t *testing.T) {
+	g := testGudu(t)
+	valid := `{"title": "Hello", "email": "ada@example.com"}`
+
+	tests := []struct {
+		name      string
+		mediaType string
+		body      string
+		options   BindOptions
+		status    int
+	}{
+		{"malformed json", "application/json", `{"title": `, BindOptions{}, http.StatusBadRequest},
+		{"wrong json type", "application/json", `{"title": 7}`, BindOptions{}, http.StatusBadRequest},
+		{"unknown field", "application/json", `{"title": "Hello", "admin": true}`, BindOptions{DisallowUnknownFields: true}, http.StatusBadRequest},
+		{"too large", "application/json", valid, BindOptions{MaxBodySize: 16}, http.StatusRequestEntityTooLarge},
+		{"unsupported type", "text/csv", "title,email", BindOptions{}, http.StatusUnsupportedMediaType},
+		{"missing type", "", valid, BindOptions{}, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		r := bindRequest(http.MethodPost, "/posts", tt.mediaType, tt.body, nil)
+		if err := g.Bind(r, &bindPost{}, tt.options); problemStatus(err) != tt.status {
+			t.Errorf("%s: %v, want a %d problem", tt.name, err, tt.status)
+		}
+	}
+
+	var post bindPost
+	if err := g.Bind(bindRequest(http.MethodPost, "/posts", "application/json", valid, nil), post); err == nil {
+		t.Error("binding into a value succeeded")
+	}
+}
@@ -186,6 +186,94 @@ func (b *BadgerCache) Update(keyStr string, value interface{}) error {
 	})
 }
 
+// Increment atomically adds one to the counter under a prefixed key, retrying when a
+// concurrent transaction changed it first. The expiry of an existing counter is kept.
+func (b *BadgerCache) Increment(keyStr string, expires ...time.Duration) (int64, error) {
+	prefixedKey := b.prefixedKey(keyStr)
+
+	for {
+		var count int64
+		err := b.Conn.Update(func(txn *badger.Txn) error {
+			var ttl time.Duration
+			item, err := txn.Get([]byte(prefixedKey))
+			switch {
+			case errors.Is(err, badger.ErrKeyNotFound):
+				if len(expires) > 0 {
+					ttl = expires[0]
+				}
+			case err != nil:
+				return err
+			default:
+				if err := item.Value(func(val []byte) error {
+					decoded, err := decodeValue(val)
+					if err != nil {
+						return err
+					}
+					count, _ = decoded[prefixedKey].(int64)
+					return nil
+				}); err != nil {
+					return err
+				}
+				if item.ExpiresAt() > 0 {
+					ttl = time.Until(time.Unix(int64(item.ExpiresAt()), 0))
+				}
+			}
+			count++
+
+			encoded, err := encodeValue(EntryCache{prefixedKey: count})
+			if err != nil {
+				return err
+			}
+			e := badger.NewEntry([]byte(prefixedKey), encoded)
+			if ttl > 0 {
+				e.WithTTL(ttl)
+			}
+			return txn.SetEntry(e)
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to increment: %w", err)
+		}
+		return count, nil
+	}
+}
+
+// SetIfAbsent adds a key-value pair with a prefixed key unless the key exists,
+// retrying when a concurrent transaction changed it first.
+func (b *BadgerCache) SetIfAbsent(keyStr string, value interface{}, expires ...time.Duration) (bool, error) {
+	prefixedKey := b.prefixedKey(keyStr)
+
+	encoded, err := encodeValue(EntryCache{prefixedKey: value})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode value: %w", err)
+	}
+
+	for {
+		var stored bool
+		err := b.Conn.Update(func(txn *badger.Txn) error {
+			_, err := txn.Get([]byte(prefixedKey))
+			if err == nil || !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			e := badger.NewEntry([]byte(prefixedKey), encoded)
+			if len(expires) > 0 && expires[0] > 0 {
+				e.WithTTL(expires[0])
+			}
+			stored = true
+			return txn.SetEntry(e)
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to set cache: %w", err)
+		}
+		return stored, nil
+	}
+}
+
 // Delete removes a key-value pair with a prefixed key from the Badger cache.
 func (b *BadgerCache) Delete(keyStr string) error {
 	prefixedKey := b.prefixedKey(keyStr)
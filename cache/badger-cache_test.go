@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -295,3 +297,60 @@ func TestBadgerCache_Update(t *testing.T) {
 	}
 
 }
+
+// TestBadgerCache_Increment tests that concurrent increments are all counted.
+func TestBadgerCache_Increment(t *testing.T) {
+	_ = testBadgerCache.Delete("counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testBadgerCache.Increment("counter", time.Minute); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := testBadgerCache.Increment("counter", time.Minute)
+	if err != nil || count != 21 {
+		t.Errorf("Expected 21, got %d, %v", count, err)
+	}
+
+	result, err := testBadgerCache.Get("counter")
+	if err != nil || result != int64(21) {
+		t.Errorf("Expected the counter to be readable, got %v, %v", result, err)
+	}
+}
+
+// TestBadgerCache_SetIfAbsent tests that only one of concurrent callers stores the key.
+func TestBadgerCache_SetIfAbsent(t *testing.T) {
+	_ = testBadgerCache.Delete("once")
+
+	var wg sync.WaitGroup
+	var stored atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := testBadgerCache.SetIfAbsent("once", "used", time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				stored.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stored.Load() != 1 {
+		t.Errorf("Expected one caller to store the key, got %d", stored.Load())
+	}
+	result, err := testBadgerCache.Get("once")
+	if err != nil || result != "used" {
+		t.Errorf("Expected used, got %v, %v", result, err)
+	}
+}
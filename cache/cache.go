@@ -15,6 +15,13 @@ type Cache interface {
 	Expire(keyStr string, expiration time.Duration) error
 	TTL(keyStr string) (time.Duration, error)
 	Update(keyStr string, value interface{}) error
+	// Increment atomically adds one to the counter under the key and returns the new
+	// count; a new counter starts at 1 and expires after the optional duration.
+	// Counters are only read through Increment.
+	Increment(keyStr string, expires ...time.Duration) (int64, error)
+	// SetIfAbsent atomically stores the value unless the key exists, reporting whether
+	// it was stored
+	SetIfAbsent(keyStr string, value interface{}, expires ...time.Duration) (bool, error)
 }
 
 // EntryCache is a type alias for a map used to store entries.
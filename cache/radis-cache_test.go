@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -355,3 +357,60 @@ func TestRedisCache_Empty(t *testing.T) {
 		t.Errorf("Expected 0 keys, got %v", keys)
 	}
 }
+
+// TestRedisCache_Increment tests that concurrent increments are all counted.
+func TestRedisCache_Increment(t *testing.T) {
+	_ = testRedisCache.Delete("counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testRedisCache.Increment("counter", time.Minute); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := testRedisCache.Increment("counter", time.Minute)
+	if err != nil || count != 21 {
+		t.Errorf("Expected 21, got %d, %v", count, err)
+	}
+
+	ttl, err := testRedisCache.TTL("counter")
+	if err != nil || ttl <= 0 {
+		t.Errorf("Expected the counter to expire, got %v, %v", ttl, err)
+	}
+}
+
+// TestRedisCache_SetIfAbsent tests that only one of concurrent callers stores the key.
+func TestRedisCache_SetIfAbsent(t *testing.T) {
+	_ = testRedisCache.Delete("once")
+
+	var wg sync.WaitGroup
+	var stored atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := testRedisCache.SetIfAbsent("once", "used", time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				stored.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stored.Load() != 1 {
+		t.Errorf("Expected one caller to store the key, got %d", stored.Load())
+	}
+	result, err := testRedisCache.Get("once")
+	if err != nil || result != "used" {
+		t.Errorf("Expected used, got %v, %v", result, err)
+	}
+}
@@ -149,6 +149,65 @@ func (rc *RedisCache) Set(keyStr string, value interface{}, expires ...time.Dura
 	return nil
 }
 
+// SetIfAbsent adds a key-value pair with a prefixed key unless the key exists, in a
+// single SET NX so concurrent callers can not both store it.
+func (rc *RedisCache) SetIfAbsent(keyStr string, value interface{}, expires ...time.Duration) (bool, error) {
+	conn := rc.Conn.Get()
+	defer func(conn redis.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	prefixedKey := rc.prefixedKey(keyStr)
+
+	encodedData, err := encodeValue(EntryCache{prefixedKey: value})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode value: %w", err)
+	}
+
+	args := []interface{}{prefixedKey, encodedData, "NX"}
+	if len(expires) > 0 && expires[0] > 0 {
+		args = append(args, "PX", expires[0].Milliseconds())
+	}
+	reply, err := conn.Do("SET", args...)
+	if err != nil {
+		log.Printf("Error setting cache for key %s: %v", keyStr, err)
+		return false, fmt.Errorf("failed to set cache: %w", err)
+	}
+
+	// SET NX replies nil when the key exists
+	return reply != nil, nil
+}
+
+// incrementScript increments a counter and sets the expiry, in milliseconds, of a new
+// one in a single step
+var incrementScript = redis.NewScript(1, `
+local count = redis.call("INCR", KEYS[1])
+if count == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count`)
+
+// Increment atomically adds one to the counter under a prefixed key.
+func (rc *RedisCache) Increment(keyStr string, expires ...time.Duration) (int64, error) {
+	conn := rc.Conn.Get()
+	defer func(conn redis.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	var ttl int64
+	if len(expires) > 0 {
+		ttl = expires[0].Milliseconds()
+	}
+
+	count, err := redis.Int64(incrementScript.Do(conn, rc.prefixedKey(keyStr), ttl))
+	if err != nil {
+		log.Printf("Error incrementing key %s: %v", keyStr, err)
+		return 0, fmt.Errorf("failed to increment: %w", err)
+	}
+
+	return count, nil
+}
+
 // Delete removes a key-value pair with a prefixed key from the Redis cache.
 func (rc *RedisCache) Delete(keyStr string) error {
 	conn := rc.Conn.Get()
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/deenikarim/gudu/assets"
+	"github.com/fatih/color"
+	"os"
+	"path/filepath"
+)
+
+// doAssets build the assets command that fingerprints the files of the public folder
+func doAssets(arg3, arg4 string) error {
+	switch arg3 {
+	case "build":
+		staticDir := os.Getenv("STATIC_DIR")
+		if staticDir == "" {
+			staticDir = "public"
+		}
+		if !filepath.IsAbs(staticDir) {
+			staticDir = filepath.Join(gud.RootPath, staticDir)
+		}
+
+		manifest, err := assets.Build(assets.BuildOptions{
+			SourceDir: staticDir,
+			OutputDir: filepath.Join(staticDir, "build"),
+			Minify:    arg4 == "--minify" || arg4 == "minify",
+			Gzip:      true,
+		})
+		if err != nil {
+			return err
+		}
+
+		color.Yellow(fmt.Sprintf("   -%d assets fingerprinted", len(manifest)))
+		color.Yellow("   -manifest written to " + filepath.Join(staticDir, "build", assets.ManifestFile))
+	default:
+		return errors.New("unknown assets subcommand: " + arg3)
+	}
+
+	return nil
+}
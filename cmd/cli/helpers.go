@@ -97,6 +97,16 @@ func showHelp() {
 	make controllers        -create a stub controllers in the controllers folder
 	make models				-create a new models in the data folder
 	make session            -create a table in the database to be used as a session store
+	make password-resets    -create the password reset tokens table and mails, for apps made before make auth had them
+	make verification       -add the email_verified_at column to users and the verification mails
+	make rbac               -create and run migration for the roles and permissions tables of authorization
+	make two-factor         -add the two-factor columns to users and the two-factor challenge and settings views
+	make password-column    -widen users.password to fit argon2id hashes, for apps made before make auth did
+	assets build            -fingerprint css, js, images and fonts in public and write the manifest
+	assets build --minify   -same as assets build, minifying css and js first
+	key generate            -print a new random 32 character key
+	key rotate              -replace KEY, keep the old key in PREVIOUS_KEYS and re-encrypt stored values
+	key rotate --env-only   -same as key rotate, without running the re-encryption callbacks
 
 `)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// doKey runs the key subcommands
+func doKey(arg3, arg4 string) error {
+	switch arg3 {
+	case "generate":
+		color.Yellow("   -" + gud.GenerateRandomString(32))
+	case "rotate":
+		return doKeyRotate(arg4 != "--env-only")
+	default:
+		return errors.New("unknown key subcommand: " + arg3)
+	}
+	return nil
+}
+
+// doKeyRotate replaces KEY in the .env file with a new key, keeping the old one in
+// PREVIOUS_KEYS so existing values stay readable, then runs the application with
+// GUDU_KEY_ROTATE set so the callbacks registered with gudu.OnKeyRotate re-encrypt
+// the stored values
+func doKeyRotate(reencrypt bool) error {
+	envPath := filepath.Join(gud.RootPath, ".env")
+	content, err := os.ReadFile(envPath)
+	if err != nil {
+		return err
+	}
+
+	oldKey := os.Getenv("KEY")
+	if oldKey == "" {
+		return errors.New("there is no KEY in .env to rotate")
+	}
+	previous := []string{oldKey}
+	for _, key := range strings.Split(os.Getenv("PREVIOUS_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" && key != oldKey {
+			previous = append(previous, key)
+		}
+	}
+
+	env := setEnvValue(string(content), "KEY", gud.GenerateRandomString(32))
+	env = setEnvValue(env, "PREVIOUS_KEYS", strings.Join(previous, ","))
+	if err := os.WriteFile(envPath, []byte(env), 0600); err != nil {
+		return err
+	}
+	color.Yellow("   -KEY rotated, the previous key was added to PREVIOUS_KEYS")
+
+	if !reencrypt {
+		return nil
+	}
+	color.Yellow("   -running the application to re-encrypt the stored values....")
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = gud.RootPath
+	cmd.Env = append(os.Environ(), "GUDU_KEY_ROTATE=1")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("re-encryption failed, the old key is still accepted from PREVIOUS_KEYS: %w", err)
+	}
+	color.Yellow("   -once every value is re-encrypted, the old key can be removed from PREVIOUS_KEYS")
+	return nil
+}
+
+// setEnvValue sets a variable of a .env file, appending it when missing
+func setEnvValue(env, name, value string) string {
+	line := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(name) + `=.*$`)
+	if line.MatchString(env) {
+		return line.ReplaceAllLiteralString(env, name+"="+value)
+	}
+	if env != "" && !strings.HasSuffix(env, "\n") {
+		env += "\n"
+	}
+	return env + name + "=" + value + "\n"
+}
@@ -41,6 +41,22 @@ func main() {
 		if err != nil {
 			exitGracefully(err)
 		}
+	case "assets":
+		if arg3 == "" {
+			exitGracefully(errors.New("assets required a subcommand: (build)"))
+		}
+		err = doAssets(arg3, arg4)
+		if err != nil {
+			exitGracefully(err)
+		}
+	case "key":
+		if arg3 == "" {
+			exitGracefully(errors.New("key required a subcommand: (generate|rotate)"))
+		}
+		err = doKey(arg3, arg4)
+		if err != nil {
+			exitGracefully(err)
+		}
 	case "migrate":
 		//push the migration files to the database
 		// migrate up as the default setting
@@ -30,6 +30,31 @@ func doMake(arg3, arg4 string) error {
 		if err != nil {
 			exitGracefully(err)
 		}
+	case "password-resets":
+		err := doPasswordResetsTable()
+		if err != nil {
+			exitGracefully(err)
+		}
+	case "verification":
+		err := doEmailVerification()
+		if err != nil {
+			exitGracefully(err)
+		}
+	case "rbac":
+		err := doRBACTables()
+		if err != nil {
+			exitGracefully(err)
+		}
+	case "two-factor":
+		err := doTwoFactor()
+		if err != nil {
+			exitGracefully(err)
+		}
+	case "password-column":
+		err := doPasswordColumn()
+		if err != nil {
+			exitGracefully(err)
+		}
 	}
 
 	return nil
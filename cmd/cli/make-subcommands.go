@@ -25,7 +25,7 @@ func doAuth() error {
 		exitGracefully(err)
 	}
 
-	err = copyDataToFile([]byte("drop table if exists users cascade; drop table if exists tokens cascade; drop table if exists remember_tokens;"), targetDownFilePath)
+	err = copyDataToFile([]byte("drop table if exists password_resets; drop table if exists users cascade; drop table if exists tokens cascade; drop table if exists remember_tokens;"), targetDownFilePath)
 	if err != nil {
 		exitGracefully(err)
 	}
@@ -58,13 +58,21 @@ func doAuth() error {
 		exitGracefully(err)
 	}
 
+	// copy the password reset and email verification mails
+	err = copyMails("password-reset", "verify-email")
+	if err != nil {
+		exitGracefully(err)
+	}
+
 	//display message feedback to end users
-	color.Yellow("   -users, tokens and remember_tokens migration created and executed")
+	color.Yellow("   -users, tokens, remember_tokens and password_resets migration created and executed")
 	color.Yellow("   -user and token models created!!")
-	color.Yellow("   -auth middleware created!!")
+	color.Yellow("   -auth middleware, password reset and email verification mails created!!")
 	color.Yellow("")
-	color.Red("   -dont forget to add user and token models in data/models.go" +
+	color.Red("   -dont forget to add user and token models in data/models.go " +
 		"and add appropriate middleware to your routes")
+	color.Red("   -route POST /login and /logout to the Auth.LoginHandler and Auth.LogoutHandler of gudu, " +
+		"the login form posts the email, password and remember fields")
 
 	return nil
 }
@@ -204,3 +212,285 @@ func doSessionTable() error {
 
 	return nil
 }
+
+// doPasswordResetsTable build the subcommand for the password reset tokens table of apps
+// created before it was part of make auth
+func doPasswordResetsTable() error {
+	dbType := gud.DBConnection.DatabaseType
+
+	// configuring database type
+	switch dbType {
+	case "postgres", "postgresql":
+		dbType = "postgres"
+
+	case "mysql", "mariadb":
+		dbType = "mysql"
+	}
+
+	fileName := fmt.Sprintf("%d_create_password_resets_table", time.Now().UnixMicro())
+
+	targetUpFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
+
+	targetDownFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
+
+	err := copyFilesFromTemplate("templates/migrations/password_resets_table."+dbType+".sql", targetUpFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	err = copyDataToFile([]byte("drop table if exists password_resets"), targetDownFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	//run up migration by adding migrate command directly
+	err = doMigrate("up", "")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	err = copyMails("password-reset")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	color.Yellow("   -password_resets migration created and executed, reset mails created in mails")
+	color.Red("   -route POST /forgot-password and /reset-password to the ForgotPassword and ResetPassword " +
+		"handlers of gudu, and protect the GET /reset-password page with ValidateSignature")
+
+	return nil
+}
+
+// doEmailVerification build the subcommand adding the email_verified_at column to the
+// users table of apps created before it was part of make auth
+func doEmailVerification() error {
+	dbType := gud.DBConnection.DatabaseType
+
+	// configuring database type
+	switch dbType {
+	case "postgres", "postgresql":
+		dbType = "postgres"
+
+	case "mysql", "mariadb":
+		dbType = "mysql"
+	}
+
+	fileName := fmt.Sprintf("%d_add_email_verified_at_to_users", time.Now().UnixMicro())
+
+	targetUpFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
+
+	targetDownFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
+
+	err := copyFilesFromTemplate("templates/migrations/email_verification."+dbType+".sql", targetUpFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	err = copyDataToFile([]byte("alter table users drop column email_verified_at"), targetDownFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	//run up migration by adding migrate command directly
+	err = doMigrate("up", "")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	err = copyMails("verify-email")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	color.Yellow("   -email_verified_at migration created and executed, verification mails created in mails")
+	color.Red("   -add the EmailVerifiedAt field to the User model, route GET /verify-email/confirm to the " +
+		"VerifyEmail handler of gudu and protect pages with Auth.RequireVerified")
+
+	return nil
+}
+
+// doRBACTables build the subcommand for the roles, permissions, role_permissions and
+// user_roles tables read by the authorization gate
+func doRBACTables() error {
+	dbType := gud.DBConnection.DatabaseType
+
+	// configuring database type
+	switch dbType {
+	case "postgres", "postgresql":
+		dbType = "postgres"
+
+	case "mysql", "mariadb":
+		dbType = "mysql"
+	}
+
+	fileName := fmt.Sprintf("%d_create_rbac_tables", time.Now().UnixMicro())
+
+	targetUpFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
+
+	targetDownFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
+
+	err := copyFilesFromTemplate("templates/migrations/rbac_tables."+dbType+".sql", targetUpFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	err = copyDataToFile([]byte("drop table if exists user_roles; drop table if exists role_permissions; "+
+		"drop table if exists permissions; drop table if exists roles;"), targetDownFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	//run up migration by adding migrate command directly
+	err = doMigrate("up", "")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	color.Yellow("   -roles, permissions, role_permissions and user_roles migration created and executed")
+	color.Red("   -assign roles and permissions with app.Authz.AssignRole and app.Authz.GrantPermission, " +
+		"and guard routes with app.Can(\"permission\")")
+
+	return nil
+}
+
+// doTwoFactor build the subcommand adding the two-factor columns to the users table and
+// the challenge and settings views of two-factor authentication
+func doTwoFactor() error {
+	dbType := gud.DBConnection.DatabaseType
+
+	// configuring database type
+	switch dbType {
+	case "postgres", "postgresql":
+		dbType = "postgres"
+
+	case "mysql", "mariadb":
+		dbType = "mysql"
+	}
+
+	fileName := fmt.Sprintf("%d_add_two_factor_to_users", time.Now().UnixMicro())
+
+	targetUpFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
+
+	targetDownFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
+
+	err := copyFilesFromTemplate("templates/migrations/two_factor."+dbType+".sql", targetUpFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	down := "alter table users drop column two_factor_secret;\n" +
+		"alter table users drop column two_factor_recovery_codes;\n" +
+		"alter table users drop column two_factor_confirmed_at;\n"
+	err = copyDataToFile([]byte(down), targetDownFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	//run up migration by adding migrate command directly
+	err = doMigrate("up", "")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	err = copyViews("two-factor-challenge", "two-factor")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	// the application only reads the new columns once two-factor authentication is on
+	envPath := gud.RootPath + "/.env"
+	env, err := os.ReadFile(envPath)
+	if err != nil {
+		exitGracefully(err)
+	}
+	err = os.WriteFile(envPath, []byte(setEnvValue(string(env), "AUTH_TWO_FACTOR", "true")), 0600)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	color.Yellow("   -two_factor columns migration created and executed, two-factor views created in views, AUTH_TWO_FACTOR set in .env")
+	color.Red("   -route POST /two-factor-challenge to the TwoFactorChallenge handler of gudu and the " +
+		"/user/two-factor routes to EnableTwoFactor, ConfirmTwoFactor, RegenerateRecoveryCodes and " +
+		"DisableTwoFactor; render the two-factor view with app.TwoFactorSetup(r) as twoFactor")
+
+	return nil
+}
+
+// doPasswordColumn build the subcommand widening users.password for argon2id hashes, for
+// apps made before make auth created the wider column
+func doPasswordColumn() error {
+	dbType := gud.DBConnection.DatabaseType
+
+	// configuring database type
+	switch dbType {
+	case "postgres", "postgresql":
+		dbType = "postgres"
+
+	case "mysql", "mariadb":
+		dbType = "mysql"
+	}
+
+	fileName := fmt.Sprintf("%d_widen_users_password", time.Now().UnixMicro())
+
+	targetUpFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
+
+	targetDownFilePath := gud.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
+
+	err := copyFilesFromTemplate("templates/migrations/password_column."+dbType+".sql", targetUpFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	// argon2id hashes do not fit the old 60 characters, the wider column is kept
+	err = copyDataToFile([]byte("-- the password column stays wide enough for argon2id hashes\n"), targetDownFilePath)
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	//run up migration by adding migrate command directly
+	err = doMigrate("up", "")
+	if err != nil {
+		exitGracefully(err)
+	}
+
+	color.Yellow("   -users.password widened to 255 characters, HASH_DRIVER=argon2id can be used")
+
+	return nil
+}
+
+// copyViews copies the named pages to the views folder for the RENDERER engine, keeping
+// pages that exist already
+func copyViews(names ...string) error {
+	for _, name := range names {
+		source := "templates/views/" + name + ".jet"
+		target := gud.RootPath + "/views/" + name + ".jet"
+		if strings.ToLower(os.Getenv("RENDERER")) == "go" {
+			source = "templates/views/" + name + ".gohtml"
+			target = gud.RootPath + "/views/pages/" + name + ".gohtml"
+		}
+		if fileExists(target) {
+			continue
+		}
+		if err := copyFilesFromTemplate(source, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyMails copies the html and plain text versions of the named mails, keeping
+// existing ones
+func copyMails(names ...string) error {
+	for _, name := range names {
+		for _, version := range []string{".html.gohtml", ".plain.gohtml"} {
+			target := gud.RootPath + "/mails/" + name + version
+			if fileExists(target) {
+				continue
+			}
+			if err := copyFilesFromTemplate("templates/mails/"+name+version, target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
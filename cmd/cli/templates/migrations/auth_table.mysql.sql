@@ -6,7 +6,11 @@ CREATE TABLE `users` (
                          `last_name` varchar(255) CHARACTER SET utf8 COLLATE utf8_unicode_ci NOT NULL,
                          `user_active` int(11) NOT NULL,
                          `email` varchar(255) CHARACTER SET utf8 COLLATE utf8_unicode_ci NOT NULL,
-                         `password` char(60) CHARACTER SET utf8 COLLATE utf8_unicode_ci NOT NULL,
+                         `password` varchar(255) CHARACTER SET utf8 COLLATE utf8_unicode_ci NOT NULL,
+                         `email_verified_at` timestamp NULL DEFAULT NULL,
+                         `two_factor_secret` text DEFAULT NULL,
+                         `two_factor_recovery_codes` text DEFAULT NULL,
+                         `two_factor_confirmed_at` timestamp NULL DEFAULT NULL,
                          `created_at` timestamp NULL DEFAULT NULL,
                          `updated_at` timestamp NULL DEFAULT NULL,
                          PRIMARY KEY (`id`),
@@ -42,4 +46,18 @@ CREATE TABLE `tokens` (
       `expiry` datetime NOT NULL,
       PRIMARY KEY (`id`),
       FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE cascade ON DELETE cascade
-) ENGINE=InnoDB AUTO_INCREMENT=30 DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
+) ENGINE=InnoDB AUTO_INCREMENT=30 DEFAULT CHARSET=utf8mb4;
+
+drop table if exists password_resets cascade;
+
+CREATE TABLE `password_resets` (
+       `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+       `user_id` int(10) unsigned NOT NULL,
+       `token_hash` varchar(64) NOT NULL,
+       `expires_at` datetime NOT NULL,
+       `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `password_resets_token_hash_unique` (`token_hash`),
+       KEY `password_resets_user_id_foreign` (`user_id`),
+       CONSTRAINT `password_resets_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
@@ -14,7 +14,11 @@ CREATE TABLE users (
    last_name character varying(255) NOT NULL,
    user_active integer NOT NULL DEFAULT 0,
    email character varying(255) NOT NULL UNIQUE,
-   password character varying(60) NOT NULL,
+   password character varying(255) NOT NULL,
+   email_verified_at timestamp without time zone NULL,
+   two_factor_secret text NULL,
+   two_factor_recovery_codes text NULL,
+   two_factor_confirmed_at timestamp without time zone NULL,
    created_at timestamp without time zone NOT NULL DEFAULT now(),
    updated_at timestamp without time zone NOT NULL DEFAULT now()
 );
@@ -56,4 +60,16 @@ CREATE TABLE tokens (
 CREATE TRIGGER set_timestamp
     BEFORE UPDATE ON tokens
     FOR EACH ROW
-    EXECUTE PROCEDURE trigger_set_timestamp();
\ No newline at end of file
+    EXECUTE PROCEDURE trigger_set_timestamp();
+
+drop table if exists password_resets;
+
+CREATE TABLE password_resets (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    token_hash character varying(64) NOT NULL UNIQUE,
+    expires_at timestamp without time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
\ No newline at end of file
@@ -0,0 +1 @@
+alter table `users` add column `email_verified_at` timestamp NULL DEFAULT NULL after `password`;
@@ -0,0 +1 @@
+alter table `users` modify `password` varchar(255) CHARACTER SET utf8 COLLATE utf8_unicode_ci NOT NULL;
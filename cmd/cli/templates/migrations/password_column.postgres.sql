@@ -0,0 +1 @@
+alter table users alter column password type character varying(255);
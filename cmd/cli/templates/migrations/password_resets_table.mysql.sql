@@ -0,0 +1,13 @@
+drop table if exists password_resets cascade;
+
+CREATE TABLE `password_resets` (
+       `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+       `user_id` int(10) unsigned NOT NULL,
+       `token_hash` varchar(64) NOT NULL,
+       `expires_at` datetime NOT NULL,
+       `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `password_resets_token_hash_unique` (`token_hash`),
+       KEY `password_resets_user_id_foreign` (`user_id`),
+       CONSTRAINT `password_resets_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
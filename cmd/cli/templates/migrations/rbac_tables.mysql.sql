@@ -0,0 +1,40 @@
+drop table if exists user_roles cascade;
+drop table if exists role_permissions cascade;
+drop table if exists permissions cascade;
+drop table if exists roles cascade;
+
+CREATE TABLE `roles` (
+       `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+       `name` varchar(255) NOT NULL,
+       `created_at` timestamp NULL DEFAULT NULL,
+       `updated_at` timestamp NULL DEFAULT NULL,
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `roles_name_unique` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `permissions` (
+       `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+       `name` varchar(255) NOT NULL,
+       `created_at` timestamp NULL DEFAULT NULL,
+       `updated_at` timestamp NULL DEFAULT NULL,
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `permissions_name_unique` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `role_permissions` (
+       `role_id` int(10) unsigned NOT NULL,
+       `permission_id` int(10) unsigned NOT NULL,
+       PRIMARY KEY (`role_id`, `permission_id`),
+       KEY `role_permissions_permission_id_foreign` (`permission_id`),
+       CONSTRAINT `role_permissions_role_id_foreign` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`) ON DELETE CASCADE ON UPDATE CASCADE,
+       CONSTRAINT `role_permissions_permission_id_foreign` FOREIGN KEY (`permission_id`) REFERENCES `permissions` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `user_roles` (
+       `user_id` int(10) unsigned NOT NULL,
+       `role_id` int(10) unsigned NOT NULL,
+       PRIMARY KEY (`user_id`, `role_id`),
+       KEY `user_roles_role_id_foreign` (`role_id`),
+       CONSTRAINT `user_roles_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE,
+       CONSTRAINT `user_roles_role_id_foreign` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+alter table `users` add column `two_factor_secret` text DEFAULT NULL after `password`;
+alter table `users` add column `two_factor_recovery_codes` text DEFAULT NULL after `two_factor_secret`;
+alter table `users` add column `two_factor_confirmed_at` timestamp NULL DEFAULT NULL after `two_factor_recovery_codes`;
@@ -0,0 +1,3 @@
+alter table users add column two_factor_secret text NULL;
+alter table users add column two_factor_recovery_codes text NULL;
+alter table users add column two_factor_confirmed_at timestamp without time zone NULL;
@@ -1,6 +1,7 @@
 package gudu
 
 import (
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"net/http"
@@ -13,13 +14,48 @@ func (g *Gudu) defaultRouter() http.Handler {
 	// A good base middleware stack
 	mux.Use(middleware.RequestID)
 	mux.Use(middleware.RealIP)
+	if len(g.config.cors.AllowedOrigins) > 0 || len(g.config.cors.AllowedOriginPatterns) > 0 {
+		mux.Use(g.CORS())
+	}
 	if g.DebugMode {
 		mux.Use(middleware.Logger)
 	}
-	mux.Use(middleware.Recoverer)
+	mux.Use(g.Recoverer)
+	mux.Use(g.SecurityHeaders())
+	mux.Use(g.ConditionalGet)
+	if g.config.compress {
+		mux.Use(g.Compress())
+	}
 
 	// developer default middleware
 	mux.Use(g.SessionLoadAndSave)
 
+	// the routes of the package are added by Handler, after the routes of the
+	// application: chi refuses Use once a route is registered
 	return mux
 }
+
+// packageRoutes registers the routes the package serves itself: the CSP report
+// endpoint and the public directory
+func (g *Gudu) packageRoutes() {
+	if g.config.security.CSPReportPath != "" {
+		g.Router.Post(g.config.security.CSPReportPath, g.CSPReportHandler)
+	}
+	if g.config.static.url != "" {
+		g.Router.Handle(g.config.static.url+"/*", g.StaticHandler())
+	}
+}
+
+// Handler returns Router with the routes of the package added, call it once the
+// middlewares and routes of the application are registered. It fails on an invalid
+// routing table, e.g. duplicate route names. ListenAndServe serves it, use it for
+// custom servers and tests.
+func (g *Gudu) Handler() (http.Handler, error) {
+	if g.Routes != nil {
+		if err := g.Routes.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid routes: %w", err)
+		}
+	}
+	g.packageRoutesOnce.Do(g.packageRoutes)
+	return g.Router, nil
+}
@@ -0,0 +1,99 @@
+package gudu
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+)
+
+// testGudu returns a Gudu with the default configuration of a generated application
+func testGudu(t *testing.T) *Gudu {
+	t.Helper()
+	t.Setenv("CSP_REPORT_PATH", "/csp-report")
+	g := &Gudu{
+		Sessions: scs.New(),
+		InfoLog:  log.New(io.Discard, "", 0),
+		ErrorLog: log.New(io.Discard, "", 0),
+		RootPath: t.TempDir(),
+	}
+	g.config.security = loadSecurityHeadersConfig()
+	g.config.static = loadStaticConfig()
+	return g
+}
+
+func TestDefaultRouterWithCSPReports(t *testing.T) {
+	g := testGudu(t)
+	g.Router = g.defaultRouter().(*chi.Mux)
+	mux, err := g.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := `{"csp-report": {"document-uri": "https://example.com", "violated-directive": "script-src"}}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(report)))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("csp report = %d, want 204", w.Code)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("the report endpoint runs behind the middleware stack")
+	}
+}
+
+func TestDefaultRouterAcceptsApplicationMiddleware(t *testing.T) {
+	g := testGudu(t)
+	g.Router = g.defaultRouter().(*chi.Mux)
+	g.Routes = NewRoutes(g.Router)
+	if err := os.MkdirAll(filepath.Join(g.RootPath, "public"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(g.RootPath, "public", "app.css"), []byte("body{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// middlewares of the application come after the default stack
+	g.Router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-App", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	g.Routes.Use(func(next http.Handler) http.Handler { return next })
+	g.Routes.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	handler, err := g.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/app.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" {
+		t.Errorf("static file = %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-App") != "1" {
+		t.Error("static files run behind the middlewares of the application")
+	}
+	if again, _ := g.Handler(); again != handler {
+		t.Error("Handler adds the routes of the package once")
+	}
+}
+
+func TestHandlerRejectsDuplicateRouteNames(t *testing.T) {
+	g := testGudu(t)
+	g.Router = g.defaultRouter().(*chi.Mux)
+	g.Routes = NewRoutes(g.Router)
+	g.Routes.Get("/users", func(w http.ResponseWriter, r *http.Request) {}).Name("users")
+	g.Routes.Get("/people", func(w http.ResponseWriter, r *http.Request) {}).Name("users")
+
+	if _, err := g.Handler(); err == nil || !strings.Contains(err.Error(), `duplicate route name "users"`) {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package gudu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deenikarim/gudu/auth"
+)
+
+// verificationConfig holds the email verification settings, read from the environment
+type verificationConfig struct {
+	url          string
+	subject      string
+	ttl          time.Duration
+	maxResends   int
+	resendWindow time.Duration
+}
+
+// loadVerificationConfig reads the email verification settings. AUTH_VERIFY_URL is
+// the route of VerifyEmail, relative URLs are resolved against SERVER_NAME; at most
+// AUTH_VERIFY_MAX_RESENDS links are mailed to a user per AUTH_VERIFY_RESEND_WINDOW.
+func loadVerificationConfig() verificationConfig {
+	config := verificationConfig{
+		url:          getEnvOrDefault("AUTH_VERIFY_URL", "/verify-email/confirm"),
+		subject:      getEnvOrDefault("AUTH_VERIFY_SUBJECT", "Verify your email address"),
+		ttl:          envDuration("AUTH_VERIFY_TTL"),
+		resendWindow: envDuration("AUTH_VERIFY_RESEND_WINDOW"),
+	}
+	config.maxResends, _ = strconv.Atoi(os.Getenv("AUTH_VERIFY_MAX_RESENDS"))
+	if config.ttl <= 0 {
+		config.ttl = 24 * time.Hour
+	}
+	if config.maxResends <= 0 {
+		config.maxResends = 3
+	}
+	if config.resendWindow <= 0 {
+		config.resendWindow = 10 * time.Minute
+	}
+	return config
+}
+
+// SendEmailVerification mails a signed verification link to the email address of the
+// user, unless it is verified already; call it after registering a user
+func (g *Gudu) SendEmailVerification(ctx context.Context, user auth.User) error {
+	if g.Auth.Verifier == nil {
+		return errors.New("email verification needs a database or an auth.EmailVerifier")
+	}
+	email, verified, err := g.Auth.Verifier.EmailVerified(ctx, user.AuthID())
+	if err != nil || verified {
+		return err
+	}
+	return g.sendVerificationLink(user.AuthID(), email, email)
+}
+
+// ChangeEmail starts an email change: a verification link is mailed to the new
+// address, which replaces the current one when the link is opened. Until then the
+// user keeps logging in with the current address. Taken addresses fail with a 422.
+func (g *Gudu) ChangeEmail(ctx context.Context, user auth.User, email string) error {
+	if g.Auth.Verifier == nil {
+		return errors.New("email verification needs a database or an auth.EmailVerifier")
+	}
+	email = strings.TrimSpace(email)
+	if err := g.Auth.CheckEmailChange(ctx, user.AuthID(), email); err != nil {
+		if errors.Is(err, auth.ErrEmailTaken) {
+			return ValidationErrors{"email": {"This email address is already taken."}}
+		}
+		return err
+	}
+	current, _, err := g.Auth.Verifier.EmailVerified(ctx, user.AuthID())
+	if err != nil {
+		return err
+	}
+	return g.sendVerificationLink(user.AuthID(), email, current)
+}
+
+// sendVerificationLink mails the link verifying email for the user whose address is
+// current
+func (g *Gudu) sendVerificationLink(userID, email, current string) error {
+	config := g.config.verification
+	params := url.Values{"id": {userID}, "email": {email}, "from": {auth.EmailStamp(current)}}
+	link, err := g.SignedURL(g.absoluteURL(config.url), params, config.ttl)
+	if err != nil {
+		return err
+	}
+	return g.sendAuthMail(email, config.subject, "verify-email", map[string]interface{}{
+		"Email":   email,
+		"Link":    link,
+		"Change":  !strings.EqualFold(email, current),
+		"Expires": expiryText(config.ttl),
+	})
+}
+
+// expiryText describes a link lifetime for mails, e.g. "24 hours"
+func expiryText(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		if hours := int(ttl / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d minutes", int(ttl/time.Minute))
+}
+
+// VerifyEmail handles the signed links of the verification mails, register it with
+// Gudu.Handle on the route of AUTH_VERIFY_URL:
+//
+//	mux.Get("/verify-email/confirm", app.Handle(app.VerifyEmail))
+//
+// The email address of the link is recorded as verified, replacing the address of
+// the user for email changes. Browsers are redirected to AUTH_HOME_PATH with a
+// "status" message, APIs get 200. Expired, tampered or outdated links get a 403.
+func (g *Gudu) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	if err := g.VerifySignedURL(r.URL); err != nil {
+		return signatureProblem(err)
+	}
+	query := r.URL.Query()
+	err := g.Auth.VerifyEmail(r.Context(), query.Get("id"), query.Get("email"), query.Get("from"))
+	switch {
+	case errors.Is(err, auth.ErrVerificationMismatch), errors.Is(err, auth.ErrUserNotFound):
+		return NewProblem(http.StatusForbidden, "This link is outdated.")
+	case errors.Is(err, auth.ErrEmailTaken):
+		return NewProblem(http.StatusConflict, "This email address is already taken.")
+	case err != nil:
+		return err
+	}
+	return g.authFormStatus(w, r, http.StatusOK, "Your email address has been verified.", g.Auth.Config().HomePath)
+}
+
+// ResendEmailVerification handles the resend button of the verification notice for
+// logged-in users, register it with Gudu.Handle:
+//
+//	mux.With(app.Auth.RequireWeb).Post("/verify-email/resend", app.Handle(app.ResendEmailVerification))
+//
+// Resends are throttled per user, see AUTH_VERIFY_MAX_RESENDS.
+func (g *Gudu) ResendEmailVerification(w http.ResponseWriter, r *http.Request) error {
+	user, err := g.Auth.User(r)
+	if err != nil {
+		return NewProblem(http.StatusUnauthorized, "")
+	}
+	if err := g.throttleVerificationMail(w, r, user); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := g.SendEmailVerification(context.Background(), user); err != nil && g.ErrorLog != nil {
+			g.ErrorLog.Println("email verification:", err)
+		}
+	}()
+	return g.authFormStatus(w, r, http.StatusAccepted, "A new verification link has been sent to your email address.", backURL(r))
+}
+
+// RequestEmailChange handles the change email form of logged-in users, register it
+// with Gudu.Handle behind RequireWeb. The email field must be a free address; the
+// change completes when the link mailed to it is opened.
+func (g *Gudu) RequestEmailChange(w http.ResponseWriter, r *http.Request) error {
+	user, err := g.Auth.User(r)
+	if err != nil {
+		return NewProblem(http.StatusUnauthorized, "")
+	}
+	var input struct {
+		Email string `json:"email" xml:"email" form:"email" validate:"required;email"`
+	}
+	if err := g.Bind(r, &input); err != nil {
+		return g.authFormError(w, r, err)
+	}
+	if err := g.throttleVerificationMail(w, r, user); err != nil {
+		return err
+	}
+	if err := g.ChangeEmail(r.Context(), user, input.Email); err != nil {
+		return g.authFormError(w, r, err)
+	}
+	return g.authFormStatus(w, r, http.StatusAccepted,
+		"A verification link has been sent to your new email address, it replaces the current one once you open it.", backURL(r))
+}
+
+// throttleVerificationMail counts a verification mail of the user, returning a 429
+// problem once the user has reached AUTH_VERIFY_MAX_RESENDS
+func (g *Gudu) throttleVerificationMail(w http.ResponseWriter, r *http.Request, user auth.User) error {
+	key := "verify:" + user.AuthID()
+	wait, err := g.verifyThrottle.Locked(key)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)))
+		return NewProblem(http.StatusTooManyRequests, "Too many verification mails, please try again later.").
+			With("retry_after", int(wait.Seconds()))
+	}
+	_, err = g.verifyThrottle.Hit(key)
+	return err
+}
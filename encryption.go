@@ -0,0 +1,239 @@
+package gudu
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ciphertextVersion prefixes ciphertexts of the authenticated format,
+// v2:{key id}:{base64url nonce and sealed text}; legacy AES-CFB ciphertexts are plain
+// base64
+const ciphertextVersion = "v2"
+
+var (
+	// ErrUnknownKey is returned for ciphertexts sealed with a key missing from the
+	// keyring
+	ErrUnknownKey = errors.New("encryption: ciphertext was sealed with an unknown key")
+	// ErrDecrypt is returned for ciphertexts that were modified or are malformed
+	ErrDecrypt = errors.New("encryption: message authentication failed")
+	// ErrLegacyCiphertext is returned for legacy AES-CFB ciphertexts when no
+	// LegacyKey is configured
+	ErrLegacyCiphertext = errors.New("encryption: legacy ciphertext needs LEGACY_KEY")
+)
+
+// Encryption encrypts values with AES-GCM, so modified ciphertexts are rejected. Key
+// is the current key and PreviousKeys the retired keys still accepted for decryption
+// while stored values are re-encrypted, see Reencrypt and Gudu.RotateKeys. Keys are
+// 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256. LegacyKey is the key
+// the AES-CFB values of earlier versions were encrypted with; they are only decrypted
+// with it, as the format can not tell a wrong key from a right one.
+type Encryption struct {
+	Key          []byte
+	PreviousKeys [][]byte
+	LegacyKey    []byte
+}
+
+// NewEncryption creates an Encryption with the current and previous keys
+func NewEncryption(key string, previousKeys ...string) *Encryption {
+	e := &Encryption{Key: []byte(key)}
+	for _, previous := range previousKeys {
+		e.PreviousKeys = append(e.PreviousKeys, []byte(previous))
+	}
+	return e
+}
+
+// Encrypter returns an Encryption with the application KEY, PREVIOUS_KEYS and
+// LEGACY_KEY
+func (g *Gudu) Encrypter() *Encryption {
+	e := NewEncryption(g.EncryptionKey, g.PreviousKeys...)
+	if g.LegacyKey != "" {
+		e.LegacyKey = []byte(g.LegacyKey)
+	}
+	return e
+}
+
+// Encrypt function encrypts the plaintext with the current key and returns the
+// versioned ciphertext, which records the id of the key
+func (e *Encryption) Encrypt(text string) (string, error) {
+	aead, err := newGCM(e.Key)
+	if err != nil {
+		return "", err
+	}
+
+	// Fill a fresh nonce with random bytes, it is stored in front of the sealed text
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(text)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	header := ciphertextVersion + ":" + keyID(e.Key)
+	sealed := aead.Seal(nonce, nonce, []byte(text), []byte(header))
+	return header + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt function decrypts a ciphertext made by Encrypt with the key it names.
+// Legacy AES-CFB ciphertexts are decrypted with LegacyKey for migration, they carry no
+// key id nor authentication; without LegacyKey they return ErrLegacyCiphertext.
+func (e *Encryption) Decrypt(ciphertext string) (string, error) {
+	version, rest, found := strings.Cut(ciphertext, ":")
+	if !found {
+		return e.decryptLegacy(ciphertext)
+	}
+	if version != ciphertextVersion {
+		return "", fmt.Errorf("encryption: unsupported ciphertext version %q", version)
+	}
+	id, payload, found := strings.Cut(rest, ":")
+	if !found {
+		return "", ErrDecrypt
+	}
+
+	key := e.keyByID(id)
+	if key == nil {
+		return "", ErrUnknownKey
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(version+":"+id))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReencrypt reports whether a ciphertext is legacy or sealed with a previous key
+func (e *Encryption) NeedsReencrypt(ciphertext string) bool {
+	return !strings.HasPrefix(ciphertext, ciphertextVersion+":"+keyID(e.Key)+":")
+}
+
+// Reencrypt decrypts a ciphertext with any known key and encrypts it with the current
+// key; ciphertexts already sealed with the current key are returned unchanged
+func (e *Encryption) Reencrypt(ciphertext string) (string, error) {
+	if !e.NeedsReencrypt(ciphertext) {
+		return ciphertext, nil
+	}
+	plaintext, err := e.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return e.Encrypt(plaintext)
+}
+
+// keyByID returns the current or previous key with the id
+func (e *Encryption) keyByID(id string) []byte {
+	for _, key := range append([][]byte{e.Key}, e.PreviousKeys...) {
+		if len(key) > 0 && keyID(key) == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// decryptLegacy decrypts the AES-CFB format of earlier versions with LegacyKey. Any key
+// "decrypts" it, so text that is not valid UTF-8 is the only sign of a wrong key.
+func (e *Encryption) decryptLegacy(ciphertext string) (string, error) {
+	if len(e.LegacyKey) == 0 {
+		return "", ErrLegacyCiphertext
+	}
+	ciphertextBytes, err := base64.URLEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertextBytes) < aes.BlockSize {
+		return "", errors.New("ciphertext too short")
+	}
+	block, err := aes.NewCipher(e.LegacyKey)
+	if err != nil {
+		return "", fmt.Errorf("encryption: %w", err)
+	}
+
+	// the IV is stored in front of the encrypted text
+	iv, encrypted := ciphertextBytes[:aes.BlockSize], ciphertextBytes[aes.BlockSize:]
+	plaintext := make([]byte, len(encrypted))
+	cipher.NewCFBDecrypter(block, iv).XORKeyStream(plaintext, encrypted)
+	if !utf8.Valid(plaintext) {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// newGCM returns AES-GCM for the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyID identifies a key without revealing it, the first bytes of its SHA-256
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// deriveKey derives the key of one purpose from KEY, so what is signed with it reveals
+// nothing about KEY or the keys of other purposes
+func deriveKey(key, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// KeyRotationFunc re-encrypts stored values, e.g. the columns of a table, typically by
+// passing each of them through enc.Reencrypt
+type KeyRotationFunc func(g *Gudu, enc *Encryption) error
+
+// keyRotations are the callbacks run by RotateKeys
+var keyRotations []KeyRotationFunc
+
+// OnKeyRotate registers a callback re-encrypting stored values after KEY was rotated.
+// Register callbacks in an init function, so they are known when `gudu key rotate`
+// runs the application with GUDU_KEY_ROTATE set.
+func OnKeyRotate(fn KeyRotationFunc) {
+	keyRotations = append(keyRotations, fn)
+}
+
+// RotateKeys runs the registered key rotation callbacks with the application keys, so
+// values sealed with PREVIOUS_KEYS are sealed again with KEY
+func (g *Gudu) RotateKeys() error {
+	enc := g.Encrypter()
+	var errs []error
+	for _, fn := range keyRotations {
+		if err := fn(g, enc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runKeyRotation re-encrypts the stored values and exits when the application was
+// started by `gudu key rotate`
+func (g *Gudu) runKeyRotation() {
+	if os.Getenv("GUDU_KEY_ROTATE") == "" {
+		return
+	}
+	if err := g.RotateKeys(); err != nil {
+		g.ErrorLog.Println("key rotation failed:", err)
+		os.Exit(1)
+	}
+	g.InfoLog.Printf("key rotation complete, %d callbacks run", len(keyRotations))
+	os.Exit(0)
+}
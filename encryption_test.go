@@ -0,0 +1,108 @@
+package gudu
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey     = "0123456789abcdef0123456789abcdef"
+	previousKey = "fedcba9876543210fedcba9876543210"
+)
+
+// encryptLegacy encrypts text in the AES-CFB format of earlier versions
+func encryptLegacy(t *testing.T, key, text string) string {
+	t.Helper()
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := make([]byte, aes.BlockSize+len(text))
+	if _, err := rand.Read(ciphertext[:aes.BlockSize]); err != nil {
+		t.Fatal(err)
+	}
+	cipher.NewCFBEncrypter(block, ciphertext[:aes.BlockSize]).XORKeyStream(ciphertext[aes.BlockSize:], []byte(text))
+	return base64.URLEncoding.EncodeToString(ciphertext)
+}
+
+func TestEncryptionRejectsModifiedCiphertexts(t *testing.T) {
+	enc := NewEncryption(testKey)
+	sealed, err := enc.Encrypt("secret value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := enc.Decrypt(sealed); err != nil || plaintext != "secret value" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	// change a character of the sealed text, past the header and nonce
+	i := len(sealed) - 8
+	flipped := byte('A')
+	if sealed[i] == 'A' {
+		flipped = 'B'
+	}
+	if _, err := enc.Decrypt(sealed[:i] + string(flipped) + sealed[i+1:]); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("modified ciphertext: %v, want ErrDecrypt", err)
+	}
+	if _, err := NewEncryption(previousKey).Decrypt(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("other key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestEncryptionPreviousKeys(t *testing.T) {
+	sealed, _ := NewEncryption(previousKey).Encrypt("secret value")
+	enc := NewEncryption(testKey, previousKey)
+
+	if plaintext, err := enc.Decrypt(sealed); err != nil || plaintext != "secret value" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+	if !enc.NeedsReencrypt(sealed) {
+		t.Error("values sealed with a previous key need a re-encryption")
+	}
+	resealed, err := enc.Reencrypt(sealed)
+	if err != nil || enc.NeedsReencrypt(resealed) {
+		t.Fatalf("Reencrypt = %q, %v", resealed, err)
+	}
+	if plaintext, _ := NewEncryption(testKey).Decrypt(resealed); plaintext != "secret value" {
+		t.Error("re-encrypted values are sealed with the current key")
+	}
+}
+
+func TestEncryptionLegacyNeedsLegacyKey(t *testing.T) {
+	legacy := encryptLegacy(t, previousKey, "secret value")
+
+	// the current and previous keys are never tried on the unauthenticated format
+	enc := NewEncryption(testKey, previousKey)
+	if _, err := enc.Decrypt(legacy); !errors.Is(err, ErrLegacyCiphertext) {
+		t.Errorf("without LegacyKey: %v, want ErrLegacyCiphertext", err)
+	}
+	if _, err := enc.Reencrypt(legacy); !errors.Is(err, ErrLegacyCiphertext) {
+		t.Errorf("Reencrypt without LegacyKey: %v, want ErrLegacyCiphertext", err)
+	}
+
+	enc.LegacyKey = []byte(previousKey)
+	if plaintext, err := enc.Decrypt(legacy); err != nil || plaintext != "secret value" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+	resealed, err := enc.Reencrypt(legacy)
+	if err != nil || !strings.HasPrefix(resealed, ciphertextVersion+":") {
+		t.Fatalf("Reencrypt = %q, %v", resealed, err)
+	}
+	if plaintext, _ := NewEncryption(testKey).Decrypt(resealed); plaintext != "secret value" {
+		t.Error("legacy values are re-encrypted with the current key")
+	}
+
+	// a wrong legacy key is refused rather than yielding garbage, for text whose
+	// decryption is not valid UTF-8
+	wrong := NewEncryption(testKey)
+	wrong.LegacyKey = []byte(testKey)
+	long := encryptLegacy(t, previousKey, strings.Repeat("secret value ", 8))
+	if plaintext, err := wrong.Decrypt(long); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong LegacyKey = %q, %v, want ErrDecrypt", plaintext, err)
+	}
+}
@@ -105,9 +105,15 @@ func (g *Gudu) createLoggers() (*log.Logger, *log.Logger) {
 
 // ListenAndServe creates a web server listening on the given port and serving
 func (g *Gudu) ListenAndServe() {
+	// refuse to start with an invalid routing table, e.g. duplicate route names
+	handler, err := g.Handler()
+	if err != nil {
+		g.ErrorLog.Fatal(err)
+	}
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%s", os.Getenv("PORT")),
-		Handler:      g.Router,
+		Handler:      handler,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 600 * time.Second,
 		IdleTimeout:  30 * time.Second,
@@ -133,11 +139,19 @@ func (g *Gudu) createRenderer() {
 		RendererEngine:    g.config.renderer,
 		TemplatesRootPath: g.RootPath,
 		Port:              g.config.port,
+		Secure:            g.config.secure,
+		ServerName:        g.config.serverName,
 		JetViews:          g.JetViewsSetUp,
 		DevelopmentMode:   g.DebugMode,
 		Session:           g.Sessions,
+		Authorize:         g.canFunc,
 	}
 
+	// template functions shared by the go and jet engines
+	myRender.AddGlobalFunc("asset", g.Asset)
+	myRender.AddGlobalFunc("route", g.routeFunc)
+	myRender.AddGlobalFunc("paginate", PaginationLinks)
+
 	g.Render = myRender
 }
 
@@ -4,15 +4,24 @@ import (
 	"fmt"
 	"github.com/CloudyKit/jet/v6"
 	"github.com/alexedwards/scs/v2"
+	"github.com/deenikarim/gudu/assets"
+	"github.com/deenikarim/gudu/auth"
+	"github.com/deenikarim/gudu/authz"
 	"github.com/deenikarim/gudu/cache"
+	"github.com/deenikarim/gudu/hashing"
+	"github.com/deenikarim/gudu/jwt"
 	"github.com/deenikarim/gudu/mailer"
 	"github.com/deenikarim/gudu/mails"
+	"github.com/deenikarim/gudu/oauth"
 	"github.com/deenikarim/gudu/render"
 	"github.com/deenikarim/gudu/sessions"
+	"github.com/deenikarim/gudu/storage"
 	"github.com/go-chi/chi/v5"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 const version = "1.0.0"
@@ -21,23 +30,40 @@ var myRedisCache *cache.RedisCache
 var myBadgerCache *cache.BadgerCache
 
 type Gudu struct {
-	AppName       string
-	DebugMode     bool
-	Version       string
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	RootPath      string
-	Response      *Response
-	config        packageConfigs
-	DBConnection  DatabaseConn // database connection
-	Router        *chi.Mux
-	Render        *render.Render      // render engine
-	Sessions      *scs.SessionManager // session manager
-	JetViewsSetUp *jet.Set            // jet template engine
-	EncryptionKey string
-	Cache         cache.Cache
-	Mailer        mailer.Mailer
-	MailerMail    *mails.Mailer
+	AppName        string
+	DebugMode      bool
+	Version        string
+	InfoLog        *log.Logger
+	ErrorLog       *log.Logger
+	RootPath       string
+	Response       *Response
+	config         packageConfigs
+	DBConnection   DatabaseConn // database connection
+	Router         *chi.Mux
+	Routes         *Routes             // named routes over Router
+	Render         *render.Render      // render engine
+	Sessions       *scs.SessionManager // session manager
+	JetViewsSetUp  *jet.Set            // jet template engine
+	EncryptionKey  string
+	PreviousKeys   []string        // retired keys still accepted while rotating KEY
+	LegacyKey      string          // key of the AES-CFB values of earlier versions
+	Hasher         *hashing.Hasher // password hashing
+	JWT            *jwt.Manager    // json web tokens, nil unless JWT_ALGORITHM is set
+	Auth           *auth.Auth      // user authentication
+	Authz          *authz.Gate     // authorization gates, policies and roles
+	OAuth          *oauth.Client   // sign-in with oauth and openid connect providers
+	Cache          cache.Cache
+	Mailer         mailer.Mailer
+	MailerMail     *mails.Mailer
+	Assets         *assets.Manifest        // fingerprinted asset manifest
+	Disks          map[string]storage.Disk // file storage disks by name
+	errorStatuses  errorStatuses           // error to status mappings
+	imageVariants  imageVariants           // image variants of upload fields
+	corsGroups     corsGroups              // cors policies of route groups
+	verifyThrottle *auth.Throttle          // verification mails per user
+	resetThrottle  *auth.Throttle          // password reset mails per address and client
+
+	packageRoutesOnce sync.Once // adds the routes of the package, see Handler
 }
 
 // New is the main project setup
@@ -47,7 +73,7 @@ func (g *Gudu) New(currentRootPath string) error {
 		currentRootPath: currentRootPath,
 		folderNames: []string{
 			"controllers", "migrations", "views", "data", "public", "tmp", "log",
-			"middleware", "mails",
+			"middleware", "mails", "storage",
 		},
 	}
 	// initialize empty folders during project setup if they don't exist
@@ -58,7 +84,7 @@ func (g *Gudu) New(currentRootPath string) error {
 
 	twoFolder := initializedFoldersPath{
 		currentRootPath: currentRootPath + "/views/",
-		folderNames:     []string{"layouts", "pages"},
+		folderNames:     []string{"layouts", "pages", "errors"},
 	}
 	err = g.InitFolders(twoFolder)
 	if err != nil {
@@ -137,8 +163,6 @@ func (g *Gudu) New(currentRootPath string) error {
 	// populate fields in the Gudu struct type
 	g.DebugMode, _ = strconv.ParseBool(os.Getenv("DEBUG"))
 	g.Version = version
-	g.Router = g.defaultRouter().(*chi.Mux)
-	g.Mailer = g.createMailer()
 
 	// configuration settings for the package
 	g.config = packageConfigs{
@@ -161,7 +185,30 @@ func (g *Gudu) New(currentRootPath string) error {
 			password: os.Getenv("REDIS_PASSWORD"),
 			prefix:   os.Getenv("REDIS_PREFIX"),
 		},
+		cors:          loadCORSConfig(),
+		security:      loadSecurityHeadersConfig(),
+		compression:   loadCompressionConfig(),
+		bind:          loadBindConfig(),
+		uploads:       loadUploadConfig(),
+		storage:       loadStorageConfig(),
+		jwt:           loadJWTConfig(),
+		auth:          loadAuthConfig(),
+		passwordReset: loadPasswordResetConfig(),
+		verification:  loadVerificationConfig(),
+		twoFactor:     loadTwoFactorConfig(),
+		oauth:         loadOAuthProviders(),
+		static:        loadStaticConfig(),
+		serverName:    os.Getenv("SERVER_NAME"),
 	}
+	g.config.secure, _ = strconv.ParseBool(os.Getenv("SECURE"))
+	g.config.compress, _ = strconv.ParseBool(os.Getenv("COMPRESSION"))
+	g.config.etag = strings.ToLower(os.Getenv("ETAG"))
+	g.Response.ETagMode = g.config.etag
+	g.Response.Debug = g.DebugMode
+
+	g.Router = g.defaultRouter().(*chi.Mux)
+	g.Routes = NewRoutes(g.Router)
+	g.Mailer = g.createMailer()
 
 	// session management initialisation
 	populateSessionManager := sessions.Session{
@@ -183,6 +230,26 @@ func (g *Gudu) New(currentRootPath string) error {
 	// initialized and store the session in Gudu type
 	g.Sessions = populateSessionManager.InitSession()
 	g.EncryptionKey = os.Getenv("KEY")
+	g.PreviousKeys = splitEnvList("PREVIOUS_KEYS")
+	g.LegacyKey = os.Getenv("LEGACY_KEY")
+	g.Hasher = hashing.New(hashing.LoadOptions())
+	g.createAuth()
+	g.createAuthz()
+
+	// create the oauth client of the sign-in providers
+	if err = g.createOAuth(); err != nil {
+		return err
+	}
+
+	// create the json web token manager
+	if err = g.createJWT(); err != nil {
+		return err
+	}
+
+	// create the storage disks
+	if err = g.createDisks(); err != nil {
+		return err
+	}
 
 	//****************** jet render setup
 
@@ -197,8 +264,17 @@ func (g *Gudu) New(currentRootPath string) error {
 		g.JetViewsSetUp = jetSet
 	}
 
+	// load the asset manifest used by the asset template function
+	if err = g.loadAssetManifest(); err != nil {
+		errorLogger.Println("can not load asset manifest:", err)
+	}
+
 	// populate the render struct type with field values
 	g.createRenderer()
+	g.Response.Renderer = g.Render
+
+	// re-encrypt stored values when started by `gudu key rotate`
+	g.runKeyRotation()
 
 	// start the mail channel to listen for mails
 	go g.Mailer.ListenForMails()
@@ -0,0 +1,205 @@
+package gudu
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// debugSourceLines is the number of lines shown around the failing line
+const debugSourceLines = 6
+
+// debugFrame is a stack frame shown on the development error page
+type debugFrame struct {
+	Function    string
+	File        string
+	Line        int
+	Application bool
+}
+
+// debugSourceLine is a line of the source snippet
+type debugSourceLine struct {
+	Number  int
+	Code    string
+	Current bool
+}
+
+// debugPageData is the data of the development error page
+type debugPageData struct {
+	Status    int
+	Title     string
+	Error     string
+	ErrorType string
+	Nonce     string
+	Source    *debugFrame
+	Snippet   []debugSourceLine
+	Frames    []debugFrame
+	Method    string
+	URL       string
+	Route     string
+	Proto     string
+	Remote    string
+	RequestID string
+	Headers   [][2]string
+	Query     [][2]string
+	Version   string
+}
+
+// writeDebugPage writes the development error page: the error, the source around the
+// failing application code, the stack trace and the request details
+func (g *Gudu) writeDebugPage(w http.ResponseWriter, r *http.Request, problem *Problem, err error, stack []uintptr) {
+	data := debugPageData{
+		Status:    problem.Status,
+		Title:     problem.Title,
+		Error:     err.Error(),
+		ErrorType: fmt.Sprintf("%T", err),
+		Nonce:     g.CSPNonce(r),
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		Proto:     r.Proto,
+		Remote:    r.RemoteAddr,
+		RequestID: r.Header.Get("X-Request-Id"),
+		Version:   g.Version,
+	}
+	if pe, ok := err.(*panicError); ok {
+		data.ErrorType = fmt.Sprintf("panic(%T)", pe.value)
+	}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		data.Route = rctx.RoutePattern()
+	}
+
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			f := debugFrame{Function: frame.Function, File: frame.File, Line: frame.Line, Application: !isFrameworkFrame(frame.Function)}
+			data.Frames = append(data.Frames, f)
+			if data.Source == nil && f.Application {
+				data.Source = &data.Frames[len(data.Frames)-1]
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	if data.Source == nil && len(data.Frames) > 0 {
+		data.Source = &data.Frames[0]
+	}
+	if data.Source != nil {
+		source := *data.Source
+		data.Source = &source
+		data.Snippet = sourceSnippet(source.File, source.Line)
+	}
+
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+		if name == "Authorization" || name == "Cookie" {
+			value = "[hidden]"
+		}
+		data.Headers = append(data.Headers, [2]string{name, value})
+	}
+	sort.Slice(data.Headers, func(i, j int) bool { return data.Headers[i][0] < data.Headers[j][0] })
+	for name, values := range r.URL.Query() {
+		data.Query = append(data.Query, [2]string{name, strings.Join(values, ", ")})
+	}
+	sort.Slice(data.Query, func(i, j int) bool { return data.Query[i][0] < data.Query[j][0] })
+
+	w.Header().Set(contentType, "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(problem.Status)
+	if err := debugPageTemplate.Execute(w, data); err != nil && g.ErrorLog != nil {
+		g.ErrorLog.Println("can not render the debug error page:", err)
+	}
+}
+
+// sourceSnippet returns the lines of file around line
+func sourceSnippet(file string, line int) []debugSourceLine {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	var snippet []debugSourceLine
+	scanner := bufio.NewScanner(f)
+	for number := 1; scanner.Scan(); number++ {
+		if number < line-debugSourceLines {
+			continue
+		}
+		if number > line+debugSourceLines {
+			break
+		}
+		snippet = append(snippet, debugSourceLine{Number: number, Code: scanner.Text(), Current: number == line})
+	}
+	return snippet
+}
+
+// debugPageTemplate is the development error page
+var debugPageTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Title}}</title>
+<style nonce="{{.Nonce}}">
+body{margin:0;font:14px/1.5 system-ui,sans-serif;color:#1f2328;background:#f6f8fa}
+header{padding:24px 32px;background:#b42318;color:#fff}
+header h1{margin:0;font-size:22px}
+header p{margin:4px 0 0;opacity:.85;font-family:ui-monospace,monospace}
+section{margin:24px 32px;background:#fff;border:1px solid #d0d7de;border-radius:6px}
+section h2{margin:0;padding:10px 16px;font-size:15px;border-bottom:1px solid #d0d7de;background:#f6f8fa}
+pre,td.mono{font-family:ui-monospace,monospace;font-size:13px}
+pre{margin:0;padding:8px 0;overflow:auto}
+pre span{display:block;padding:0 16px}
+pre span.current{background:#ffebe9}
+pre em{display:inline-block;width:48px;color:#8c959f;font-style:normal}
+table{width:100%;border-collapse:collapse}
+td{padding:6px 16px;border-top:1px solid #eaeef2;vertical-align:top;word-break:break-all}
+td:first-child{width:30%;color:#57606a}
+tr.framework td{color:#8c959f}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>{{.ErrorType}}: {{.Error}}</p>
+</header>
+{{with .Source}}<section>
+<h2>{{.File}}:{{.Line}}</h2>
+<pre>{{range $.Snippet}}<span{{if .Current}} class="current"{{end}}><em>{{.Number}}</em>{{.Code}}</span>{{end}}</pre>
+</section>{{end}}
+<section>
+<h2>Stack trace</h2>
+<table>{{range .Frames}}<tr{{if not .Application}} class="framework"{{end}}><td class="mono">{{.Function}}</td><td class="mono">{{.File}}:{{.Line}}</td></tr>{{end}}</table>
+</section>
+<section>
+<h2>Request</h2>
+<table>
+<tr><td>Method</td><td class="mono">{{.Method}}</td></tr>
+<tr><td>URL</td><td class="mono">{{.URL}}</td></tr>
+{{if .Route}}<tr><td>Route</td><td class="mono">{{.Route}}</td></tr>{{end}}
+<tr><td>Protocol</td><td class="mono">{{.Proto}}</td></tr>
+<tr><td>Remote address</td><td class="mono">{{.Remote}}</td></tr>
+{{if .RequestID}}<tr><td>Request ID</td><td class="mono">{{.RequestID}}</td></tr>{{end}}
+</table>
+</section>
+{{if .Query}}<section>
+<h2>Query</h2>
+<table>{{range .Query}}<tr><td>{{index . 0}}</td><td class="mono">{{index . 1}}</td></tr>{{end}}</table>
+</section>{{end}}
+<section>
+<h2>Headers</h2>
+<table>{{range .Headers}}<tr><td>{{index . 0}}</td><td class="mono">{{index . 1}}</td></tr>{{end}}</table>
+</section>
+<section><h2>gudu {{.Version}} &middot; debug mode, never enable it in production</h2></section>
+</body>
+</html>
+`))
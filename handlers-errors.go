@@ -0,0 +1,166 @@
+package gudu
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/deenikarim/gudu/render"
+)
+
+// HandlerFunc is a handler returning an error, adapted to a http.HandlerFunc by
+// Gudu.Handle so failures are reported in one place
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// errorStatuses maps errors to HTTP status codes, see Gudu.RegisterError
+type errorStatuses struct {
+	mu       sync.RWMutex
+	mappings []errorStatus
+}
+
+// errorStatus maps errors matching target to status
+type errorStatus struct {
+	target error
+	status int
+}
+
+// panicError is the error reported for a recovered panic
+type panicError struct {
+	value interface{}
+	stack []uintptr
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// Unwrap exposes the value of panic(err) to errors.Is and errors.As
+func (e *panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// Handle adapts a handler returning an error: a non nil error is passed to HandleError
+func (g *Gudu) Handle(fn HandlerFunc) http.HandlerFunc {
+	// the entry point of the handler locates it on the development error page
+	pc := reflect.ValueOf(fn).Pointer() + 1
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			g.handleError(w, r, err, []uintptr{pc})
+		}
+	}
+}
+
+// RegisterError maps errors matching target, as reported by errors.Is, to a status
+// code. Mappings are checked in registration order before the defaults of
+// ProblemFromError.
+func (g *Gudu) RegisterError(target error, status int) {
+	g.errorStatuses.mu.Lock()
+	defer g.errorStatuses.mu.Unlock()
+	g.errorStatuses.mappings = append(g.errorStatuses.mappings, errorStatus{target: target, status: status})
+}
+
+// ErrorProblem returns the Problem reported for an error, applying the registered
+// error mappings
+func (g *Gudu) ErrorProblem(err error) *Problem {
+	g.errorStatuses.mu.RLock()
+	defer g.errorStatuses.mu.RUnlock()
+
+	for _, mapping := range g.errorStatuses.mappings {
+		if errors.Is(err, mapping.target) {
+			if mapping.status >= http.StatusInternalServerError {
+				return NewProblem(mapping.status, "")
+			}
+			return NewProblem(mapping.status, err.Error())
+		}
+	}
+	return ProblemFromError(err)
+}
+
+// HandleError reports an error to the client: requests preferring HTML get the
+// views/errors/{status} page, or the development error page in debug mode, API
+// requests get a problem+json response. Server errors are logged.
+func (g *Gudu) HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	g.handleError(w, r, err, nil)
+}
+
+// handleError is HandleError with the program counters locating the failing code,
+// used for the source snippet of the development error page
+func (g *Gudu) handleError(w http.ResponseWriter, r *http.Request, err error, stack []uintptr) {
+	problem := g.ErrorProblem(err)
+	// panics are logged with their stack trace by Recoverer
+	var perr *panicError
+	if problem.Status >= http.StatusInternalServerError && g.ErrorLog != nil && !errors.As(err, &perr) {
+		g.ErrorLog.Printf("%s %s: %v", r.Method, r.URL.RequestURI(), err)
+	}
+
+	resp := g.ResponseFor(w, r)
+	if resp.problemMediaType() != "text/html" {
+		_ = resp.ProblemError(problemError{problem: problem, err: err})
+		return
+	}
+
+	if g.DebugMode {
+		if stack == nil {
+			stack = callers(3)
+		}
+		g.writeDebugPage(w, r, problem, err, stack)
+		return
+	}
+
+	g.writeErrorPage(w, r, problem)
+}
+
+// problemError carries an already mapped problem together with the original error
+type problemError struct {
+	problem *Problem
+	err     error
+}
+
+func (e problemError) Error() string {
+	return e.err.Error()
+}
+
+func (e problemError) Problem() *Problem {
+	return e.problem
+}
+
+// writeErrorPage renders views/errors/{status}, falling back to the status text when
+// the page does not exist
+func (g *Gudu) writeErrorPage(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	if g.Render != nil {
+		td := &render.TemplateData{
+			IntMap:    map[string]int{"status": problem.Status},
+			StringMap: map[string]string{"title": problem.Title, "message": problem.Detail},
+		}
+		buf := &bufferResponseWriter{header: make(http.Header)}
+		if err := g.Render.RenderPage(buf, r, g.Render.ErrorPage(problem.Status), nil, td); err == nil && buf.body.Len() > 0 {
+			w.Header().Set(contentType, "text/html; charset=utf-8")
+			w.WriteHeader(problem.Status)
+			_, _ = w.Write(buf.body.Bytes())
+			return
+		}
+	}
+	http.Error(w, http.StatusText(problem.Status), problem.Status)
+}
+
+// callers returns the program counters of the calling goroutine, skipping skip frames
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 64)
+	return pcs[:runtime.Callers(skip, pcs)]
+}
+
+// isFrameworkFrame reports whether a stack frame belongs to the runtime, the standard
+// library http stack, chi or gudu itself rather than application code
+func isFrameworkFrame(function string) bool {
+	for _, prefix := range []string{"runtime.", "testing.", "net/http.", "github.com/go-chi/", "github.com/alexedwards/scs"} {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(function, "github.com/deenikarim/gudu.")
+}
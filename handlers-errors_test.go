@@ -0,0 +1,176 @@
+package gudu
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/deenikarim/gudu/render"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// failing serves a handler returning err through Handle and Recoverer, with sessions
+// loaded for the error pages
+func failing(g *Gudu, accept string, fn HandlerFunc) *httptest.ResponseRecorder {
+	handler := g.Sessions.LoadAndSave(g.Recoverer(g.Handle(fn)))
+	r := httptest.NewRequest(http.MethodGet, "/posts", nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// withErrorPages sets up a jet renderer with the views/errors pages
+func withErrorPages(t *testing.T, g *Gudu, pages map[int]string) {
+	t.Helper()
+	dir := filepath.Join(g.RootPath, "views", "errors")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for status, content := range pages {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.jet", status)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Render = &render.Render{
+		RendererEngine: "jet",
+		JetViews:       jet.NewSet(jet.NewOSFileSystemLoader(filepath.Join(g.RootPath, "views")), jet.InDevelopmentMode()),
+		Session:        g.Sessions,
+	}
+}
+
+func TestErrorProblemMapsErrors(t *testing.T) {
+	g := testGudu(t)
+	errMaintenance := errors.New("database migration running")
+	g.RegisterError(errQuotaExceeded, http.StatusTooManyRequests)
+	g.RegisterError(errMaintenance, http.StatusServiceUnavailable)
+	g.RegisterError(errQuotaExceeded, http.StatusPaymentRequired)
+
+	tests := []struct {
+		err    error
+		status int
+		detail string
+	}{
+		{fmt.Errorf("upload: %w", errQuotaExceeded), http.StatusTooManyRequests, "upload: quota exceeded"},
+		{errMaintenance, http.StatusServiceUnavailable, ""},
+		{fmt.Errorf("post 7: %w", sql.ErrNoRows), http.StatusNotFound, ""},
+		{ValidationErrors{"title": {"required"}}, http.StatusUnprocessableEntity, ""},
+		{NewProblem(http.StatusConflict, "taken"), http.StatusConflict, "taken"},
+		{errors.New("password=hunter2"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		problem := g.ErrorProblem(tt.err)
+		if problem.Status != tt.status {
+			t.Errorf("%v: status %d, want %d", tt.err, problem.Status, tt.status)
+		}
+		if tt.detail != "" && problem.Detail != tt.detail {
+			t.Errorf("%v: detail %q, want %q", tt.err, problem.Detail, tt.detail)
+		}
+		if problem.Status >= http.StatusInternalServerError && strings.Contains(problem.Detail, tt.err.Error()) {
+			t.Errorf("%v: server error details are exposed: %q", tt.err, problem.Detail)
+		}
+	}
+}
+
+func TestHandleErrorNegotiatesTheFormat(t *testing.T) {
+	g := testGudu(t)
+	withErrorPages(t, g, map[int]string{http.StatusNotFound: `<h1>Lost? {{ .StringMap["title"] }}</h1>`})
+	notFound := func(w http.ResponseWriter, r *http.Request) error {
+		return NewProblem(http.StatusNotFound, "no such post")
+	}
+
+	w := failing(g, "application/json", notFound)
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), problemJSON) ||
+		!strings.Contains(w.Body.String(), `"no such post"`) {
+		t.Errorf("api = %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	w = failing(g, "text/html,application/xhtml+xml,*/*;q=0.8", notFound)
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		w.Body.String() != "<h1>Lost? Not Found</h1>" {
+		t.Errorf("browser = %d %s %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// without views/errors/500 the status text is sent
+	w = failing(g, "text/html", func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("boom")
+	})
+	if w.Code != http.StatusInternalServerError || strings.TrimSpace(w.Body.String()) != "Internal Server Error" {
+		t.Errorf("missing page = %d %q", w.Code, w.Body.String())
+	}
+
+	// handlers returning nil are left alone
+	w = failing(g, "text/html", func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("success = %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDebugPageOnlyInDebugMode(t *testing.T) {
+	g := testGudu(t)
+	leak := func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("connect to db.internal:5432 failed")
+	}
+
+	for _, accept := range []string{"text/html", "application/json"} {
+		w := failing(g, accept, leak)
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "db.internal") ||
+			strings.Contains(w.Body.String(), "handlers-errors_test.go") {
+			t.Errorf("%s outside debug mode = %d %s", accept, w.Code, w.Body.String())
+		}
+	}
+
+	g.DebugMode = true
+	w := failing(g, "text/html", leak)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "db.internal:5432") ||
+		!strings.Contains(w.Body.String(), "handlers-errors_test.go") {
+		t.Errorf("debug page = %d, want the error and the failing handler", w.Code)
+	}
+	if w := failing(g, "application/json", leak); !strings.Contains(w.Body.String(), `"exception"`) {
+		t.Errorf("debug problem = %s, want the exception member", w.Body.String())
+	}
+}
+
+func TestRecovererReportsPanics(t *testing.T) {
+	g := testGudu(t)
+	w := failing(g, "application/json", func(w http.ResponseWriter, r *http.Request) error {
+		panic(fmt.Errorf("wrapped: %w", errQuotaExceeded))
+	})
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "quota") {
+		t.Errorf("panic = %d %s, want a 500 without the value", w.Code, w.Body.String())
+	}
+
+	g.DebugMode = true
+	w = failing(g, "text/html", func(w http.ResponseWriter, r *http.Request) error {
+		panic("index out of range")
+	})
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "panic(string)") {
+		t.Errorf("debug panic = %d, want the debug page of the panic", w.Code)
+	}
+}
+
+func TestRecovererReraisesAbortHandler(t *testing.T) {
+	g := testGudu(t)
+	handler := g.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if rvr := recover(); rvr != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rvr)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("http.ErrAbortHandler was swallowed")
+}
@@ -0,0 +1,92 @@
+package hashing
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idParams are the parameters encoded in an argon2id hash
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// hashArgon2id hashes the password with a random salt, encoded in the PHC string
+// format $argon2id$v=19$m=65536,t=3,p=2$salt$key
+func (h *Hasher) hashArgon2id(password string) (string, error) {
+	salt := make([]byte, h.options.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.options.Argon2Time, h.options.Argon2Memory,
+		h.options.Argon2Threads, h.options.Argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.options.Argon2Memory, h.options.Argon2Time, h.options.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyArgon2id hashes the password with the parameters and salt of the hash and
+// compares the keys in constant time
+func verifyArgon2id(password, hash string) (bool, error) {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// argon2idNeedsRehash reports whether the hash parameters differ from the configured
+// ones
+func (h *Hasher) argon2idNeedsRehash(hash string) bool {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.options.Argon2Memory ||
+		params.time != h.options.Argon2Time ||
+		params.threads != h.options.Argon2Threads ||
+		uint32(len(params.salt)) != h.options.Argon2SaltLength ||
+		uint32(len(params.key)) != h.options.Argon2KeyLength
+}
+
+// parseArgon2id decodes an argon2id hash in the PHC string format
+func parseArgon2id(hash string) (argon2idParams, error) {
+	var params argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return params, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, ErrUnknownHash
+	}
+	if version != argon2.Version {
+		return params, fmt.Errorf("hashing: unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, ErrUnknownHash
+	}
+	if params.time == 0 || params.threads == 0 {
+		return params, ErrUnknownHash
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, ErrUnknownHash
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return params, ErrUnknownHash
+	}
+	return params, nil
+}
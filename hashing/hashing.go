@@ -0,0 +1,141 @@
+// Package hashing hashes passwords with bcrypt or argon2id. Hashes are recognised by
+// their format, so passwords hashed with one algorithm keep verifying after switching
+// to the other, and NeedsRehash tells when a hash should be upgraded on login.
+package hashing
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// drivers
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+// ErrUnknownHash is returned for hashes of no supported algorithm
+var ErrUnknownHash = errors.New("hashing: unknown hash format")
+
+// Options configures a Hasher; zero values select the defaults
+type Options struct {
+	// Driver hashes new passwords, bcrypt or argon2id; bcrypt by default
+	Driver string
+	// BcryptCost is the bcrypt work factor, 4 to 31; 12 by default
+	BcryptCost int
+	// Argon2Memory is the memory used by argon2id in KiB; 64 MiB by default
+	Argon2Memory uint32
+	// Argon2Time is the number of argon2id passes; 3 by default
+	Argon2Time uint32
+	// Argon2Threads is the argon2id parallelism; 2 by default
+	Argon2Threads uint8
+	// Argon2SaltLength and Argon2KeyLength are in bytes; 16 and 32 by default
+	Argon2SaltLength uint32
+	Argon2KeyLength  uint32
+}
+
+// LoadOptions loads the hashing options from the environment variables HASH_DRIVER,
+// HASH_BCRYPT_COST, HASH_ARGON2_MEMORY, HASH_ARGON2_TIME and HASH_ARGON2_THREADS
+func LoadOptions() Options {
+	bcryptCost, _ := strconv.Atoi(os.Getenv("HASH_BCRYPT_COST"))
+	memory, _ := strconv.ParseUint(os.Getenv("HASH_ARGON2_MEMORY"), 10, 32)
+	passes, _ := strconv.ParseUint(os.Getenv("HASH_ARGON2_TIME"), 10, 32)
+	threads, _ := strconv.ParseUint(os.Getenv("HASH_ARGON2_THREADS"), 10, 8)
+
+	return Options{
+		Driver:        strings.ToLower(os.Getenv("HASH_DRIVER")),
+		BcryptCost:    bcryptCost,
+		Argon2Memory:  uint32(memory),
+		Argon2Time:    uint32(passes),
+		Argon2Threads: uint8(threads),
+	}
+}
+
+// Hasher hashes and verifies passwords
+type Hasher struct {
+	options Options
+}
+
+// New creates a Hasher, filling in the defaults of unset options
+func New(options Options) *Hasher {
+	if options.Driver == "" {
+		options.Driver = Bcrypt
+	}
+	if options.BcryptCost == 0 {
+		options.BcryptCost = 12
+	}
+	if options.Argon2Memory == 0 {
+		options.Argon2Memory = 64 * 1024
+	}
+	if options.Argon2Time == 0 {
+		options.Argon2Time = 3
+	}
+	if options.Argon2Threads == 0 {
+		options.Argon2Threads = 2
+	}
+	if options.Argon2SaltLength == 0 {
+		options.Argon2SaltLength = 16
+	}
+	if options.Argon2KeyLength == 0 {
+		options.Argon2KeyLength = 32
+	}
+	return &Hasher{options: options}
+}
+
+// Driver returns the algorithm new passwords are hashed with
+func (h *Hasher) Driver() string {
+	return h.options.Driver
+}
+
+// Hash hashes the password with the configured driver
+func (h *Hasher) Hash(password string) (string, error) {
+	switch h.options.Driver {
+	case Bcrypt:
+		return h.hashBcrypt(password)
+	case Argon2id:
+		return h.hashArgon2id(password)
+	}
+	return "", errors.New("hashing: unknown driver " + h.options.Driver)
+}
+
+// Verify reports whether the password matches the hash, whichever supported algorithm
+// made it. Hashes are compared in constant time; a mismatch is not an error.
+func (h *Hasher) Verify(password, hash string) (bool, error) {
+	switch Algorithm(hash) {
+	case Bcrypt:
+		return verifyBcrypt(password, hash)
+	case Argon2id:
+		return verifyArgon2id(password, hash)
+	}
+	return false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether the hash was made by another driver or with other
+// parameters than configured, so it should be replaced by Hash after a successful
+// Verify
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if Algorithm(hash) != h.options.Driver {
+		return true
+	}
+	switch h.options.Driver {
+	case Bcrypt:
+		return h.bcryptNeedsRehash(hash)
+	case Argon2id:
+		return h.argon2idNeedsRehash(hash)
+	}
+	return true
+}
+
+// Algorithm returns the algorithm of a hash, bcrypt or argon2id, or an empty string
+// for unknown formats
+func Algorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return Bcrypt
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package hashing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fast parameters keep the tests quick
+var (
+	fastBcrypt   = Options{Driver: Bcrypt, BcryptCost: 4}
+	fastArgon2id = Options{Driver: Argon2id, Argon2Memory: 1024, Argon2Time: 1, Argon2Threads: 1}
+)
+
+func TestHashAndVerify(t *testing.T) {
+	for _, options := range []Options{fastBcrypt, fastArgon2id} {
+		hasher := New(options)
+		hash, err := hasher.Hash("s3cret pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Algorithm(hash) != options.Driver {
+			t.Errorf("%s: expected the hash to be detected, got %q", options.Driver, Algorithm(hash))
+		}
+
+		if ok, err := hasher.Verify("s3cret pass", hash); !ok || err != nil {
+			t.Errorf("%s: expected the password to match, got %v %v", options.Driver, ok, err)
+		}
+		if ok, err := hasher.Verify("wrong pass", hash); ok || err != nil {
+			t.Errorf("%s: expected a mismatch without error, got %v %v", options.Driver, ok, err)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("%s: a fresh hash should not need a rehash", options.Driver)
+		}
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	hash, err := New(fastArgon2id).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("unexpected hash %s", hash)
+	}
+}
+
+func TestSwitchingDrivers(t *testing.T) {
+	bcryptHash, err := New(fastBcrypt).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an application switched to argon2id keeps verifying bcrypt hashes
+	argon := New(fastArgon2id)
+	if ok, err := argon.Verify("password", bcryptHash); !ok || err != nil {
+		t.Errorf("expected the bcrypt hash to verify, got %v %v", ok, err)
+	}
+	if !argon.NeedsRehash(bcryptHash) {
+		t.Error("expected the bcrypt hash to need a rehash")
+	}
+
+	// changed parameters need a rehash too
+	stronger := fastArgon2id
+	stronger.Argon2Time = 2
+	argonHash, _ := argon.Hash("password")
+	if !New(stronger).NeedsRehash(argonHash) {
+		t.Error("expected a rehash after raising the time cost")
+	}
+	if !New(Options{Driver: Bcrypt, BcryptCost: 5}).NeedsRehash(bcryptHash) {
+		t.Error("expected a rehash after raising the bcrypt cost")
+	}
+}
+
+func TestUnknownHash(t *testing.T) {
+	hasher := New(Options{})
+	if _, err := hasher.Verify("password", "plain text"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected ErrUnknownHash, got %v", err)
+	}
+	if _, err := hasher.Verify("password", "$argon2id$v=19$m=1,t=1$broken"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected ErrUnknownHash for a malformed hash, got %v", err)
+	}
+	if !hasher.NeedsRehash("plain text") {
+		t.Error("expected unknown hashes to need a rehash")
+	}
+}
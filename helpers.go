@@ -1,17 +1,13 @@
 package gudu
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"encoding/base64"
-	"errors"
 	"fmt"
-	"io"
 	"math/big"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -77,6 +73,25 @@ func (g *Gudu) CreateFileIfNotExist(filePath string) error {
 	return nil
 }
 
+// splitEnvList splits a comma separated environment variable into a trimmed list
+func splitEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvOrDefault returns the environment variable or the default value when it is not set
+func getEnvOrDefault(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
+
 func (g *Gudu) LoadTime(start time.Time) {
 	elapsed := time.Since(start)
 	pc, _, _, _ := runtime.Caller(1)
@@ -88,75 +103,3 @@ func (g *Gudu) LoadTime(start time.Time) {
 	g.InfoLog.Println(fmt.Sprintf("Load time: %s took %s", name, elapsed))
 
 }
-
-type Encryption struct {
-	Key []byte
-}
-
-// Encrypt function encrypts the plaintext using AES and returns the
-// ciphertext as a base64 encoded string
-func (e *Encryption) Encrypt(text string) (string, error) {
-
-	plainText := []byte(text)
-
-	// Create a new AES cipher with the provided key
-	block, err := aes.NewCipher(e.Key)
-	if err != nil {
-		return "", err // Return an error if cipher creation fails
-	}
-
-	// Create a byte slice for the ciphertext, which is the size of the AES block plus the length of the plaintext
-	ciphertext := make([]byte, aes.BlockSize+len(plainText))
-
-	// Create an initialization vector (IV) from the first part of the ciphertext
-	iv := ciphertext[:aes.BlockSize]
-
-	// Fill the IV with random bytes
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return "", err // Return an error if IV generation fails
-	}
-
-	// Create a new CFB encrypter with the cipher block and IV
-	stream := cipher.NewCFBEncrypter(block, iv)
-
-	// Encrypt the plaintext by XORing it with the key stream
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plainText)
-
-	// Return the ciphertext as a base64 encoded string
-	return base64.URLEncoding.EncodeToString(ciphertext), nil
-}
-
-// Decrypt function decrypts the base64 encoded ciphertext using AES
-// and returns the plaintext
-func (e *Encryption) Decrypt(ciphertext string) (string, error) {
-	// Decode the base64 encoded ciphertext
-	ciphertextBytes, err := base64.URLEncoding.DecodeString(ciphertext)
-	if err != nil {
-		return "", err // Return an error if decoding fails
-	}
-	// Create a new AES cipher with the provided key
-	block, err := aes.NewCipher(e.Key)
-	if err != nil {
-		return "", err // Return an error if cipher creation fails
-	}
-
-	// Check if the ciphertext is at least as long as the AES block size
-	if len(ciphertextBytes) < aes.BlockSize {
-		return "", errors.New("ciphertext too short") // Return an error if the ciphertext is too short
-	}
-
-	// Extract the initialization vector (IV) from the ciphertext
-	iv := ciphertextBytes[:aes.BlockSize]
-
-	// Extract the actual ciphertext
-	ciphertextBytes = ciphertextBytes[aes.BlockSize:]
-
-	// Create a new CFB decrypter with the cipher block and IV
-	stream := cipher.NewCFBDecrypter(block, iv)
-
-	// Decrypt the ciphertext by XORing it with the key stream
-	stream.XORKeyStream(ciphertextBytes, ciphertextBytes)
-
-	// Return the decrypted plaintext
-	return string(ciphertextBytes), nil
-}
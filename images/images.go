@@ -0,0 +1,147 @@
+// Package images decodes, transforms and re-encodes JPEG, PNG and GIF images with the
+// standard library codecs: resizing, cropping to fit, thumbnails and EXIF orientation.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned for images that are not JPEG, PNG or GIF
+var ErrUnsupportedFormat = errors.New("images: unsupported format")
+
+// ErrTooLarge is returned for images with more pixels than DecodeOptions.MaxPixels
+var ErrTooLarge = errors.New("images: image too large")
+
+// DefaultMaxPixels is the largest width x height decoded when DecodeOptions.MaxPixels
+// is zero, about 160 MB once decoded to RGBA
+const DefaultMaxPixels = 40_000_000
+
+// Format is an image encoding
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	GIF  Format = "gif"
+)
+
+// ParseFormat returns the format of a name such as "jpg", "png" or "image/gif"
+func ParseFormat(name string) (Format, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimPrefix(name, ".")), "image/") {
+	case "jpeg", "jpg":
+		return JPEG, nil
+	case "png":
+		return PNG, nil
+	case "gif":
+		return GIF, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+}
+
+// Extension returns the file extension of the format, with the dot
+func (f Format) Extension() string {
+	if f == JPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// MimeType returns the media type of the format
+func (f Format) MimeType() string {
+	return "image/" + string(f)
+}
+
+// EncodeOptions holds the settings of Encode
+type EncodeOptions struct {
+	// Quality of JPEG images from 1 to 100, 85 when zero
+	Quality int
+	// Compression of PNG images, png.DefaultCompression when zero
+	Compression png.CompressionLevel
+	// Colors of the GIF palette from 1 to 256, 256 when zero
+	Colors int
+}
+
+// DecodeOptions holds the settings of Decode
+type DecodeOptions struct {
+	// MaxPixels limits the width x height of the image, DefaultMaxPixels when zero
+	MaxPixels int
+}
+
+// Decode reads a JPEG, PNG or GIF image and turns it upright according to its EXIF
+// orientation. Animated GIFs are decoded to their first frame. The dimensions are read
+// from the header first, and images larger than MaxPixels return ErrTooLarge without
+// being decoded, as a small file can declare a huge image.
+func Decode(r io.Reader, opts ...DecodeOptions) (image.Image, Format, error) {
+	var options DecodeOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	maxPixels := options.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	config, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, "", ErrUnsupportedFormat
+		}
+		return nil, "", err
+	}
+	format, err := ParseFormat(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxPixels/config.Height {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if format == JPEG {
+		img = Orient(img, Orientation(data))
+	}
+	return img, format, nil
+}
+
+// Encode writes the image in the format. Metadata such as EXIF is never written, so
+// re-encoding strips it.
+func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOptions) error {
+	var options EncodeOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	switch format {
+	case JPEG:
+		quality := options.Quality
+		if quality <= 0 {
+			quality = 85
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: min(quality, 100)})
+	case PNG:
+		encoder := png.Encoder{CompressionLevel: options.Compression}
+		return encoder.Encode(w, img)
+	case GIF:
+		colors := options.Colors
+		if colors <= 0 || colors > 256 {
+			colors = 256
+		}
+		return gif.Encode(w, img, &gif.Options{NumColors: colors})
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
@@ -0,0 +1,207 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testImage returns a w x h image, red on the left half and blue on the right
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an Exif APP1 segment with the orientation after the SOI
+// marker of JPEG data
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	ifd := make([]byte, 2+12+4)
+	binary.BigEndian.PutUint16(ifd, 1)
+	binary.BigEndian.PutUint16(ifd[2:], exifOrientationTag)
+	binary.BigEndian.PutUint16(ifd[4:], 3)
+	binary.BigEndian.PutUint32(ifd[6:], 1)
+	binary.BigEndian.PutUint16(ifd[10:], orientation)
+	payload := append(append([]byte("Exif\x00\x00"), tiff...), ifd...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestResize(t *testing.T) {
+	img := testImage(400, 200)
+
+	tests := []struct {
+		name          string
+		got           image.Image
+		width, height int
+	}{
+		{"resize", Resize(img, 100, 100), 100, 100},
+		{"resize keeps aspect", Resize(img, 100, 0), 100, 50},
+		{"fit", Fit(img, 100, 100), 100, 50},
+		{"fit does not upscale", Fit(img, 1000, 1000), 400, 200},
+		{"fill", Fill(img, 100, 100), 100, 100},
+		{"thumbnail", Thumbnail(img, 64), 64, 64},
+	}
+	for _, tt := range tests {
+		if tt.got.Bounds().Dx() != tt.width || tt.got.Bounds().Dy() != tt.height {
+			t.Errorf("%s: expected %dx%d, got %v", tt.name, tt.width, tt.height, tt.got.Bounds())
+		}
+	}
+
+	// colours survive resampling away from the edge between the halves
+	r, _, b, _ := Resize(img, 100, 50).At(5, 25).RGBA()
+	if r>>8 != 255 || b>>8 != 0 {
+		t.Errorf("expected red, got r=%d b=%d", r>>8, b>>8)
+	}
+}
+
+func TestFillCropsCentre(t *testing.T) {
+	// a 300 wide image with a green centre third is filled into a square
+	img := testImage(300, 100)
+	for y := 0; y < 100; y++ {
+		for x := 100; x < 200; x++ {
+			img.SetRGBA(x, y, color.RGBA{G: 255, A: 255})
+		}
+	}
+	filled := Fill(img, 50, 50)
+	_, g, _, _ := filled.At(0, 25).RGBA()
+	if g>>8 < 250 {
+		t.Errorf("expected only the green centre to remain, got g=%d at the left edge", g>>8)
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := Orientation(buf.Bytes()); got != 1 {
+		t.Errorf("expected orientation 1 without exif, got %d", got)
+	}
+
+	rotated := withOrientation(buf.Bytes(), 6)
+	if got := Orientation(rotated); got != 6 {
+		t.Fatalf("expected orientation 6, got %d", got)
+	}
+
+	img, format, err := Decode(bytes.NewReader(rotated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != JPEG {
+		t.Errorf("expected jpeg, got %s", format)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 40 {
+		t.Fatalf("expected a 20x40 upright image, got %v", img.Bounds())
+	}
+	// rotated clockwise, the red left half becomes the top half
+	r, _, b, _ := img.At(10, 5).RGBA()
+	if r>>8 < 200 || b>>8 > 50 {
+		t.Errorf("expected red at the top, got r=%d b=%d", r>>8, b>>8)
+	}
+
+	// re-encoding drops the exif segment
+	var out bytes.Buffer
+	if err := Encode(&out, img, JPEG, EncodeOptions{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	if Orientation(out.Bytes()) != 1 || bytes.Contains(out.Bytes(), []byte("Exif")) {
+		t.Error("expected the exif data to be stripped")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 255, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{B: 255, A: 255})
+
+	// the red pixel ends up at the given position for each orientation
+	positions := map[int]image.Point{
+		1: {0, 0}, 2: {1, 0}, 3: {1, 0}, 4: {0, 0},
+		5: {0, 0}, 6: {0, 0}, 7: {0, 1}, 8: {0, 1},
+	}
+	for orientation, position := range positions {
+		oriented := Orient(img, orientation)
+		r, _, _, _ := oriented.At(position.X, position.Y).RGBA()
+		if r>>8 != 255 {
+			t.Errorf("orientation %d: expected red at %v", orientation, position)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(300, 200)); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := Process(bytes.NewReader(buf.Bytes()), DecodeOptions{},
+		Variant{Name: "thumb", Width: 50, Height: 50, Mode: ModeFill, Format: JPEG, Quality: 70},
+		Variant{Name: "medium", Width: 150},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %d", len(outputs))
+	}
+	if outputs[0].Format != JPEG || outputs[0].Width != 50 || outputs[0].Height != 50 {
+		t.Errorf("unexpected thumb %+v", outputs[0].Variant)
+	}
+	if outputs[1].Format != PNG || outputs[1].Width != 150 || outputs[1].Height != 100 {
+		t.Errorf("unexpected medium %s %dx%d", outputs[1].Format, outputs[1].Width, outputs[1].Height)
+	}
+	if _, format, err := image.Decode(bytes.NewReader(outputs[0].Data)); err != nil || format != "jpeg" {
+		t.Errorf("expected jpeg data, got %s %v", format, err)
+	}
+
+	if _, err := Process(strings.NewReader("not an image"), DecodeOptions{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestDecodeRejectsLargeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(300, 200)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(bytes.NewReader(buf.Bytes()), DecodeOptions{MaxPixels: 300 * 200}); err != nil {
+		t.Errorf("an image at the limit is decoded: %v", err)
+	}
+	if _, _, err := Decode(bytes.NewReader(buf.Bytes()), DecodeOptions{MaxPixels: 300*200 - 1}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+
+	// a header declaring 100000x100000 pixels is refused before any decoding
+	header := make([]byte, 0, 33)
+	header = append(header, "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"...)
+	header = binary.BigEndian.AppendUint32(header, 100000)
+	header = binary.BigEndian.AppendUint32(header, 100000)
+	header = append(header, 8, 6, 0, 0, 0)
+	header = binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(header[12:]))
+	if _, _, err := Decode(bytes.NewReader(header)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge for a forged header, got %v", err)
+	}
+}
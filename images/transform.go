@@ -0,0 +1,183 @@
+package images
+
+import (
+	"image"
+	"math"
+)
+
+// Resize scales the image to width x height with Catmull-Rom resampling. A zero
+// dimension is derived from the other one, keeping the aspect ratio.
+func Resize(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 || (width <= 0 && height <= 0) {
+		return img
+	}
+	if width <= 0 {
+		width = max(1, int(math.Round(float64(w)*float64(height)/float64(h))))
+	}
+	if height <= 0 {
+		height = max(1, int(math.Round(float64(h)*float64(width)/float64(w))))
+	}
+	if width == w && height == h {
+		return img
+	}
+
+	src := toRGBA(img)
+	horizontal := resampleWeights(width, w)
+	vertical := resampleWeights(height, h)
+
+	// scale the rows into a float buffer, then the columns into the result
+	tmp := make([]float32, width*h*4)
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, weights := range horizontal {
+			var r, g, b, a float32
+			for i, weight := range weights.values {
+				p := (weights.start + i) * 4
+				r += weight * float32(row[p])
+				g += weight * float32(row[p+1])
+				b += weight * float32(row[p+2])
+				a += weight * float32(row[p+3])
+			}
+			t := (y*width + x) * 4
+			tmp[t], tmp[t+1], tmp[t+2], tmp[t+3] = r, g, b, a
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range vertical {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float32
+			for i, weight := range weights.values {
+				t := ((weights.start+i)*width + x) * 4
+				r += weight * tmp[t]
+				g += weight * tmp[t+1]
+				b += weight * tmp[t+2]
+				a += weight * tmp[t+3]
+			}
+			// the pixels are premultiplied, so no channel may exceed alpha
+			alpha := clampChannel(a, 255)
+			p := dst.PixOffset(x, y)
+			dst.Pix[p] = clampChannel(r, alpha)
+			dst.Pix[p+1] = clampChannel(g, alpha)
+			dst.Pix[p+2] = clampChannel(b, alpha)
+			dst.Pix[p+3] = alpha
+		}
+	}
+	return dst
+}
+
+// Fit scales the image down to fit within width x height, keeping the aspect ratio.
+// A zero dimension is unbounded; images already fitting are returned unchanged.
+func Fit(img image.Image, width, height int) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+	scale := 1.0
+	if width > 0 {
+		scale = math.Min(scale, float64(width)/float64(w))
+	}
+	if height > 0 {
+		scale = math.Min(scale, float64(height)/float64(h))
+	}
+	if scale >= 1 {
+		return img
+	}
+	return Resize(img, max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale))))
+}
+
+// Fill scales and crops the image to exactly width x height, keeping the centre of the
+// image and its aspect ratio
+func Fill(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 || width <= 0 || height <= 0 {
+		return img
+	}
+
+	// crop the largest centred area with the target aspect ratio, then scale it
+	cropW, cropH := w, int(math.Round(float64(w)*float64(height)/float64(width)))
+	if cropH > h {
+		cropW, cropH = int(math.Round(float64(h)*float64(width)/float64(height))), h
+	}
+	x := bounds.Min.X + (w-cropW)/2
+	y := bounds.Min.Y + (h-cropH)/2
+	return Resize(Crop(img, image.Rect(x, y, x+cropW, y+cropH)), width, height)
+}
+
+// Thumbnail returns a size x size square of the centre of the image
+func Thumbnail(img image.Image, size int) image.Image {
+	return Fill(img, size, size)
+}
+
+// Crop returns the part of the image inside rect
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Intersect(img.Bounds())
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	return toRGBA(img).SubImage(rect.Sub(img.Bounds().Min))
+}
+
+// resampleWeight holds the source pixels contributing to a destination pixel
+type resampleWeight struct {
+	start  int
+	values []float32
+}
+
+// resampleWeights computes the normalised Catmull-Rom weights mapping src pixels to
+// dst pixels, widening the kernel when scaling down
+func resampleWeights(dst, src int) []resampleWeight {
+	scale := float64(src) / float64(dst)
+	filterScale := math.Max(scale, 1)
+	support := 2 * filterScale
+
+	weights := make([]resampleWeight, dst)
+	for i := range weights {
+		center := (float64(i)+0.5)*scale - 0.5
+		start := max(0, int(math.Ceil(center-support)))
+		end := min(src-1, int(math.Floor(center+support)))
+
+		values := make([]float32, 0, end-start+1)
+		var sum float64
+		for j := start; j <= end; j++ {
+			weight := catmullRom((float64(j) - center) / filterScale)
+			values = append(values, float32(weight))
+			sum += weight
+		}
+		if sum != 0 {
+			for j := range values {
+				values[j] /= float32(sum)
+			}
+		}
+		weights[i] = resampleWeight{start: start, values: values}
+	}
+	return weights
+}
+
+// catmullRom is the Catmull-Rom cubic kernel
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return 1.5*x*x*x - 2.5*x*x + 1
+	case x < 2:
+		return -0.5*x*x*x + 2.5*x*x - 4*x + 2
+	}
+	return 0
+}
+
+// clampChannel rounds a channel value into 0..limit
+func clampChannel(v float32, limit uint8) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= float32(limit) {
+		return limit
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,91 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"io"
+)
+
+// Mode is how a variant is sized
+type Mode int
+
+const (
+	// ModeFit scales the image down to fit within the size
+	ModeFit Mode = iota
+	// ModeFill scales and crops the image to exactly the size
+	ModeFill
+	// ModeResize scales the image to the size, ignoring the aspect ratio unless a
+	// dimension is zero
+	ModeResize
+)
+
+// Variant describes a derived image, such as a thumbnail or an avatar
+type Variant struct {
+	// Name identifies the variant and is appended to the stored file name
+	Name string
+	// Width and Height are the target size in pixels; zero is unbounded for ModeFit
+	// and derived from the aspect ratio for ModeResize
+	Width  int
+	Height int
+	Mode   Mode
+	// Format is the encoding of the variant, the format of the source when empty
+	Format Format
+	// Quality of JPEG variants, 85 when zero
+	Quality int
+}
+
+// OutputFormat returns the format the variant is encoded in for a source format
+func (v Variant) OutputFormat(source Format) Format {
+	if v.Format != "" {
+		return v.Format
+	}
+	return source
+}
+
+// Apply sizes the image as described by the variant
+func (v Variant) Apply(img image.Image) image.Image {
+	switch v.Mode {
+	case ModeFill:
+		return Fill(img, v.Width, v.Height)
+	case ModeResize:
+		return Resize(img, v.Width, v.Height)
+	}
+	return Fit(img, v.Width, v.Height)
+}
+
+// Output is an encoded variant
+type Output struct {
+	Variant Variant
+	Format  Format
+	Width   int
+	Height  int
+	Data    []byte
+}
+
+// Process decodes the image once, within the limits of options, and encodes every
+// variant of it, in order
+func Process(r io.Reader, options DecodeOptions, variants ...Variant) ([]Output, error) {
+	img, format, err := Decode(r, options)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]Output, 0, len(variants))
+	for _, variant := range variants {
+		sized := variant.Apply(img)
+		outputFormat := variant.OutputFormat(format)
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, sized, outputFormat, EncodeOptions{Quality: variant.Quality}); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, Output{
+			Variant: variant,
+			Format:  outputFormat,
+			Width:   sized.Bounds().Dx(),
+			Height:  sized.Bounds().Dy(),
+			Data:    buf.Bytes(),
+		})
+	}
+	return outputs, nil
+}
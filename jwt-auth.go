@@ -0,0 +1,193 @@
+package gudu
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deenikarim/gudu/cache"
+	"github.com/deenikarim/gudu/jwt"
+)
+
+// jwtConfig holds the JWT settings, read from the environment
+type jwtConfig struct {
+	algorithm      string
+	secret         string
+	privateKeyFile string
+	previousKeys   []string
+	options        jwt.Options
+}
+
+// loadJWTConfig reads the JWT settings. JWT_ALGORITHM (HS256, RS256 or EdDSA) enables
+// the module; HS256 signs with JWT_SECRET, by default a key derived from the application
+// KEY, the others with the PEM private key in JWT_PRIVATE_KEY_FILE.
+// JWT_PREVIOUS_KEY_FILES lists retired private keys still accepted for verification.
+func loadJWTConfig() jwtConfig {
+	return jwtConfig{
+		algorithm:      os.Getenv("JWT_ALGORITHM"),
+		secret:         os.Getenv("JWT_SECRET"),
+		privateKeyFile: os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		previousKeys:   splitEnvList("JWT_PREVIOUS_KEY_FILES"),
+		options: jwt.Options{
+			Issuer:     os.Getenv("JWT_ISSUER"),
+			Audience:   splitEnvList("JWT_AUDIENCE"),
+			AccessTTL:  envDuration("JWT_ACCESS_TTL"),
+			RefreshTTL: envDuration("JWT_REFRESH_TTL"),
+			Leeway:     envDuration("JWT_LEEWAY"),
+		},
+	}
+}
+
+// envDuration parses a duration such as 15m from the environment, zero when unset
+func envDuration(key string) time.Duration {
+	d, _ := time.ParseDuration(os.Getenv(key))
+	return d
+}
+
+// createJWT creates g.JWT when JWT_ALGORITHM is set. Refresh token state is kept in the
+// application cache, or in memory without one.
+func (g *Gudu) createJWT() error {
+	config := g.config.jwt
+	if config.algorithm == "" {
+		return nil
+	}
+
+	var keys []jwt.Key
+	switch jwt.Algorithm(config.algorithm) {
+	case jwt.HS256:
+		if config.secret != "" {
+			if len(config.secret) < 32 {
+				return errors.New("HS256 needs a JWT_SECRET of at least 32 characters")
+			}
+			keys = append(keys, jwt.NewHMACKey([]byte(config.secret)))
+			break
+		}
+		if len(g.EncryptionKey) < 32 {
+			return errors.New("HS256 needs a JWT_SECRET or KEY of at least 32 characters")
+		}
+		// tokens are signed with a key derived from KEY, and verified with the keys
+		// derived from PREVIOUS_KEYS too while rotating
+		for _, key := range g.signingKeys() {
+			keys = append(keys, jwt.NewHMACKey(deriveKey(key, "gudu jwt")))
+		}
+	case jwt.RS256, jwt.EdDSA:
+		for _, file := range append([]string{config.privateKeyFile}, config.previousKeys...) {
+			key, err := g.loadJWTKey(file)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		if keys[0].Algorithm != jwt.Algorithm(config.algorithm) {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE holds a %s key, not %s", keys[0].Algorithm, config.algorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %s", config.algorithm)
+	}
+
+	var store jwt.Store = jwt.NewMemoryStore()
+	if g.Cache != nil {
+		store = cacheStore{g.Cache}
+	}
+	manager, err := jwt.New(config.options, store, keys...)
+	if err != nil {
+		return err
+	}
+	g.JWT = manager
+	return nil
+}
+
+// cacheStore adapts a cache to jwt.Store, auth.Store and twofactor.Store; some cache
+// drivers fail on missing keys, so existence is checked first
+type cacheStore struct {
+	cache cache.Cache
+}
+
+func (s cacheStore) Get(key string) (interface{}, error) {
+	exists, err := s.cache.Exists(key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return s.cache.Get(key)
+}
+
+func (s cacheStore) Set(key string, value interface{}, expires ...time.Duration) error {
+	return s.cache.Set(key, value, expires...)
+}
+
+func (s cacheStore) SetIfAbsent(key string, value interface{}, expires ...time.Duration) (bool, error) {
+	return s.cache.SetIfAbsent(key, value, expires...)
+}
+
+func (s cacheStore) Delete(key string) error {
+	return s.cache.Delete(key)
+}
+
+func (s cacheStore) Increment(key string, expires ...time.Duration) (int64, error) {
+	return s.cache.Increment(key, expires...)
+}
+
+// loadJWTKey reads a PEM private key, relative paths are below the application root
+func (g *Gudu) loadJWTKey(file string) (jwt.Key, error) {
+	if file == "" {
+		return jwt.Key{}, errors.New("JWT_PRIVATE_KEY_FILE is required for RS256 and EdDSA")
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(g.RootPath, file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return jwt.Key{}, err
+	}
+	return jwt.ParsePrivateKeyPEM(data)
+}
+
+// JWTAuth middleware requires a valid bearer access token and places its claims in the
+// request context, read them with jwt.FromContext. Other requests get a 401 problem.
+func (g *Gudu) JWTAuth(next http.Handler) http.Handler {
+	if g.JWT == nil {
+		panic("gudu: JWTAuth needs JWT_ALGORITHM to be set")
+	}
+	return g.JWT.Middleware(func(w http.ResponseWriter, r *http.Request, err error) {
+		detail := "A valid bearer access token is required."
+		if errors.Is(err, jwt.ErrExpired) {
+			detail = "The access token has expired."
+		}
+		g.HandleError(w, r, NewProblem(http.StatusUnauthorized, detail))
+	})(next)
+}
+
+// JWTClaims returns the claims of the request authenticated by JWTAuth
+func JWTClaims(r *http.Request) (*jwt.Claims, bool) {
+	return jwt.FromContext(r.Context())
+}
+
+// jwtProblem maps the errors of token refreshes to problems, 401 for rejected tokens
+func jwtProblem(err error) error {
+	for _, target := range []error{jwt.ErrInvalidToken, jwt.ErrExpired, jwt.ErrNotYetValid, jwt.ErrInvalidIssuer,
+		jwt.ErrInvalidAudience, jwt.ErrWrongTokenUse, jwt.ErrRevoked, jwt.ErrRefreshReused} {
+		if errors.Is(err, target) {
+			return NewProblem(http.StatusUnauthorized, strings.TrimPrefix(err.Error(), "jwt: "))
+		}
+	}
+	return err
+}
+
+// RefreshJWT exchanges the refresh token for a new token pair, returning a 401 problem
+// for rejected tokens, e.g. in a handler registered with Gudu.Handle:
+//
+//	pair, err := g.RefreshJWT(input.RefreshToken)
+func (g *Gudu) RefreshJWT(refreshToken string) (*jwt.TokenPair, error) {
+	if g.JWT == nil {
+		return nil, errors.New("jwt is not enabled, set JWT_ALGORITHM")
+	}
+	pair, err := g.JWT.Refresh(refreshToken)
+	if err != nil {
+		return nil, jwtProblem(err)
+	}
+	return pair, nil
+}
@@ -0,0 +1,36 @@
+package gudu
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deenikarim/gudu/jwt"
+)
+
+func TestJWTSignsWithKeyDerivedFromKEY(t *testing.T) {
+	g := testGudu(t)
+	g.EncryptionKey = testKey
+	g.config.jwt = jwtConfig{algorithm: string(jwt.HS256)}
+	if err := g.createJWT(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := g.JWT.Sign(jwt.Claims{Subject: "1", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := jwt.New(jwt.Options{}, jwt.NewMemoryStore(), jwt.NewHMACKey([]byte(testKey)))
+	if _, err := raw.Parse(token); !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Errorf("the raw KEY verifies the token: %v", err)
+	}
+
+	// tokens of the previous key stay valid while rotating
+	g.EncryptionKey, g.PreviousKeys = previousKey, []string{testKey}
+	if err := g.createJWT(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.JWT.Parse(token); err != nil {
+		t.Errorf("token of the previous key: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package jwt issues and validates JSON Web Tokens signed with HS256, RS256 or EdDSA:
+// short-lived access tokens, rotating refresh tokens with reuse detection, a JWKS
+// document of the public keys and a middleware placing the claims in the request
+// context.
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens and bad signatures
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	// ErrExpired is returned for tokens past their exp claim
+	ErrExpired = errors.New("jwt: token has expired")
+	// ErrNotYetValid is returned for tokens before their nbf claim
+	ErrNotYetValid = errors.New("jwt: token is not valid yet")
+	// ErrInvalidIssuer is returned when the iss claim is not the expected issuer
+	ErrInvalidIssuer = errors.New("jwt: invalid issuer")
+	// ErrInvalidAudience is returned when the aud claim has none of the expected
+	// audiences
+	ErrInvalidAudience = errors.New("jwt: invalid audience")
+	// ErrWrongTokenUse is returned for refresh tokens used as access tokens and the
+	// other way round
+	ErrWrongTokenUse = errors.New("jwt: wrong token use")
+	// ErrRevoked is returned for refresh tokens that were revoked or are unknown
+	ErrRevoked = errors.New("jwt: refresh token has been revoked")
+	// ErrRefreshReused is returned when a refresh token is used twice; the whole token
+	// family is revoked, as the token was probably stolen
+	ErrRefreshReused = errors.New("jwt: refresh token reuse detected")
+)
+
+// token uses
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// registeredClaims are the claim names of Claims, not copied into Extra
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "token_use", "fam"}
+
+// Claims holds the registered claims of a token and any custom ones in Extra
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	// TokenUse tells access and refresh tokens apart
+	TokenUse string `json:"token_use,omitempty"`
+	// Family links the refresh tokens rotated from one login
+	Family string `json:"fam,omitempty"`
+	// Extra holds the custom claims, such as roles or a tenant
+	Extra map[string]interface{} `json:"-"`
+}
+
+// claimsJSON avoids recursing into the methods of Claims
+type claimsJSON Claims
+
+// MarshalJSON writes the registered and the custom claims as one object
+func (c Claims) MarshalJSON() ([]byte, error) {
+	registered, err := json.Marshal(claimsJSON(c))
+	if err != nil || len(c.Extra) == 0 {
+		return registered, err
+	}
+
+	all := make(map[string]interface{}, len(c.Extra)+len(registeredClaims))
+	for name, value := range c.Extra {
+		if !slices.Contains(registeredClaims, name) {
+			all[name] = value
+		}
+	}
+	if err := json.Unmarshal(registered, &all); err != nil {
+		return nil, err
+	}
+	return json.Marshal(all)
+}
+
+// UnmarshalJSON reads the registered claims and keeps the others in Extra
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*claimsJSON)(c)); err != nil {
+		return err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for name, value := range all {
+		if slices.Contains(registeredClaims, name) {
+			continue
+		}
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{})
+		}
+		c.Extra[name] = value
+	}
+	return nil
+}
+
+// Audience is the aud claim, a single string or an array of strings
+type Audience []string
+
+// MarshalJSON writes a single audience as a string
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON accepts a string or an array of strings
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
@@ -0,0 +1,219 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testKeys returns a key of every algorithm
+func testKeys(t *testing.T) []Key {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []Key{NewHMACKey([]byte("0123456789abcdef0123456789abcdef")), NewRSAKey(rsaKey), NewEd25519Key(edKey)}
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, key := range testKeys(t) {
+		m, err := New(Options{Issuer: "gudu", Audience: []string{"api"}}, NewMemoryStore(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pair, err := m.IssuePair("42", map[string]interface{}{"role": "admin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := m.ParseAccess(pair.AccessToken)
+		if err != nil {
+			t.Fatalf("%s: %v", key.Algorithm, err)
+		}
+		if claims.Subject != "42" || claims.Extra["role"] != "admin" || claims.Issuer != "gudu" {
+			t.Errorf("%s: unexpected claims %+v", key.Algorithm, claims)
+		}
+		if _, err := m.ParseAccess(pair.RefreshToken); !errors.Is(err, ErrWrongTokenUse) {
+			t.Errorf("%s: expected a refresh token to be rejected as access token, got %v", key.Algorithm, err)
+		}
+
+		// flipping a byte of the signature invalidates the token
+		tampered := pair.AccessToken[:len(pair.AccessToken)-2] + "AA"
+		if _, err := m.Parse(tampered); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected a tampered token to be invalid, got %v", key.Algorithm, err)
+		}
+	}
+}
+
+func TestValidateClaims(t *testing.T) {
+	key := NewHMACKey([]byte("0123456789abcdef0123456789abcdef"))
+	m, _ := New(Options{Issuer: "gudu", Audience: []string{"api"}, Leeway: 30 * time.Second}, NewMemoryStore(), key)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims Claims
+		err    error
+	}{
+		{"valid", Claims{Issuer: "gudu", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Minute).Unix()}, nil},
+		{"within leeway", Claims{Issuer: "gudu", Audience: Audience{"api"}, ExpiresAt: now.Add(-10 * time.Second).Unix()}, nil},
+		{"expired", Claims{Issuer: "gudu", Audience: Audience{"api"}, ExpiresAt: now.Add(-time.Minute).Unix()}, ErrExpired},
+		{"not yet valid", Claims{Issuer: "gudu", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Hour).Unix(), NotBefore: now.Add(time.Minute).Unix()}, ErrNotYetValid},
+		{"issuer", Claims{Issuer: "other", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Minute).Unix()}, ErrInvalidIssuer},
+		{"audience", Claims{Issuer: "gudu", Audience: Audience{"web"}, ExpiresAt: now.Add(time.Minute).Unix()}, ErrInvalidAudience},
+		{"no expiry", Claims{Issuer: "gudu", Audience: Audience{"api"}}, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		token, err := m.Sign(tt.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Parse(token); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	keys := testKeys(t)
+	m, _ := New(Options{}, NewMemoryStore(), keys[1])
+
+	// a token claiming "none" or HS256 with the RSA key id is rejected
+	for _, alg := range []string{"none", "HS256"} {
+		head := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `","kid":"` + keys[1].ID + `"}`))
+		body := base64.RawURLEncoding.EncodeToString([]byte(`{"exp":9999999999}`))
+		if _, err := m.Parse(head + "." + body + "."); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", alg, err)
+		}
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	m, _ := New(Options{}, NewMemoryStore(), NewHMACKey([]byte("0123456789abcdef0123456789abcdef")))
+	first, err := m.IssuePair("7", map[string]interface{}{"tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := m.ParseAccess(second.AccessToken)
+	if err != nil || claims.Subject != "7" || claims.Extra["tenant"] != "acme" {
+		t.Fatalf("unexpected refreshed claims %+v %v", claims, err)
+	}
+
+	// replaying the first refresh token revokes the family
+	if _, err := m.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("expected ErrRefreshReused, got %v", err)
+	}
+	if _, err := m.Refresh(second.RefreshToken); !errors.Is(err, ErrRevoked) {
+		t.Errorf("expected the newest token of the family to be revoked, got %v", err)
+	}
+
+	// logging out revokes the family too
+	third, _ := m.IssuePair("7", nil)
+	if err := m.Revoke(third.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Refresh(third.RefreshToken); !errors.Is(err, ErrRevoked) {
+		t.Errorf("expected ErrRevoked after logout, got %v", err)
+	}
+}
+
+func TestConcurrentRefreshesCountAsReuse(t *testing.T) {
+	m, _ := New(Options{}, NewMemoryStore(), NewHMACKey([]byte("0123456789abcdef0123456789abcdef")))
+	pair, err := m.IssuePair("7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	refreshed, reused := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Refresh(pair.RefreshToken)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				refreshed++
+			case errors.Is(err, ErrRefreshReused) || errors.Is(err, ErrRevoked):
+				reused++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshed != 1 || reused != 19 {
+		t.Errorf("refreshed %d times and refused %d, want 1 and 19", refreshed, reused)
+	}
+}
+
+func TestKeyRotationAndJWKS(t *testing.T) {
+	keys := testKeys(t)
+	old, _ := New(Options{}, NewMemoryStore(), keys[1])
+	token, _ := old.Sign(Claims{Subject: "1", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+
+	rotated, _ := New(Options{}, NewMemoryStore(), keys[2], keys[1], keys[0])
+	if _, err := rotated.Parse(token); err != nil {
+		t.Errorf("expected tokens of the previous key to verify, got %v", err)
+	}
+
+	set := rotated.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].KeyType != "OKP" || set.Keys[1].KeyType != "RSA" {
+		t.Errorf("expected the ed25519 and rsa public keys only, got %+v", set.Keys)
+	}
+
+	w := httptest.NewRecorder()
+	rotated.JWKSHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if !strings.Contains(w.Body.String(), `"crv":"Ed25519"`) {
+		t.Errorf("unexpected jwks %s", w.Body.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m, _ := New(Options{}, NewMemoryStore(), NewHMACKey([]byte("0123456789abcdef0123456789abcdef")))
+	pair, _ := m.IssuePair("9", nil)
+
+	handler := m.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		if !ok {
+			t.Error("expected claims in the context")
+			return
+		}
+		_, _ = w.Write([]byte(claims.Subject))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "9" {
+		t.Errorf("expected the subject, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected 401 with WWW-Authenticate, got %d", w.Code)
+	}
+}
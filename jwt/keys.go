@@ -0,0 +1,247 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+// Algorithm is a signing algorithm
+type Algorithm string
+
+const (
+	HS256 Algorithm = "HS256"
+	RS256 Algorithm = "RS256"
+	EdDSA Algorithm = "EdDSA"
+)
+
+// Key signs and verifies tokens. Keys of a Manager are told apart by their ID, the kid
+// header of the tokens they signed.
+type Key struct {
+	ID        string
+	Algorithm Algorithm
+	// secret is the HS256 key
+	secret []byte
+	// private signs RS256 and EdDSA tokens, nil for verification only keys
+	private crypto.Signer
+	// public verifies RS256 and EdDSA tokens
+	public crypto.PublicKey
+}
+
+// NewHMACKey creates an HS256 key; the secret should be at least 32 bytes
+func NewHMACKey(secret []byte) Key {
+	sum := sha256.Sum256(secret)
+	return Key{ID: base64.RawURLEncoding.EncodeToString(sum[:8]), Algorithm: HS256, secret: secret}
+}
+
+// NewRSAKey creates an RS256 key
+func NewRSAKey(private *rsa.PrivateKey) Key {
+	return Key{ID: publicKeyID(&private.PublicKey), Algorithm: RS256, private: private, public: &private.PublicKey}
+}
+
+// NewEd25519Key creates an EdDSA key
+func NewEd25519Key(private ed25519.PrivateKey) Key {
+	public := private.Public()
+	return Key{ID: publicKeyID(public), Algorithm: EdDSA, private: private, public: public}
+}
+
+// NewVerificationKey creates an RS256 or EdDSA key that only verifies tokens, e.g. the
+// retired key of a rotation
+func NewVerificationKey(public crypto.PublicKey) (Key, error) {
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return Key{ID: publicKeyID(public), Algorithm: RS256, public: public}, nil
+	case ed25519.PublicKey:
+		return Key{ID: publicKeyID(public), Algorithm: EdDSA, public: public}, nil
+	}
+	return Key{}, fmt.Errorf("jwt: unsupported public key %T", public)
+}
+
+// ParsePrivateKeyPEM creates an RS256 or EdDSA key from a PEM encoded PKCS #8 or
+// PKCS #1 private key
+func ParsePrivateKeyPEM(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("jwt: no PEM data found")
+	}
+	if private, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewRSAKey(private), nil
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return Key{}, fmt.Errorf("jwt: %w", err)
+	}
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(private), nil
+	case ed25519.PrivateKey:
+		return NewEd25519Key(private), nil
+	}
+	return Key{}, fmt.Errorf("jwt: unsupported private key %T", private)
+}
+
+// canSign reports whether the key holds the secret or private key
+func (k Key) canSign() bool {
+	return len(k.secret) > 0 || k.private != nil
+}
+
+// sign signs the signing input of a token
+func (k Key) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		digest := sha256.Sum256(input)
+		return k.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case EdDSA:
+		return k.private.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+	return nil, fmt.Errorf("jwt: unsupported algorithm %s", k.Algorithm)
+}
+
+// verify checks the signature of the signing input
+func (k Key) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		expected, _ := k.sign(input)
+		return hmac.Equal(expected, signature)
+	case RS256:
+		public, ok := k.public.(*rsa.PublicKey)
+		digest := sha256.Sum256(input)
+		return ok && rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case EdDSA:
+		public, ok := k.public.(ed25519.PublicKey)
+		return ok && ed25519.Verify(public, input, signature)
+	}
+	return false
+}
+
+// publicKeyID derives a key id from the public key
+func publicKeyID(public crypto.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(public)
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// JWK is a public key of a JWKS document
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the Ed25519 curve and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk returns the public part of an RS256 or EdDSA key; HS256 keys are secret
+func (k Key) jwk() (JWK, bool) {
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: string(RS256),
+			N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: string(EdDSA),
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(public),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// Key creates a verification key from an RSA or Ed25519 JWK, keeping its kid
+func (j JWK) Key() (Key, error) {
+	var public crypto.PublicKey
+	switch j.KeyType {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return Key{}, errors.New("jwt: invalid RSA JWK")
+		}
+		public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || j.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.New("jwt: invalid Ed25519 JWK")
+		}
+		public = ed25519.PublicKey(x)
+	default:
+		return Key{}, fmt.Errorf("jwt: unsupported JWK key type %q", j.KeyType)
+	}
+
+	key, err := NewVerificationKey(public)
+	if err != nil {
+		return Key{}, err
+	}
+	if j.KeyID != "" {
+		key.ID = j.KeyID
+	}
+	return key, nil
+}
+
+// VerificationKeys returns the signing keys of the set that can be used, skipping
+// encryption keys and unsupported key types
+func (s JWKS) VerificationKeys() []Key {
+	keys := make([]Key, 0, len(s.Keys))
+	for _, jwk := range s.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.Key(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// JWKS returns the public keys, for clients verifying tokens themselves
+func (m *Manager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range m.keys {
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// JWKSHandler serves the JWKS document, usually at /.well-known/jwks.json
+func (m *Manager) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(m.JWKS())
+	})
+}
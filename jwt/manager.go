@@ -0,0 +1,333 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Options configures a Manager; zero durations select the defaults
+type Options struct {
+	// Issuer is written to the iss claim and, when set, required of parsed tokens
+	Issuer string
+	// Audience is written to the aud claim; parsed tokens must name one of them
+	Audience []string
+	// AccessTTL is the lifetime of access tokens, 15 minutes by default
+	AccessTTL time.Duration
+	// RefreshTTL is the lifetime of refresh tokens, 30 days by default
+	RefreshTTL time.Duration
+	// Leeway is the clock skew tolerated for exp and nbf, 1 minute by default
+	Leeway time.Duration
+}
+
+// TokenPair is the response of a login or refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Manager issues and validates tokens. The first key signs, all keys verify, so a
+// retired key can be kept while the tokens it signed expire.
+type Manager struct {
+	options Options
+	keys    []Key
+	store   Store
+	now     func() time.Time
+}
+
+// header is the JOSE header of a token
+type header struct {
+	Algorithm Algorithm `json:"alg"`
+	Type      string    `json:"typ,omitempty"`
+	KeyID     string    `json:"kid,omitempty"`
+}
+
+// New creates a Manager; the store keeps the refresh token state
+func New(options Options, store Store, keys ...Key) (*Manager, error) {
+	if len(keys) == 0 || !keys[0].canSign() {
+		return nil, errors.New("jwt: the first key must be able to sign")
+	}
+	if store == nil {
+		return nil, errors.New("jwt: a store is required for refresh tokens")
+	}
+	if options.AccessTTL <= 0 {
+		options.AccessTTL = 15 * time.Minute
+	}
+	if options.RefreshTTL <= 0 {
+		options.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if options.Leeway <= 0 {
+		options.Leeway = time.Minute
+	}
+	return &Manager{options: options, keys: keys, store: store, now: time.Now}, nil
+}
+
+// Sign signs the claims as they are with the current key
+func (m *Manager) Sign(claims Claims) (string, error) {
+	key := m.keys[0]
+	head, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(head) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := key.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Parse verifies the signature of a token and validates its exp, nbf, iss and aud
+// claims. The algorithm must be the one of the key named by the kid header, so
+// tokens can not switch to "none" or sign with a public key as HMAC secret.
+func (m *Manager) Parse(token string) (*Claims, error) {
+	return parse(token, m.options, m.now(), m.keys)
+}
+
+// Verify parses a token signed by one of keys as Manager.Parse does, for tokens of
+// other issuers such as OpenID Connect ID tokens verified with the keys of their JWKS.
+// A zero Leeway selects 1 minute.
+func Verify(token string, options Options, keys ...Key) (*Claims, error) {
+	if options.Leeway <= 0 {
+		options.Leeway = time.Minute
+	}
+	return parse(token, options, time.Now(), keys)
+}
+
+// parse verifies and validates a token at now
+func parse(token string, options Options, now time.Time, keys []Key) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var head header
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, ok := verificationKey(keys, head)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := validate(&claims, options, now); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verificationKey finds the key of a token header
+func verificationKey(keys []Key, head header) (Key, bool) {
+	for _, key := range keys {
+		if key.Algorithm != head.Algorithm {
+			continue
+		}
+		if head.KeyID == "" || key.ID == head.KeyID {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// validate checks the time, issuer and audience claims
+func validate(claims *Claims, options Options, now time.Time) error {
+	leeway := int64(options.Leeway / time.Second)
+
+	if claims.ExpiresAt == 0 {
+		return ErrInvalidToken
+	}
+	if now.Unix() > claims.ExpiresAt+leeway {
+		return ErrExpired
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore-leeway {
+		return ErrNotYetValid
+	}
+	if options.Issuer != "" && claims.Issuer != options.Issuer {
+		return ErrInvalidIssuer
+	}
+	if len(options.Audience) > 0 && !slices.ContainsFunc(claims.Audience, func(audience string) bool {
+		return slices.Contains(options.Audience, audience)
+	}) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// ParseAccess parses an access token, rejecting refresh tokens
+func (m *Manager) ParseAccess(token string) (*Claims, error) {
+	claims, err := m.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != AccessToken {
+		return nil, ErrWrongTokenUse
+	}
+	return claims, nil
+}
+
+// IssuePair issues an access and a refresh token for the subject, starting a new
+// refresh token family; extra becomes the custom claims of the access token
+func (m *Manager) IssuePair(subject string, extra map[string]interface{}) (*TokenPair, error) {
+	family, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	return m.issuePair(subject, family, extra)
+}
+
+// Refresh exchanges a refresh token for a new pair. Every refresh token works once:
+// using one again revokes its whole family, logging out whoever holds the newest token,
+// and returns ErrRefreshReused. The custom claims are carried to the new tokens.
+func (m *Manager) Refresh(refreshToken string) (*TokenPair, error) {
+	claims, err := m.Parse(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != RefreshToken || claims.ID == "" || claims.Family == "" {
+		return nil, ErrWrongTokenUse
+	}
+
+	if revoked, err := m.store.Get(familyKey(claims.Family)); err != nil {
+		return nil, err
+	} else if revoked != nil {
+		return nil, ErrRevoked
+	}
+
+	if state, err := m.store.Get(refreshKey(claims.ID)); err != nil {
+		return nil, err
+	} else if state == nil {
+		return nil, ErrRevoked
+	}
+
+	// marking the token used is a single set-if-absent, so of concurrent refreshes with
+	// the same token only one succeeds and the others count as reuse
+	remaining := time.Until(time.Unix(claims.ExpiresAt, 0)) + m.options.Leeway
+	first, err := m.store.SetIfAbsent(usedKey(claims.ID), "used", remaining)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		if err := m.store.Set(familyKey(claims.Family), "revoked", m.options.RefreshTTL); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshReused
+	}
+	return m.issuePair(claims.Subject, claims.Family, claims.Extra)
+}
+
+// Revoke revokes the family of a refresh token, e.g. on logout
+func (m *Manager) Revoke(refreshToken string) error {
+	claims, err := m.Parse(refreshToken)
+	if err != nil {
+		return err
+	}
+	if claims.TokenUse != RefreshToken || claims.Family == "" {
+		return ErrWrongTokenUse
+	}
+	return m.store.Set(familyKey(claims.Family), "revoked", m.options.RefreshTTL)
+}
+
+// issuePair signs an access and a refresh token of the family
+func (m *Manager) issuePair(subject, family string, extra map[string]interface{}) (*TokenPair, error) {
+	now := m.now()
+	accessID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	refreshID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	base := Claims{
+		Issuer:   m.options.Issuer,
+		Subject:  subject,
+		Audience: m.options.Audience,
+		IssuedAt: now.Unix(),
+		Extra:    extra,
+	}
+
+	access := base
+	access.ID = accessID
+	access.TokenUse = AccessToken
+	access.ExpiresAt = now.Add(m.options.AccessTTL).Unix()
+	accessToken, err := m.Sign(access)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := base
+	refresh.ID = refreshID
+	refresh.TokenUse = RefreshToken
+	refresh.Family = family
+	refresh.ExpiresAt = now.Add(m.options.RefreshTTL).Unix()
+	refreshToken, err := m.Sign(refresh)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Set(refreshKey(refreshID), "active", m.options.RefreshTTL+m.options.Leeway); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.options.AccessTTL / time.Second),
+	}, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// randomID returns 16 random bytes, hex encoded
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("jwt: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// refreshKey, usedKey and familyKey are the store keys of the refresh token state
+func refreshKey(id string) string {
+	return "jwt:refresh:" + id
+}
+
+func usedKey(id string) string {
+	return "jwt:used:" + id
+}
+
+func familyKey(family string) string {
+	return "jwt:family:" + family
+}
@@ -0,0 +1,61 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// contextKey is the type of the request context key of the claims
+type contextKey struct{}
+
+// NewContext returns a context carrying the claims of the authenticated principal
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims placed in the context by Middleware
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// Authenticate validates the bearer access token of the request
+func (m *Manager) Authenticate(r *http.Request) (*Claims, error) {
+	token, ok := BearerToken(r)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return m.ParseAccess(token)
+}
+
+// Middleware authenticates requests by their bearer access token and places the claims
+// in the request context, see FromContext. Other requests are answered by onError,
+// or with a plain 401 Unauthorized when it is nil; the WWW-Authenticate header is set
+// either way.
+func (m *Manager) Middleware(onError func(w http.ResponseWriter, r *http.Request, err error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := m.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				if onError != nil {
+					onError(w, r, err)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps the state of refresh tokens. It is satisfied by the gudu cache.Cache
+// drivers, so every instance of an application shares the state; Get returns nil for
+// missing keys.
+type Store interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}, expires ...time.Duration) error
+	// SetIfAbsent atomically stores the value unless the key exists, reporting whether
+	// it was stored
+	SetIfAbsent(key string, value interface{}, expires ...time.Duration) (bool, error)
+}
+
+// MemoryStore is a Store for a single process and tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// memoryEntry is a value with its expiry, zero for none
+type memoryEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get returns the value, nil when missing or expired
+func (s *MemoryStore) Get(key string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+	return entry.value, nil
+}
+
+// Set stores the value, expiring after the optional duration
+func (s *MemoryStore) Set(key string, value interface{}, expires ...time.Duration) error {
+	entry := memoryEntry{value: value}
+	if len(expires) > 0 && expires[0] > 0 {
+		entry.expires = time.Now().Add(expires[0])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+// SetIfAbsent stores the value unless the key exists and has not expired
+func (s *MemoryStore) SetIfAbsent(key string, value interface{}, expires ...time.Duration) (bool, error) {
+	entry := memoryEntry{value: value}
+	if len(expires) > 0 && expires[0] > 0 {
+		entry.expires = time.Now().Add(expires[0])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.entries[key]; ok && (existing.expires.IsZero() || time.Now().Before(existing.expires)) {
+		return false, nil
+	}
+	s.entries[key] = entry
+	return true, nil
+}
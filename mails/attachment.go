@@ -3,6 +3,7 @@ package mails
 import (
 	"encoding/base64"
 	"errors"
+	"io"
 	"mime"
 	"os"
 	"path/filepath"
@@ -68,3 +69,25 @@ func NewAttachmentFromBytes(name string, data []byte, mimeType string, inline bo
 		Inline:   inline,
 	}, nil
 }
+
+// NewAttachmentFromReader creates a new attachment from a reader, such as a file
+// of a storage disk; the mime type is guessed from the name when empty
+func NewAttachmentFromReader(name string, r io.Reader, mimeType string, inline bool) (*Attachment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	return &Attachment{
+		Name:     name,
+		Data:     data,
+		MimeType: mimeType,
+		Inline:   inline,
+	}, nil
+}
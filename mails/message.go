@@ -1,5 +1,7 @@
 package mails
 
+import "io"
+
 // EmailAddress represents an email address with a name
 type EmailAddress struct {
 	Address string
@@ -63,6 +65,16 @@ func (m *Message) AddAttachmentFromFile(filePath string, inline bool) error {
 	return nil
 }
 
+// AddAttachmentFromReader adds an attachment read from a reader to the email
+func (m *Message) AddAttachmentFromReader(name string, r io.Reader, mimeType string, inline bool) error {
+	attachment, err := NewAttachmentFromReader(name, r, mimeType, inline)
+	if err != nil {
+		return err
+	}
+	m.Attachments = append(m.Attachments, *attachment)
+	return nil
+}
+
 // AddAttachmentFromBase64 adds an attachment from a base64 string to the email
 func (m *Message) AddAttachmentFromBase64(name, b64Data, mimeType string, inline bool) error {
 	attachment, err := NewAttachmentFromBase64(name, b64Data, mimeType, inline)
@@ -0,0 +1,372 @@
+package gudu
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseCachePrefix prefixes the keys of cached responses in the cache store
+const responseCachePrefix = "http-cache"
+
+// maxCachedResponseSize is the largest response body stored by the response cache
+const maxCachedResponseSize = 1 << 20
+
+// ResponseCacheOptions marks a route as cacheable and holds how its responses are cached
+type ResponseCacheOptions struct {
+	// TTL is how long a response stays in the cache, 0 keeps it until purged
+	TTL time.Duration
+	// VaryHeaders lists the request headers that become part of the cache key
+	VaryHeaders []string
+	// Tags group cached responses so they can be purged together with PurgeCacheTags
+	Tags []string
+	// MaxAge, when set, adds a public Cache-Control max-age for browsers and proxies
+	MaxAge time.Duration
+	// VarySession caches responses per session, keyed by the session cookie. Without
+	// it requests carrying cookies or an Authorization header bypass the cache, as
+	// their responses may be personal.
+	VarySession bool
+}
+
+// cachedResponse is the form in which a response is stored in the cache
+type cachedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+}
+
+// ConditionalGet returns a middleware answering GET and HEAD requests with 304 Not
+// Modified when If-None-Match or If-Modified-Since match the ETag or Last-Modified
+// header set by the handler
+func (g *Gudu) ConditionalGet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&conditionalResponseWriter{ResponseWriter: w, request: r}, r)
+	})
+}
+
+// conditionalResponseWriter swaps a 200 for a 304 when the request conditions match
+// the headers written by the handler, discarding the body
+type conditionalResponseWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+	notModified bool
+}
+
+func (cw *conditionalResponseWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	if status == http.StatusOK && isNotModified(cw.request, cw.Header()) {
+		cw.notModified = true
+		writeNotModified(cw.ResponseWriter)
+		return
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *conditionalResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.notModified {
+		return len(b), nil
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (cw *conditionalResponseWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok && !cw.notModified {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (cw *conditionalResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController
+func (cw *conditionalResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// CacheResponse returns a per-route middleware storing whole GET responses in the
+// configured cache; HEAD requests are answered from them but never stored. Only 200 responses without Set-Cookie, no-store or private
+// Cache-Control are stored, and pages using the CSP nonce of their request are not.
+// Only the headers set by the handler are stored, the ones of earlier middlewares such
+// as CORS and Content-Security-Policy are fresh for every request. Cached responses
+// are served with conditional request handling, so clients holding a matching ETag
+// receive a 304.
+//
+//	mux.With(app.CacheResponse(gudu.ResponseCacheOptions{TTL: time.Minute, Tags: []string{"posts"}})).
+//		Get("/posts", handlers.Posts)
+func (g *Gudu) CacheResponse(options ResponseCacheOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if g.Cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !options.VarySession && (r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := g.responseCacheKey(r, options)
+
+			// serve from the cache unless the client asks to bypass it
+			if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				if entry, ok := g.getCachedResponse(key); ok {
+					g.writeCachedResponse(w, r, entry, "HIT")
+					return
+				}
+			}
+
+			// the headers of earlier middlewares are set again for every request
+			before := w.Header().Clone()
+			recorder := &cacheResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			if options.MaxAge > 0 && w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(options.MaxAge.Seconds())))
+			}
+			w.Header().Set("X-Cache", "MISS")
+
+			next.ServeHTTP(recorder, r)
+
+			// HEAD responses carry no body, they are served from GET entries but never stored
+			if r.Method == http.MethodHead || !recorder.isCacheable() {
+				return
+			}
+			if nonce := g.CSPNonce(r); nonce != "" && bytes.Contains(recorder.body.Bytes(), []byte(nonce)) {
+				return
+			}
+
+			headers := handlerHeaders(before, recorder.Header())
+			headers.Del("X-Cache")
+			if headers.Get("ETag") == "" {
+				headers.Set("ETag", GenerateETag(recorder.body.Bytes(), false))
+			}
+			if headers.Get("Last-Modified") == "" {
+				headers.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			}
+
+			content, err := json.Marshal(cachedResponse{
+				Status:  recorder.status,
+				Headers: headers,
+				Body:    recorder.body.Bytes(),
+			})
+			if err != nil {
+				g.ErrorLog.Println("response cache encode:", err)
+				return
+			}
+			var expires []time.Duration
+			if options.TTL > 0 {
+				expires = append(expires, options.TTL)
+			}
+			if err := g.Cache.Set(key, content, expires...); err != nil {
+				g.ErrorLog.Println("response cache store:", err)
+			}
+		})
+	}
+}
+
+// PurgeCacheTags invalidates every cached response stored under one of the tags
+func (g *Gudu) PurgeCacheTags(tags ...string) error {
+	if g.Cache == nil {
+		return nil
+	}
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for _, tag := range tags {
+		if err := g.Cache.Set(responseCacheTagKey(tag), version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeResponseCache removes every cached response
+func (g *Gudu) PurgeResponseCache() error {
+	if g.Cache == nil {
+		return nil
+	}
+	return g.Cache.EmptyByMatch(responseCachePrefix + ":")
+}
+
+// responseCacheTagKey returns the cache key holding the current version of a tag
+func responseCacheTagKey(tag string) string {
+	return responseCachePrefix + "-tag:" + tag
+}
+
+// responseCacheKey builds the cache key from the path, the sorted query, the selected
+// request headers, the session with VarySession and the current version of each tag; purging a tag changes its
+// version and so orphans every key built with the old one
+func (g *Gudu) responseCacheKey(r *http.Request, options ResponseCacheOptions) string {
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+	b.WriteString("?")
+
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		for _, value := range values {
+			b.WriteString(name + "=" + value + "&")
+		}
+	}
+
+	for _, header := range options.VaryHeaders {
+		b.WriteString("\n" + http.CanonicalHeaderKey(header) + ":" + r.Header.Get(header))
+	}
+
+	if options.VarySession {
+		b.WriteString("\nAuthorization:" + r.Header.Get("Authorization"))
+		if g.Sessions != nil {
+			if cookie, err := r.Cookie(g.Sessions.Cookie.Name); err == nil {
+				b.WriteString("\nsession:" + cookie.Value)
+			}
+		}
+	}
+
+	for _, tag := range options.Tags {
+		// a missing or unreadable version counts as the initial version
+		version, _ := g.Cache.Get(responseCacheTagKey(tag))
+		current, _ := version.(string)
+		b.WriteString("\n#" + tag + "@" + current)
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return responseCachePrefix + ":" + hex.EncodeToString(sum[:])
+}
+
+// handlerHeaders returns the headers of after that were added or changed since before
+func handlerHeaders(before, after http.Header) http.Header {
+	headers := make(http.Header)
+	for key, values := range after {
+		if !slices.Equal(before[key], values) {
+			headers[key] = slices.Clone(values)
+		}
+	}
+	return headers
+}
+
+// getCachedResponse loads a cached response, treating any failure as a miss
+func (g *Gudu) getCachedResponse(key string) (*cachedResponse, bool) {
+	value, err := g.Cache.Get(key)
+	if err != nil || value == nil {
+		return nil, false
+	}
+	content, ok := value.([]byte)
+	if !ok {
+		return nil, false
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// writeCachedResponse replays a cached response, answering 304 when the client's copy
+// is still fresh
+func (g *Gudu) writeCachedResponse(w http.ResponseWriter, r *http.Request, entry *cachedResponse, state string) {
+	headers := w.Header()
+	for key, values := range entry.Headers {
+		headers[key] = values
+	}
+	headers.Set("X-Cache", state)
+
+	if isNotModified(r, headers) {
+		writeNotModified(w)
+		return
+	}
+
+	headers.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(entry.Body)
+	}
+}
+
+// cacheResponseWriter passes the response through while keeping a copy of it
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+	tooLarge    bool
+}
+
+func (cw *cacheResponseWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheResponseWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	if !cw.tooLarge {
+		if cw.body.Len()+len(b) > maxCachedResponseSize {
+			cw.tooLarge = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (cw *cacheResponseWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController
+func (cw *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// isCacheable reports whether the recorded response may be stored
+func (cw *cacheResponseWriter) isCacheable() bool {
+	if cw.status != http.StatusOK || cw.tooLarge {
+		return false
+	}
+	headers := cw.Header()
+	if headers.Get("Set-Cookie") != "" || headers.Get("Content-Encoding") != "" {
+		return false
+	}
+	cacheControl := strings.ToLower(headers.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
@@ -0,0 +1,197 @@
+package gudu
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deenikarim/gudu/render"
+)
+
+// memoryCache is a cache.Cache in a map, without expiry
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]interface{}
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]interface{})}
+}
+
+func (m *memoryCache) Exists(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.entries[key]
+	return ok, nil
+}
+
+func (m *memoryCache) Get(key string) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries[key], nil
+}
+
+func (m *memoryCache) Set(key string, value interface{}, _ ...time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+	return nil
+}
+
+func (m *memoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *memoryCache) EmptyByMatch(prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryCache) Empty() error { return m.EmptyByMatch("") }
+
+func (m *memoryCache) Keys(...string) ([]string, error) { return nil, nil }
+
+func (m *memoryCache) Expire(string, time.Duration) error { return nil }
+
+func (m *memoryCache) TTL(string) (time.Duration, error) { return 0, nil }
+
+func (m *memoryCache) Update(key string, value interface{}) error { return m.Set(key, value) }
+
+func (m *memoryCache) Increment(key string, _ ...time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count, _ := m.entries[key].(int64)
+	m.entries[key] = count + 1
+	return count + 1, nil
+}
+
+func (m *memoryCache) SetIfAbsent(key string, value interface{}, _ ...time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[key]; ok {
+		return false, nil
+	}
+	m.entries[key] = value
+	return true, nil
+}
+
+// cachedApp serves body behind SecurityHeaders with a nonce policy and CacheResponse
+func cachedApp(t *testing.T, options ResponseCacheOptions, body func(r *http.Request) string) (*Gudu, http.Handler) {
+	t.Helper()
+	g := testGudu(t)
+	g.Cache = newMemoryCache()
+	security := g.config.security
+	security.ContentSecurityPolicy = "script-src 'nonce-{nonce}'"
+	handler := g.SecurityHeaders(security)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			g.CacheResponse(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte(body(r)))
+			})).ServeHTTP(w, r)
+		}))
+	return g, handler
+}
+
+func cachedGet(handler http.Handler, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/posts", nil)
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCacheResponseKeepsPerRequestHeadersFresh(t *testing.T) {
+	_, handler := cachedApp(t, ResponseCacheOptions{}, func(*http.Request) string { return "posts" })
+
+	first := cachedGet(handler, http.Header{"Origin": {"https://a.example"}})
+	second := cachedGet(handler, http.Header{"Origin": {"https://b.example"}})
+	if first.Header().Get("X-Cache") != "MISS" || second.Header().Get("X-Cache") != "HIT" || second.Body.String() != "posts" {
+		t.Fatalf("X-Cache = %s, %s", first.Header().Get("X-Cache"), second.Header().Get("X-Cache"))
+	}
+	if second.Header().Get("Content-Type") != "text/plain" {
+		t.Error("the headers of the handler are replayed")
+	}
+	if csp := second.Header().Get("Content-Security-Policy"); csp == first.Header().Get("Content-Security-Policy") {
+		t.Errorf("the nonce of the first request is replayed: %s", csp)
+	}
+	if origin := second.Header().Get("Access-Control-Allow-Origin"); origin != "https://b.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the origin of the request", origin)
+	}
+}
+
+func TestCacheResponseSkipsNoncesAndCookies(t *testing.T) {
+	_, handler := cachedApp(t, ResponseCacheOptions{}, func(r *http.Request) string {
+		return "<script nonce=\"" + render.CSPNonceFromContext(r.Context()) + "\"></script>"
+	})
+	cachedGet(handler, nil)
+	if w := cachedGet(handler, nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Error("pages using the nonce of their request are not cached")
+	}
+
+	_, handler = cachedApp(t, ResponseCacheOptions{}, func(*http.Request) string { return "posts" })
+	cachedGet(handler, nil)
+	if w := cachedGet(handler, http.Header{"Cookie": {"session=abc"}}); w.Header().Get("X-Cache") != "" {
+		t.Error("requests with cookies bypass the cache")
+	}
+	if w := cachedGet(handler, http.Header{"Authorization": {"Bearer abc"}}); w.Header().Get("X-Cache") != "" {
+		t.Error("requests with an Authorization header bypass the cache")
+	}
+}
+
+func TestCacheResponseVarySession(t *testing.T) {
+	g, handler := cachedApp(t, ResponseCacheOptions{VarySession: true}, func(r *http.Request) string {
+		cookie, _ := r.Cookie("session")
+		return "posts of " + cookie.Value
+	})
+	name := g.Sessions.Cookie.Name
+	ada := http.Header{"Cookie": {name + "=ada"}}
+	bob := http.Header{"Cookie": {name + "=bob"}}
+
+	cachedGet(handler, ada)
+	if w := cachedGet(handler, ada); w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "posts of ada" {
+		t.Errorf("ada = %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if w := cachedGet(handler, bob); w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "posts of bob" {
+		t.Errorf("bob = %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+}
+
+func TestCacheResponseDoesNotStoreHead(t *testing.T) {
+	_, handler := cachedApp(t, ResponseCacheOptions{}, func(r *http.Request) string {
+		// like http.ServeContent, no body is written for HEAD
+		if r.Method == http.MethodHead {
+			return ""
+		}
+		return "posts"
+	})
+
+	head := httptest.NewRecorder()
+	handler.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/posts", nil))
+	if head.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("HEAD X-Cache = %q", head.Header().Get("X-Cache"))
+	}
+	if w := cachedGet(handler, nil); w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "posts" {
+		t.Errorf("GET after HEAD = %s %q, want a MISS with the body", w.Header().Get("X-Cache"), w.Body.String())
+	}
+
+	head = httptest.NewRecorder()
+	handler.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/posts", nil))
+	if head.Header().Get("X-Cache") != "HIT" || head.Body.Len() != 0 {
+		t.Errorf("HEAD after GET = %s %q, want a HIT without a body", head.Header().Get("X-Cache"), head.Body.String())
+	}
+}
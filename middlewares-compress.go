@@ -0,0 +1,416 @@
+package gudu
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressionOptions holds the settings of the Compress middleware
+type CompressionOptions struct {
+	// Level is the gzip/deflate compression level (1-9), 0 selects gzip.DefaultCompression
+	Level int
+	// MinSize is the minimum response size in bytes worth compressing
+	MinSize int
+	// ContentTypes lists the compressible media types; "text/*" matches a whole family
+	ContentTypes []string
+}
+
+// defaultCompressibleTypes are compressed when CompressionOptions.ContentTypes is empty
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/xml",
+	"application/problem+xml",
+	"application/javascript",
+	"application/x-javascript",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+// compressor holds the compiled compression settings and the encoder pools
+type compressor struct {
+	level       int
+	minSize     int
+	types       map[string]bool
+	families    []string
+	gzipPool    sync.Pool
+	deflatePool sync.Pool
+}
+
+// loadCompressionConfig reads the compression settings from the environment
+func loadCompressionConfig() CompressionOptions {
+	level, err := strconv.Atoi(os.Getenv("COMPRESSION_LEVEL"))
+	if err != nil {
+		level = gzip.DefaultCompression
+	}
+	minSize, err := strconv.Atoi(os.Getenv("COMPRESSION_MIN_SIZE"))
+	if err != nil {
+		minSize = 1024
+	}
+
+	return CompressionOptions{
+		Level:        level,
+		MinSize:      minSize,
+		ContentTypes: splitEnvList("COMPRESSION_TYPES"),
+	}
+}
+
+// Compress returns a middleware compressing responses with gzip or deflate, negotiated from
+// the Accept-Encoding request header. Responses smaller than the minimum size, responses
+// with a content type outside the allowlist and responses that already carry a
+// Content-Encoding (such as precompressed assets) are sent untouched.
+func (g *Gudu) Compress(opts ...CompressionOptions) func(http.Handler) http.Handler {
+	options := g.config.compression
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	c := newCompressor(options)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{
+				ResponseWriter: w,
+				compressor:     c,
+				encoding:       encoding,
+				status:         http.StatusOK,
+			}
+			defer func() {
+				// a panicking handler must not send its buffered response as a success,
+				// Recoverer answers instead
+				if rvr := recover(); rvr != nil {
+					cw.abort()
+					panic(rvr)
+				}
+				cw.close()
+			}()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// newCompressor compiles the compression options
+func newCompressor(options CompressionOptions) *compressor {
+	if options.Level == gzip.NoCompression || options.Level < gzip.HuffmanOnly || options.Level > gzip.BestCompression {
+		options.Level = gzip.DefaultCompression
+	}
+	if len(options.ContentTypes) == 0 {
+		options.ContentTypes = defaultCompressibleTypes
+	}
+
+	c := &compressor{
+		level:   options.Level,
+		minSize: options.MinSize,
+		types:   make(map[string]bool),
+	}
+
+	for _, contentType := range options.ContentTypes {
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if strings.HasSuffix(contentType, "/*") {
+			c.families = append(c.families, strings.TrimSuffix(contentType, "*"))
+			continue
+		}
+		c.types[contentType] = true
+	}
+
+	c.gzipPool.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, c.level)
+		return w
+	}
+	c.deflatePool.New = func() interface{} {
+		w, _ := flate.NewWriter(io.Discard, c.level)
+		return w
+	}
+
+	return c
+}
+
+// isCompressible reports whether the content type is in the allowlist
+func (c *compressor) isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if c.types[mediaType] {
+		return true
+	}
+	for _, family := range c.families {
+		if strings.HasPrefix(mediaType, family) {
+			return true
+		}
+	}
+	return false
+}
+
+// encoder returns a pooled encoder writing to w
+func (c *compressor) encoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "gzip" {
+		gz := c.gzipPool.Get().(*gzip.Writer)
+		gz.Reset(w)
+		return gz
+	}
+	fl := c.deflatePool.Get().(*flate.Writer)
+	fl.Reset(w)
+	return fl
+}
+
+// release returns an encoder to its pool
+func (c *compressor) release(encoder io.WriteCloser) {
+	switch e := encoder.(type) {
+	case *gzip.Writer:
+		c.gzipPool.Put(e)
+	case *flate.Writer:
+		c.deflatePool.Put(e)
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from the Accept-Encoding header, preferring
+// the highest quality value and gzip on a tie; it returns "" when neither is acceptable
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseQuality(part)
+		qualities[strings.ToLower(name)] = q
+	}
+
+	quality := func(encoding string) float64 {
+		if q, ok := qualities[encoding]; ok {
+			return q
+		}
+		if q, ok := qualities["*"]; ok {
+			return q
+		}
+		return 0
+	}
+
+	gzipQ, deflateQ := quality("gzip"), quality("deflate")
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// parseQuality splits a header list element such as "gzip;q=0.8" into its value and
+// quality; a missing quality defaults to 1
+func parseQuality(part string) (string, float64) {
+	value, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found && strings.EqualFold(strings.TrimSpace(key), "q") {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return strings.TrimSpace(value), q
+}
+
+// compressResponseWriter buffers the start of a response until it can decide whether to
+// compress it, then streams through the pooled encoder or straight to the client
+type compressResponseWriter struct {
+	http.ResponseWriter
+	compressor *compressor
+	encoding   string
+	status     int
+	buf        []byte
+	decided    bool
+	encoder    io.WriteCloser
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.decided || status < http.StatusOK {
+		return
+	}
+	cw.status = status
+
+	// bodiless and partial responses are never compressed
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.compressor.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide writes the response headers and the buffered body, compressing them when the
+// response qualifies; sizeReached reports whether the minimum size is met
+func (cw *compressResponseWriter) decide(sizeReached bool) error {
+	cw.decided = true
+	headers := cw.Header()
+
+	if headers.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		headers.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	compressible := cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified &&
+		cw.status != http.StatusPartialContent &&
+		headers.Get("Content-Encoding") == "" &&
+		headers.Get("Content-Range") == "" &&
+		cw.compressor.isCompressible(headers.Get("Content-Type"))
+
+	if compressible {
+		addVary(headers, "Accept-Encoding")
+	}
+
+	if compressible && sizeReached {
+		headers.Set("Content-Encoding", cw.encoding)
+		// the compressed bytes differ from the original, so a strong validator no longer holds
+		if etag := headers.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			headers.Set("ETag", "W/"+etag)
+		}
+		headers.Del("Content-Length")
+		headers.Del("Accept-Ranges")
+		cw.ResponseWriter.WriteHeader(cw.status)
+		cw.encoder = cw.compressor.encoder(cw.encoding, cw.ResponseWriter)
+		_, err := cw.encoder.Write(cw.buf)
+		cw.buf = nil
+		return err
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+// close flushes whatever is still buffered and returns the encoder to its pool
+func (cw *compressResponseWriter) close() {
+	if !cw.decided {
+		_ = cw.decide(len(cw.buf) >= cw.compressor.minSize && len(cw.buf) > 0)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Close()
+		cw.compressor.release(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// abort drops the buffered response without writing the headers; an encoder that
+// already started is not closed, so the truncated stream stays invalid
+func (cw *compressResponseWriter) abort() {
+	if !cw.decided {
+		cw.buf = nil
+		cw.decided = true
+	}
+	cw.encoder = nil
+}
+
+// Flush sends any buffered data to the client, compressing it if the response qualifies
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(len(cw.buf) > 0)
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets websocket and similar handlers take over the connection
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// PrecompressedFileServer serves static files from root and, when the client accepts gzip,
+// serves a precompressed sibling file (e.g. app.css.gz for app.css) if one exists
+func (g *Gudu) PrecompressedFileServer(root string) http.Handler {
+	fileServer := http.FileServer(http.Dir(root))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+
+		if !strings.HasSuffix(name, ".gz") && negotiateEncoding(r.Header.Get("Accept-Encoding")) == "gzip" {
+			if served := servePrecompressed(w, r, root, name); served {
+				return
+			}
+		}
+
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// servePrecompressed serves root/name.gz with a gzip Content-Encoding if it exists
+func servePrecompressed(w http.ResponseWriter, r *http.Request, root, name string) bool {
+	file, err := os.Open(filepath.Join(root, filepath.FromSlash(name)+".gz"))
+	if err != nil {
+		return false
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	headers := w.Header()
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Encoding", "gzip")
+	addVary(headers, "Accept-Encoding")
+
+	http.ServeContent(w, r, name, info.ModTime(), file)
+	return true
+}
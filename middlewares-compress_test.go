@@ -0,0 +1,129 @@
+package gudu
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"", ""},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"deflate;q=1, gzip;q=0.5", "deflate"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"gzip;q=0", ""},
+		{"*", "gzip"},
+		{"*;q=0.5, gzip;q=0", "deflate"},
+		{"br, identity", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// compressed serves the body with the headers through Compress
+func compressed(t *testing.T, acceptEncoding string, status int, headers map[string]string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	g := testGudu(t)
+	handler := g.Compress(CompressionOptions{MinSize: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, value := range headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCompressNegotiatesEncoding(t *testing.T) {
+	body := `{"posts":"` + strings.Repeat("lorem ipsum ", 50) + `"}`
+	json := map[string]string{"Content-Type": "application/json", "Content-Length": "612", "ETag": `"v1"`}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		w := compressed(t, encoding, http.StatusOK, json, body)
+		if w.Header().Get("Content-Encoding") != encoding || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: headers %v", encoding, w.Header())
+		}
+		if w.Header().Get("Content-Length") != "" || w.Header().Get("ETag") != `W/"v1"` {
+			t.Errorf("%s: the length and strong etag of the original are kept: %v", encoding, w.Header())
+		}
+
+		var reader io.Reader
+		if encoding == "gzip" {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = gz
+		} else {
+			reader = flate.NewReader(w.Body)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil || string(decoded) != body {
+			t.Errorf("%s: decoded %d bytes, %v", encoding, len(decoded), err)
+		}
+	}
+}
+
+func TestCompressSkipsResponses(t *testing.T) {
+	large := strings.Repeat("lorem ipsum ", 50)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		status         int
+		headers        map[string]string
+		body           string
+	}{
+		{"no accept-encoding", "", http.StatusOK, map[string]string{"Content-Type": "text/html"}, large},
+		{"unsupported encoding", "br", http.StatusOK, map[string]string{"Content-Type": "text/html"}, large},
+		{"below the minimum size", "gzip", http.StatusOK, map[string]string{"Content-Type": "text/html"}, "small"},
+		{"not in the allowlist", "gzip", http.StatusOK, map[string]string{"Content-Type": "image/png"}, large},
+		{"already compressed", "gzip", http.StatusOK, map[string]string{"Content-Type": "text/css", "Content-Encoding": "br"}, large},
+		{"partial content", "gzip", http.StatusPartialContent, map[string]string{"Content-Type": "text/plain", "Content-Range": "bytes 0-599/1000"}, large},
+	}
+	for _, tt := range tests {
+		w := compressed(t, tt.acceptEncoding, tt.status, tt.headers, tt.body)
+		if encoding := w.Header().Get("Content-Encoding"); encoding != tt.headers["Content-Encoding"] {
+			t.Errorf("%s: Content-Encoding = %q", tt.name, encoding)
+		}
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: the response changed: %d, %d bytes", tt.name, w.Code, w.Body.Len())
+		}
+	}
+}
+
+func TestCompressLeavesPanicsToRecoverer(t *testing.T) {
+	g := testGudu(t)
+	handler := g.Recoverer(g.Compress(CompressionOptions{MinSize: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "partial")
+		panic("boom")
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("panic = %d %q, want the 500 problem alone", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,339 @@
+package gudu
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CORSOptions holds the Cross-Origin Resource Sharing policy applied by the CORS middleware
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests. "*" allows
+	// every origin and a "*." label allows wildcard subdomains, e.g. "https://*.example.com"
+	AllowedOrigins []string
+	// AllowedOriginPatterns lists regular expressions matching the whole request origin,
+	// e.g. `https://[a-z]+\.example\.com`; invalid patterns are logged and allow nothing
+	AllowedOriginPatterns []string
+	// AllowOriginFunc is an optional callback deciding if an origin is allowed
+	AllowOriginFunc  func(r *http.Request, origin string) bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is the number of seconds a preflight response may be cached, 0 leaves it unset
+	MaxAge int
+}
+
+// corsPolicy is the compiled form of CORSOptions
+type corsPolicy struct {
+	options        CORSOptions
+	allowAll       bool
+	exactOrigins   map[string]bool
+	wildcards      [][2]string
+	patterns       []*regexp.Regexp
+	allowedMethods map[string]bool
+	allowedHeaders map[string]bool
+	allowAllHeader bool
+}
+
+// corsGroups holds the policies of route groups by path prefix, see Gudu.CORSFor
+type corsGroups struct {
+	mu       sync.RWMutex
+	prefixes []corsGroup
+}
+
+// corsGroup is the policy of the routes below a path prefix
+type corsGroup struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// defaultCORSMethods are allowed when CORSOptions.AllowedMethods is empty
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// defaultCORSHeaders are allowed when CORSOptions.AllowedHeaders is empty
+var defaultCORSHeaders = []string{"Accept", "Content-Type", "Authorization", "X-Requested-With"}
+
+// loadCORSConfig reads the CORS policy from the environment
+func loadCORSConfig() CORSOptions {
+	maxAge, _ := strconv.Atoi(os.Getenv("CORS_MAX_AGE"))
+	credentials, _ := strconv.ParseBool(os.Getenv("CORS_ALLOW_CREDENTIALS"))
+
+	return CORSOptions{
+		AllowedOrigins:        splitEnvList("CORS_ALLOWED_ORIGINS"),
+		AllowedOriginPatterns: splitEnvList("CORS_ALLOWED_ORIGIN_PATTERNS"),
+		AllowedMethods:        splitEnvList("CORS_ALLOWED_METHODS"),
+		AllowedHeaders:        splitEnvList("CORS_ALLOWED_HEADERS"),
+		ExposedHeaders:        splitEnvList("CORS_EXPOSED_HEADERS"),
+		AllowCredentials:      credentials,
+		MaxAge:                maxAge,
+	}
+}
+
+// CORS returns a middleware applying the given CORS policy, or the policy configured
+// through the CORS_* environment variables when no options are passed. It answers
+// preflight requests itself without running the rest of the chain, with the policy
+// of the route group registered with CORSFor when the path belongs to one.
+func (g *Gudu) CORS(opts ...CORSOptions) func(http.Handler) http.Handler {
+	options := g.config.cors
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	policy, err := newCORSPolicy(options)
+	g.logCORSError(err)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPreflight(r) {
+				g.corsGroupPolicy(r.URL.Path, policy).handlePreflight(w, r)
+				return
+			}
+			policy.handleActual(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORSFor returns a middleware applying the policy to a route group below the path
+// prefix, overriding the router-level policy. The prefix is registered so the
+// router-level middleware answers the preflight requests of the group, which never
+// reach the group middlewares as they are not routed.
+//
+//	mux.Route("/api", func(r chi.Router) {
+//		r.Use(app.CORSFor("/api", gudu.CORSOptions{AllowedOrigins: []string{"*"}}))
+//	})
+func (g *Gudu) CORSFor(prefix string, options CORSOptions) func(http.Handler) http.Handler {
+	policy, err := newCORSPolicy(options)
+	g.logCORSError(err)
+	prefix = "/" + strings.Trim(prefix, "/")
+
+	g.corsGroups.mu.Lock()
+	g.corsGroups.prefixes = append(g.corsGroups.prefixes, corsGroup{prefix: prefix, policy: policy})
+	// the longest prefix is the most specific group
+	sort.SliceStable(g.corsGroups.prefixes, func(i, j int) bool {
+		return len(g.corsGroups.prefixes[i].prefix) > len(g.corsGroups.prefixes[j].prefix)
+	})
+	g.corsGroups.mu.Unlock()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPreflight(r) {
+				policy.handlePreflight(w, r)
+				return
+			}
+			policy.handleActual(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsGroupPolicy returns the policy of the most specific group the path belongs to,
+// or fallback
+func (g *Gudu) corsGroupPolicy(path string, fallback *corsPolicy) *corsPolicy {
+	g.corsGroups.mu.RLock()
+	defer g.corsGroups.mu.RUnlock()
+	for _, group := range g.corsGroups.prefixes {
+		if group.prefix == "/" || path == group.prefix || strings.HasPrefix(path, group.prefix+"/") {
+			return group.policy
+		}
+	}
+	return fallback
+}
+
+// newCORSPolicy compiles the options into a policy; invalid origin patterns are left
+// out of it and reported in the error
+func newCORSPolicy(options CORSOptions) (*corsPolicy, error) {
+	p := &corsPolicy{
+		options:        options,
+		exactOrigins:   make(map[string]bool),
+		allowedMethods: make(map[string]bool),
+		allowedHeaders: make(map[string]bool),
+	}
+
+	for _, origin := range options.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			p.allowAll = true
+		case strings.Contains(origin, "*"):
+			parts := strings.SplitN(origin, "*", 2)
+			p.wildcards = append(p.wildcards, [2]string{parts[0], parts[1]})
+		default:
+			p.exactOrigins[origin] = true
+		}
+	}
+
+	var errs []error
+	for _, pattern := range options.AllowedOriginPatterns {
+		// anchored, so "https://.*\.example\.com" does not allow "https://a.example.com.evil.net"
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cors: origin pattern %q: %w", pattern, err))
+			continue
+		}
+		p.patterns = append(p.patterns, re)
+	}
+
+	if len(options.AllowedMethods) == 0 {
+		p.options.AllowedMethods = defaultCORSMethods
+	}
+	for _, method := range p.options.AllowedMethods {
+		p.allowedMethods[strings.ToUpper(method)] = true
+	}
+
+	if len(options.AllowedHeaders) == 0 {
+		p.options.AllowedHeaders = defaultCORSHeaders
+	}
+	for _, header := range p.options.AllowedHeaders {
+		if header == "*" {
+			p.allowAllHeader = true
+		}
+		p.allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return p, errors.Join(errs...)
+}
+
+// logCORSError logs the invalid settings of a CORS policy
+func (g *Gudu) logCORSError(err error) {
+	if err != nil && g.ErrorLog != nil {
+		g.ErrorLog.Println(err)
+	}
+}
+
+// isPreflight reports whether the request is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// isOriginAllowed checks the origin against the configured origins, patterns and callback
+func (p *corsPolicy) isOriginAllowed(r *http.Request, origin string) bool {
+	if p.allowAll {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if p.exactOrigins[lower] {
+		return true
+	}
+
+	for _, w := range p.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	if p.options.AllowOriginFunc != nil {
+		return p.options.AllowOriginFunc(r, origin)
+	}
+
+	return false
+}
+
+// areHeadersAllowed checks the headers requested by a preflight request
+func (p *corsPolicy) areHeadersAllowed(requested string) bool {
+	if p.allowAllHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !p.allowedHeaders[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// allowOriginValue returns the Access-Control-Allow-Origin value for an allowed origin;
+// credentials cannot be combined with the "*" wildcard
+func (p *corsPolicy) allowOriginValue(origin string) string {
+	if p.allowAll && !p.options.AllowCredentials {
+		return "*"
+	}
+	return origin
+}
+
+// handleActual sets the CORS headers on a simple or actual cross-origin request
+func (p *corsPolicy) handleActual(w http.ResponseWriter, r *http.Request) {
+	headers := w.Header()
+	origin := r.Header.Get("Origin")
+
+	// clear any headers set by a less specific policy earlier in the chain
+	for _, key := range []string{
+		"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Expose-Headers",
+	} {
+		headers.Del(key)
+	}
+	addVary(headers, "Origin")
+
+	if origin == "" || !p.isOriginAllowed(r, origin) {
+		return
+	}
+
+	headers.Set("Access-Control-Allow-Origin", p.allowOriginValue(origin))
+	if p.options.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.options.ExposedHeaders) > 0 {
+		headers.Set("Access-Control-Expose-Headers", strings.Join(p.options.ExposedHeaders, ", "))
+	}
+}
+
+// handlePreflight answers a preflight request
+func (p *corsPolicy) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	headers := w.Header()
+	origin := r.Header.Get("Origin")
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+
+	addVary(headers, "Origin")
+	addVary(headers, "Access-Control-Request-Method")
+	addVary(headers, "Access-Control-Request-Headers")
+
+	if !p.isOriginAllowed(r, origin) || !p.allowedMethods[method] || !p.areHeadersAllowed(requestedHeaders) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	headers.Set("Access-Control-Allow-Origin", p.allowOriginValue(origin))
+	headers.Set("Access-Control-Allow-Methods", method)
+	if requestedHeaders != "" {
+		headers.Set("Access-Control-Allow-Headers", requestedHeaders)
+	}
+	if p.options.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if p.options.MaxAge > 0 {
+		headers.Set("Access-Control-Max-Age", strconv.Itoa(p.options.MaxAge))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addVary adds a value to the Vary header unless it is already present
+func addVary(headers http.Header, value string) {
+	for _, existing := range headers.Values("Vary") {
+		for _, v := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return
+			}
+		}
+	}
+	headers.Add("Vary", value)
+}
@@ -0,0 +1,88 @@
+package gudu
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func preflight(handler http.Handler, path, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCORSAnswersPreflightsWithoutTheChain(t *testing.T) {
+	g := testGudu(t)
+	mux := chi.NewRouter()
+	mux.Use(g.CORS(CORSOptions{AllowedOrigins: []string{"https://app.example"}}))
+	calls := 0
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			next.ServeHTTP(w, r)
+		})
+	})
+	mux.Post("/posts", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Route("/api", func(r chi.Router) {
+		r.Use(g.CORSFor("/api", CORSOptions{AllowedOrigins: []string{"*"}}))
+		r.Post("/posts", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	w := preflight(mux, "/posts", "https://app.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Errorf("preflight = %d %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w := preflight(mux, "/api/posts", "https://other.example"); w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("group preflight = %q, want the group policy", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w := preflight(mux, "/apiary", "https://other.example"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("paths sharing the characters of a group prefix use the router policy")
+	}
+	if calls != 0 {
+		t.Errorf("the chain ran %d times for preflight requests", calls)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/posts", nil)
+	r.Header.Set("Origin", "https://other.example")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || calls != 1 {
+		t.Errorf("actual request = %q after %d calls", w.Header().Get("Access-Control-Allow-Origin"), calls)
+	}
+}
+
+func TestCORSOriginPatternsMatchTheWholeOrigin(t *testing.T) {
+	g := testGudu(t)
+	var logged bytes.Buffer
+	g.ErrorLog = log.New(&logged, "", 0)
+	handler := g.CORS(CORSOptions{
+		AllowedOriginPatterns: []string{`https://[a-z]+\.example\.com`, `https://(unclosed`},
+		AllowCredentials:      true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := map[string]bool{
+		"https://app.example.com":                 true,
+		"https://app.example.com.attacker.net":    false,
+		"https://evil.net/?https://a.example.com": false,
+		"http://app.example.com":                  false,
+		"https://(unclosed":                       false,
+	}
+	for origin, allowed := range tests {
+		got := preflight(handler, "/posts", origin).Header().Get("Access-Control-Allow-Origin")
+		if (got == origin) != allowed {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, allowed %v", origin, got, allowed)
+		}
+	}
+	if !strings.Contains(logged.String(), "unclosed") {
+		t.Errorf("the invalid pattern was not logged: %q", logged.String())
+	}
+}
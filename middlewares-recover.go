@@ -0,0 +1,37 @@
+package gudu
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recoverer recovers from panics in later handlers and reports them through
+// HandleError: the development error page in debug mode, the 500 error page or a
+// problem+json response otherwise. The panic and its stack trace are logged.
+func (g *Gudu) Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// keep aborting the response as net/http expects
+			if err, ok := rvr.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rvr)
+			}
+
+			perr := &panicError{value: rvr, stack: callers(3)}
+			if g.ErrorLog != nil {
+				g.ErrorLog.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.RequestURI(), rvr, debug.Stack())
+			}
+			// upgraded connections can not receive an error response
+			if r.Header.Get("Connection") == "Upgrade" {
+				return
+			}
+			g.handleError(w, r, perr, perr.stack)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
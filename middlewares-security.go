@@ -0,0 +1,189 @@
+package gudu
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deenikarim/gudu/render"
+)
+
+// cspNoncePlaceholder is replaced with the per-request nonce in the Content-Security-Policy
+const cspNoncePlaceholder = "{nonce}"
+
+// SecurityHeadersOptions holds the security headers set by the SecurityHeaders middleware;
+// empty values leave the corresponding header unset
+type SecurityHeadersOptions struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds, sent only over https
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	ContentTypeNosniff    bool
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	// ContentSecurityPolicy may contain the {nonce} placeholder, e.g. "script-src 'nonce-{nonce}'"
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only
+	CSPReportOnly bool
+	// CSPReportPath is the built-in endpoint receiving violation reports, empty disables it
+	CSPReportPath string
+}
+
+// loadSecurityHeadersConfig reads the security headers configuration from the environment
+func loadSecurityHeadersConfig() SecurityHeadersOptions {
+	hstsMaxAge, err := strconv.Atoi(os.Getenv("HSTS_MAX_AGE"))
+	if err != nil {
+		hstsMaxAge = 31536000
+	}
+	includeSubdomains, _ := strconv.ParseBool(os.Getenv("HSTS_INCLUDE_SUBDOMAINS"))
+	preload, _ := strconv.ParseBool(os.Getenv("HSTS_PRELOAD"))
+	reportOnly, _ := strconv.ParseBool(os.Getenv("CSP_REPORT_ONLY"))
+
+	return SecurityHeadersOptions{
+		HSTSMaxAge:            hstsMaxAge,
+		HSTSIncludeSubdomains: includeSubdomains,
+		HSTSPreload:           preload,
+		ContentTypeNosniff:    true,
+		FrameOptions:          getEnvOrDefault("FRAME_OPTIONS", "SAMEORIGIN"),
+		ReferrerPolicy:        getEnvOrDefault("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+		PermissionsPolicy:     os.Getenv("PERMISSIONS_POLICY"),
+		ContentSecurityPolicy: os.Getenv("CSP"),
+		CSPReportOnly:         reportOnly,
+		CSPReportPath:         os.Getenv("CSP_REPORT_PATH"),
+	}
+}
+
+// SecurityHeaders returns a middleware setting HSTS, X-Content-Type-Options, X-Frame-Options,
+// Referrer-Policy, Permissions-Policy and Content-Security-Policy on every response. A fresh
+// CSP nonce is generated for each request and made available to templates through
+// TemplateData.CSPNonce and the cspNonce template function.
+func (g *Gudu) SecurityHeaders(opts ...SecurityHeadersOptions) func(http.Handler) http.Handler {
+	options := g.config.security
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	// point the browser at the built-in collection endpoint
+	policy := options.ContentSecurityPolicy
+	if policy != "" && options.CSPReportPath != "" && !strings.Contains(policy, "report-uri") {
+		policy = strings.TrimRight(strings.TrimSpace(policy), ";") + "; report-uri " + options.CSPReportPath
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if options.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	hsts := ""
+	if options.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(options.HSTSMaxAge)
+		if options.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if options.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers := w.Header()
+
+			if hsts != "" && (g.config.secure || isSecureRequest(r)) {
+				headers.Set("Strict-Transport-Security", hsts)
+			}
+			if options.ContentTypeNosniff {
+				headers.Set("X-Content-Type-Options", "nosniff")
+			}
+			if options.FrameOptions != "" {
+				headers.Set("X-Frame-Options", options.FrameOptions)
+			}
+			if options.ReferrerPolicy != "" {
+				headers.Set("Referrer-Policy", options.ReferrerPolicy)
+			}
+			if options.PermissionsPolicy != "" {
+				headers.Set("Permissions-Policy", options.PermissionsPolicy)
+			}
+
+			nonce, err := generateNonce()
+			if err != nil {
+				g.ErrorLog.Println("failed to generate csp nonce:", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if policy != "" {
+				headers.Set(cspHeader, strings.ReplaceAll(policy, cspNoncePlaceholder, nonce))
+			}
+
+			next.ServeHTTP(w, r.WithContext(render.WithCSPNonce(r.Context(), nonce)))
+		})
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce generated for the request
+func (g *Gudu) CSPNonce(r *http.Request) string {
+	return render.CSPNonceFromContext(r.Context())
+}
+
+// CSPReportHandler collects Content-Security-Policy violation reports, sent either in the
+// legacy application/csp-report format or by the Reporting API, and logs them
+func (g *Gudu) CSPReportHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var reports []map[string]interface{}
+
+	// legacy format: {"csp-report": {...}}
+	var legacy struct {
+		Report map[string]interface{} `json:"csp-report"`
+	}
+	// reporting api format: [{"type": "csp-violation", "body": {...}}]
+	var batch []struct {
+		Type string                 `json:"type"`
+		Body map[string]interface{} `json:"body"`
+	}
+
+	switch {
+	case json.Unmarshal(body, &legacy) == nil && legacy.Report != nil:
+		reports = append(reports, legacy.Report)
+	case json.Unmarshal(body, &batch) == nil:
+		for _, item := range batch {
+			if item.Body != nil {
+				reports = append(reports, item.Body)
+			}
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	for _, report := range reports {
+		content, _ := json.Marshal(report)
+		g.ErrorLog.Printf("csp violation from %s: %s", r.RemoteAddr, content)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isSecureRequest reports whether the request arrived over https, directly or through a proxy
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// generateNonce returns a random base64 encoded nonce
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
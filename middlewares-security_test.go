@@ -0,0 +1,142 @@
+package gudu
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// secured serves a request through SecurityHeaders, returning the response and the
+// nonce seen by the handler
+func secured(g *Gudu, r *http.Request, opts ...SecurityHeadersOptions) (*httptest.ResponseRecorder, string) {
+	var nonce string
+	handler := g.SecurityHeaders(opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = g.CSPNonce(r)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, nonce
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	g := testGudu(t)
+	options := SecurityHeadersOptions{
+		HSTSMaxAge:            600,
+		ContentTypeNosniff:    true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		PermissionsPolicy:     "camera=()",
+		ContentSecurityPolicy: "default-src 'self'; script-src 'nonce-{nonce}';",
+		CSPReportPath:         "/csp-report",
+	}
+
+	w, nonce := secured(g, httptest.NewRequest(http.MethodGet, "/", nil), options)
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Permissions-Policy":      "camera=()",
+		"Content-Security-Policy": "default-src 'self'; script-src 'nonce-" + nonce + "'; report-uri /csp-report",
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+
+	options.CSPReportOnly = true
+	options.ContentSecurityPolicy = "default-src 'self'; report-uri /violations"
+	w, _ = secured(g, httptest.NewRequest(http.MethodGet, "/", nil), options)
+	if w.Header().Get("Content-Security-Policy") != "" ||
+		w.Header().Get("Content-Security-Policy-Report-Only") != "default-src 'self'; report-uri /violations" {
+		t.Errorf("report only headers %v", w.Header())
+	}
+
+	// empty options leave the headers unset
+	w, nonce = secured(g, httptest.NewRequest(http.MethodGet, "/", nil), SecurityHeadersOptions{HSTSMaxAge: 600})
+	if len(w.Header()) != 0 || nonce == "" {
+		t.Errorf("headers %v, nonce %q", w.Header(), nonce)
+	}
+}
+
+func TestSecurityHeadersNoncePerRequest(t *testing.T) {
+	g := testGudu(t)
+	options := SecurityHeadersOptions{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		w, nonce := secured(g, httptest.NewRequest(http.MethodGet, "/", nil), options)
+		if len(nonce) != 24 || seen[nonce] {
+			t.Fatalf("nonce %q was generated again or is not 16 random bytes", nonce)
+		}
+		seen[nonce] = true
+		if w.Header().Get("Content-Security-Policy") != "script-src 'nonce-"+nonce+"'" {
+			t.Errorf("policy %q, want the nonce of the request", w.Header().Get("Content-Security-Policy"))
+		}
+	}
+}
+
+func TestSecurityHeadersNonceInTemplates(t *testing.T) {
+	g := testGudu(t)
+	withErrorPages(t, g, nil)
+	page := `<script nonce="{{ cspNonce() }}"></script><style nonce="{{ .CSPNonce }}"></style>`
+	if err := os.WriteFile(filepath.Join(g.RootPath, "views", "home.jet"), []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := g.Sessions.LoadAndSave(g.SecurityHeaders(SecurityHeadersOptions{
+		ContentSecurityPolicy: "script-src 'nonce-{nonce}'",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := g.Render.RenderPage(w, r, "home", nil, nil); err != nil {
+			t.Error(err)
+		}
+	})))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		nonce := strings.TrimSuffix(strings.TrimPrefix(w.Header().Get("Content-Security-Policy"), "script-src 'nonce-"), "'")
+		if want := `<script nonce="` + nonce + `"></script><style nonce="` + nonce + `"></style>`; nonce == "" || w.Body.String() != want {
+			t.Errorf("page %q, want the nonce %q of the policy", w.Body.String(), nonce)
+		}
+	}
+}
+
+func TestSecurityHeadersHSTSOnlyOverHTTPS(t *testing.T) {
+	g := testGudu(t)
+	options := SecurityHeadersOptions{HSTSMaxAge: 600, HSTSIncludeSubdomains: true, HSTSPreload: true}
+
+	plain := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	direct := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	direct.TLS = &tls.ConnectionState{}
+	proxied := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	proxied.Header.Set("X-Forwarded-Proto", "HTTPS")
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		secure bool
+		want   string
+	}{
+		{"http", plain, false, ""},
+		{"https", direct, false, "max-age=600; includeSubDomains; preload"},
+		{"forwarded https", proxied, false, "max-age=600; includeSubDomains; preload"},
+		{"SECURE=true", plain, true, "max-age=600; includeSubDomains; preload"},
+	}
+	for _, tt := range tests {
+		g.config.secure = tt.secure
+		w, _ := secured(g, tt.r, options)
+		if got := w.Header().Get("Strict-Transport-Security"); got != tt.want {
+			t.Errorf("%s: Strict-Transport-Security = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	g.config.secure = false
+	if w, _ := secured(g, direct, SecurityHeadersOptions{}); w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("a max-age of 0 disables HSTS")
+	}
+}
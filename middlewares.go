@@ -1,8 +1,13 @@
 package gudu
 
-import "net/http"
+import (
+	"net/http"
 
-// SessionLoadAndSave load and save session data for requests
+	"github.com/deenikarim/gudu/auth"
+)
+
+// SessionLoadAndSave load and save session data for requests, and lets AuthUser load
+// the user of the session once per request
 func (g *Gudu) SessionLoadAndSave(next http.Handler) http.Handler {
-	return g.Sessions.LoadAndSave(next)
+	return g.Sessions.LoadAndSave(auth.CacheUser(next))
 }
@@ -0,0 +1,133 @@
+package gudu
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deenikarim/gudu/auth"
+	"github.com/deenikarim/gudu/oauth"
+	"github.com/go-chi/chi/v5"
+)
+
+// loadOAuthProviders reads the providers listed in OAUTH_PROVIDERS, each configured by
+// OAUTH_{NAME}_CLIENT_ID, _CLIENT_SECRET, _ISSUER, _AUTH_URL, _TOKEN_URL,
+// _USERINFO_URL, _JWKS_URL, _SCOPES, _REDIRECT_URL and _BASIC_AUTH. Providers with an
+// issuer use OpenID Connect and ask for the openid, email and profile scopes by
+// default; the callback is /auth/{name}/callback unless another URL is set.
+func loadOAuthProviders() []*oauth.Provider {
+	var providers []*oauth.Provider
+	for _, name := range splitEnvList("OAUTH_PROVIDERS") {
+		prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := &oauth.Provider{
+			Name:         name,
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getEnvOrDefault(prefix+"REDIRECT_URL", "/auth/"+name+"/callback"),
+			Scopes:       splitEnvList(prefix + "SCOPES"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			AuthURL:      os.Getenv(prefix + "AUTH_URL"),
+			TokenURL:     os.Getenv(prefix + "TOKEN_URL"),
+			UserInfoURL:  os.Getenv(prefix + "USERINFO_URL"),
+			JWKSURL:      os.Getenv(prefix + "JWKS_URL"),
+		}
+		provider.BasicAuth, _ = strconv.ParseBool(os.Getenv(prefix + "BASIC_AUTH"))
+		if len(provider.Scopes) == 0 && provider.Issuer != "" {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// createOAuth creates g.OAuth with the providers of OAUTH_PROVIDERS, relative
+// callback URLs resolved against SERVER_NAME. Set g.OAuth.MapUser to sign users in.
+func (g *Gudu) createOAuth() error {
+	g.OAuth = oauth.New(g.Sessions)
+	for _, provider := range g.config.oauth {
+		provider.RedirectURL = g.absoluteURL(provider.RedirectURL)
+		if err := g.OAuth.Register(provider); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OAuthRedirect handles the "Sign in with" links, register it with Gudu.Handle on a
+// route with a provider parameter:
+//
+//	mux.Get("/auth/{provider}", app.Handle(app.OAuthRedirect))
+//	mux.Get("/auth/{provider}/callback", app.Handle(app.OAuthCallback))
+func (g *Gudu) OAuthRedirect(w http.ResponseWriter, r *http.Request) error {
+	err := g.OAuth.Redirect(w, r, chi.URLParam(r, "provider"))
+	if errors.Is(err, oauth.ErrUnknownProvider) {
+		return NewProblem(http.StatusNotFound, "")
+	}
+	return err
+}
+
+// OAuthCallback completes a sign-in: the identity of the provider is mapped onto a user
+// by g.OAuth.MapUser, who is logged in and sent to the intended page, or to
+// AUTH_TWO_FACTOR_PATH when the user enabled two-factor authentication. Cancelled and
+// rejected sign-ins are sent back to AUTH_LOGIN_PATH with a message in the "error"
+// session key, APIs get a 401 problem.
+func (g *Gudu) OAuthCallback(w http.ResponseWriter, r *http.Request) error {
+	if g.OAuth.MapUser == nil {
+		return errors.New("oauth sign-in needs g.OAuth.MapUser")
+	}
+	identity, err := g.OAuth.Callback(r, chi.URLParam(r, "provider"))
+	if errors.Is(err, oauth.ErrUnknownProvider) {
+		return NewProblem(http.StatusNotFound, "")
+	}
+	if err != nil {
+		if g.ErrorLog != nil {
+			g.ErrorLog.Println("oauth:", err)
+		}
+		return g.loginFailed(w, r, oauthMessage(err))
+	}
+
+	user, err := g.OAuth.MapUser(r.Context(), identity)
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		return g.loginFailed(w, r, "No account is linked to this sign-in.")
+	case errors.Is(err, auth.ErrInactive):
+		return g.loginFailed(w, r, auth.LoginMessage(err))
+	case err != nil:
+		return err
+	}
+	if active, ok := user.(auth.ActiveUser); ok && !active.AuthActive() {
+		return g.loginFailed(w, r, auth.LoginMessage(auth.ErrInactive))
+	}
+
+	err = g.Auth.LoginOrChallenge(w, r, user, false)
+	if errors.Is(err, auth.ErrTwoFactorRequired) {
+		http.Redirect(w, r, g.Auth.Config().TwoFactorPath, http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return g.authFormStatus(w, r, http.StatusOK, "You are signed in.", g.Auth.Intended(r))
+}
+
+// loginFailed answers a sign-in that did not complete: browsers are sent to
+// AUTH_LOGIN_PATH with the message in the "error" session key, APIs get a 401 problem
+func (g *Gudu) loginFailed(w http.ResponseWriter, r *http.Request, message string) error {
+	if g.ResponseFor(w, r).problemMediaType() != "text/html" {
+		return NewProblem(http.StatusUnauthorized, message)
+	}
+	g.Sessions.Put(r.Context(), "error", message)
+	http.Redirect(w, r, g.Auth.Config().LoginPath, http.StatusSeeOther)
+	return nil
+}
+
+// oauthMessage describes a failed sign-in for users
+func oauthMessage(err error) string {
+	var providerErr *oauth.ProviderError
+	if errors.As(err, &providerErr) && providerErr.Code == "access_denied" {
+		return "The sign-in was cancelled."
+	}
+	return "The sign-in could not be completed, please try again."
+}
@@ -0,0 +1,429 @@
+// Package oauth signs users in with OAuth 2.0 and OpenID Connect identity providers.
+// The authorization code flow is protected by a state and a PKCE verifier kept in the
+// session; for OpenID Connect providers the endpoints come from discovery and the ID
+// token is verified with the keys of their JWKS. The identity of the provider is then
+// mapped onto a user of the application by MapUser.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/deenikarim/gudu/auth"
+	"github.com/deenikarim/gudu/jwt"
+)
+
+var (
+	// ErrUnknownProvider is returned for provider names that are not registered
+	ErrUnknownProvider = errors.New("oauth: unknown provider")
+	// ErrInvalidState is returned when the callback does not belong to a sign-in
+	// started in this session, e.g. a forged or replayed callback
+	ErrInvalidState = errors.New("oauth: invalid state")
+	// ErrInvalidIDToken is returned when the ID token is not signed by the provider,
+	// is expired, or was issued for another client or sign-in
+	ErrInvalidIDToken = errors.New("oauth: invalid ID token")
+)
+
+// ProviderError is an error answered by the provider, on the callback or by the token
+// endpoint; Code is e.g. "access_denied" when the user cancelled the sign-in
+type ProviderError struct {
+	Code        string
+	Description string
+}
+
+func (e *ProviderError) Error() string {
+	if e.Description != "" {
+		return "oauth: " + e.Code + ": " + e.Description
+	}
+	return "oauth: " + e.Code
+}
+
+// Provider configures an identity provider. OpenID Connect providers only need the
+// Issuer, the client and the scopes; the endpoints left empty are discovered from
+// <Issuer>/.well-known/openid-configuration. Plain OAuth 2.0 providers need AuthURL,
+// TokenURL and UserInfoURL.
+type Provider struct {
+	// Name is the provider name of the routes, e.g. "google"
+	Name         string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the callback route
+	RedirectURL string
+	Scopes      []string
+	// Issuer enables OpenID Connect: discovery and ID token verification
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+	// BasicAuth sends the client credentials to the token endpoint with HTTP basic
+	// authentication instead of the form body
+	BasicAuth bool
+	// AuthParams are added to the authorization URL, e.g. prompt=select_account
+	AuthParams url.Values
+
+	mu         sync.Mutex
+	discovered bool
+	keys       []jwt.Key
+	keysAt     time.Time
+}
+
+// openID reports whether the provider is an OpenID Connect provider
+func (p *Provider) openID() bool {
+	return p.Issuer != ""
+}
+
+// Token is the answer of the token endpoint
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// Expiry is the time the access token expires, zero when unknown
+	Expiry time.Time `json:"-"`
+}
+
+// Identity is the user as known by the provider
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+	// Claims holds the claims of the ID token and the userinfo endpoint
+	Claims map[string]interface{}
+	Token  *Token
+}
+
+// UserMapper finds, links or creates the application user of an identity. Return
+// auth.ErrUserNotFound to refuse identities without an account.
+type UserMapper func(ctx context.Context, identity *Identity) (auth.User, error)
+
+// Client runs the sign-ins of the registered providers
+type Client struct {
+	Sessions *scs.SessionManager
+	// HTTPClient calls the provider endpoints, with a 10 second timeout by default
+	HTTPClient *http.Client
+	// MapUser maps identities onto users of the application
+	MapUser UserMapper
+
+	mu        sync.RWMutex
+	providers map[string]*Provider
+}
+
+// New creates a Client keeping the sign-in state in the session manager
+func New(sessions *scs.SessionManager) *Client {
+	return &Client{
+		Sessions:   sessions,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		providers:  make(map[string]*Provider),
+	}
+}
+
+// Register adds a provider, replacing one of the same name
+func (c *Client) Register(provider *Provider) error {
+	if provider.Name == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+		return errors.New("oauth: a provider needs a name, a client id and a redirect url")
+	}
+	if !provider.openID() && (provider.AuthURL == "" || provider.TokenURL == "") {
+		return fmt.Errorf("oauth: provider %s needs an issuer or the auth and token urls", provider.Name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers[provider.Name] = provider
+	return nil
+}
+
+// Provider returns the registered provider of the name
+func (c *Client) Provider(name string) (*Provider, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	provider, ok := c.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Providers returns the names of the registered providers, sorted
+func (c *Client) Providers() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.providers))
+	for name := range c.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// flow is the state of a sign-in kept in the session until the callback
+type flow struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+// sessionKey is the session key of the sign-in state of a provider
+func sessionKey(provider string) string {
+	return "oauth." + provider
+}
+
+// AuthURL starts a sign-in: the state, PKCE verifier and nonce are stored in the
+// session and the authorization URL of the provider is returned
+func (c *Client) AuthURL(ctx context.Context, name string) (string, error) {
+	provider, err := c.Provider(name)
+	if err != nil {
+		return "", err
+	}
+	if err := c.discover(ctx, provider); err != nil {
+		return "", err
+	}
+
+	var f flow
+	for _, value := range []*string{&f.State, &f.Verifier, &f.Nonce} {
+		if *value, err = randomString(); err != nil {
+			return "", err
+		}
+	}
+	if !provider.openID() {
+		f.Nonce = ""
+	}
+	state, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	c.Sessions.Put(ctx, sessionKey(name), string(state))
+
+	u, err := url.Parse(provider.AuthURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, values := range provider.AuthParams {
+		query[key] = values
+	}
+	challenge := sha256.Sum256([]byte(f.Verifier))
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("state", f.State)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	if len(provider.Scopes) > 0 {
+		query.Set("scope", strings.Join(provider.Scopes, " "))
+	}
+	if f.Nonce != "" {
+		query.Set("nonce", f.Nonce)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Redirect starts a sign-in and redirects the browser to the provider
+func (c *Client) Redirect(w http.ResponseWriter, r *http.Request, name string) error {
+	target, err := c.AuthURL(r.Context(), name)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+	return nil
+}
+
+// Callback completes the sign-in of the callback request: the state is checked and
+// used up, the code is exchanged for tokens, the ID token is verified and the
+// identity is read from its claims and the userinfo endpoint
+func (c *Client) Callback(r *http.Request, name string) (*Identity, error) {
+	provider, err := c.Provider(name)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context()
+	stored := c.Sessions.PopString(ctx, sessionKey(name))
+
+	query := r.URL.Query()
+	var f flow
+	if stored == "" || json.Unmarshal([]byte(stored), &f) != nil || f.State == "" ||
+		subtle.ConstantTimeCompare([]byte(f.State), []byte(query.Get("state"))) != 1 {
+		return nil, ErrInvalidState
+	}
+	if code := query.Get("error"); code != "" {
+		return nil, &ProviderError{Code: code, Description: query.Get("error_description")}
+	}
+	if query.Get("code") == "" {
+		return nil, &ProviderError{Code: "invalid_request", Description: "the callback has no code"}
+	}
+	if err := c.discover(ctx, provider); err != nil {
+		return nil, err
+	}
+
+	token, err := c.exchange(ctx, provider, query.Get("code"), f.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{Provider: name, Claims: make(map[string]interface{}), Token: token}
+	if provider.openID() {
+		claims, err := c.verifyIDToken(ctx, provider, token.IDToken, f.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		for claim, value := range claims.Extra {
+			identity.Claims[claim] = value
+		}
+		identity.Claims["sub"] = claims.Subject
+	}
+	if provider.UserInfoURL != "" {
+		if err := c.userInfo(ctx, provider, token, identity.Claims); err != nil {
+			return nil, err
+		}
+	}
+	identity.fill()
+	if identity.Subject == "" {
+		return nil, errors.New("oauth: the provider did not identify the user")
+	}
+	return identity, nil
+}
+
+// exchange trades the authorization code for tokens
+func (c *Client) exchange(ctx context.Context, provider *Provider, code, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if !provider.BasicAuth {
+		form.Set("client_id", provider.ClientID)
+		form.Set("client_secret", provider.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if provider.BasicAuth {
+		req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	var token Token
+	if err := c.doJSON(req, &token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("oauth: the token response has no access token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return &token, nil
+}
+
+// userInfo merges the claims of the userinfo endpoint into claims; a subject
+// differing from the one of the ID token is rejected
+func (c *Client) userInfo(ctx context.Context, provider *Provider, token *Token, claims map[string]interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.UserInfoURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var info map[string]interface{}
+	if err := c.doJSON(req, &info); err != nil {
+		return err
+	}
+	if subject, ok := claims["sub"]; ok && info["sub"] != nil && info["sub"] != subject {
+		return ErrInvalidIDToken
+	}
+	for claim, value := range info {
+		claims[claim] = value
+	}
+	return nil
+}
+
+// doJSON sends a request and decodes the JSON answer, provider errors become a
+// ProviderError
+func (c *Client) doJSON(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var answer struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &answer) == nil && answer.Error != "" {
+			return &ProviderError{Code: answer.Error, Description: answer.Description}
+		}
+		return fmt.Errorf("oauth: %s answered %s", req.URL.Host, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("oauth: invalid answer of %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// fill sets the identity fields from the standard claims, falling back to the
+// fields of common OAuth 2.0 providers such as GitHub
+func (i *Identity) fill() {
+	i.Subject = claimString(i.Claims, "sub", "id")
+	i.Email = claimString(i.Claims, "email")
+	i.Name = claimString(i.Claims, "name", "login", "preferred_username")
+	i.AvatarURL = claimString(i.Claims, "picture", "avatar_url")
+	switch verified := i.Claims["email_verified"].(type) {
+	case bool:
+		i.EmailVerified = verified
+	case string:
+		i.EmailVerified, _ = strconv.ParseBool(verified)
+	}
+}
+
+// claimString returns the first of the claims that is set, numbers formatted as
+// integers
+func claimString(claims map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		switch value := claims[name].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// randomString returns 32 random bytes, base64url encoded
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,214 @@
+package oauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/deenikarim/gudu/jwt"
+)
+
+// fakeProvider is an OpenID Connect provider issuing codes for one user
+type fakeProvider struct {
+	*httptest.Server
+	signer    *jwt.Manager
+	keys      jwt.JWKS
+	challenge string
+	nonce     string
+	audience  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jwt.New(jwt.Options{}, jwt.NewMemoryStore(), jwt.NewEd25519Key(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{signer: signer, keys: signer.JWKS(), audience: "client"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"userinfo_endpoint":      p.URL + "/userinfo",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(p.keys)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || r.FormValue("client_secret") != "secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, _ := p.signer.Sign(jwt.Claims{
+			Issuer:    p.URL,
+			Subject:   "user-1",
+			Audience:  jwt.Audience{p.audience},
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			Extra:     map[string]interface{}{"nonce": p.nonce, "email": "ada@example.com", "email_verified": true},
+		})
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"sub": "user-1", "name": "Ada Lovelace"})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// signIn runs a sign-in against the fake provider, with the callback query changed by
+// callback
+func signIn(t *testing.T, p *fakeProvider, callback func(query url.Values)) (*Identity, error) {
+	t.Helper()
+	sessions := scs.New()
+	client := New(sessions)
+	client.HTTPClient = p.Client()
+	err := client.Register(&Provider{
+		Name: "fake", ClientID: "client", ClientSecret: "secret", Issuer: p.URL,
+		RedirectURL: "http://app.test/auth/fake/callback", Scopes: []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identity *Identity
+	var callbackErr error
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/fake", func(w http.ResponseWriter, r *http.Request) {
+		if err := client.Redirect(w, r, "fake"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	mux.HandleFunc("/auth/fake/callback", func(w http.ResponseWriter, r *http.Request) {
+		identity, callbackErr = client.Callback(r, "fake")
+	})
+	app := sessions.LoadAndSave(mux)
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/fake", nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || w.Code != http.StatusFound {
+		t.Fatalf("redirect = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	authorize := location.Query()
+	if authorize.Get("code_challenge_method") != "S256" || authorize.Get("scope") != "openid email" {
+		t.Fatalf("authorization url %s", location)
+	}
+	p.challenge, p.nonce = authorize.Get("code_challenge"), authorize.Get("nonce")
+
+	query := url.Values{"code": {"good-code"}, "state": {authorize.Get("state")}}
+	callback(query)
+	r := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?"+query.Encode(), nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	app.ServeHTTP(httptest.NewRecorder(), r)
+	return identity, callbackErr
+}
+
+func TestOpenIDConnectSignIn(t *testing.T) {
+	p := newFakeProvider(t)
+	identity, err := signIn(t, p, func(url.Values) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "user-1" || identity.Email != "ada@example.com" || !identity.EmailVerified ||
+		identity.Name != "Ada Lovelace" || identity.Token.AccessToken != "access" {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestSignInFailures(t *testing.T) {
+	p := newFakeProvider(t)
+	tests := []struct {
+		name     string
+		callback func(query url.Values)
+		setup    func()
+		want     error
+	}{
+		{"forged state", func(q url.Values) { q.Set("state", "forged") }, nil, ErrInvalidState},
+		{"missing state", func(q url.Values) { q.Del("state") }, nil, ErrInvalidState},
+		{"denied", func(q url.Values) { q.Del("code"); q.Set("error", "access_denied") }, nil, &ProviderError{}},
+		{"bad code", func(q url.Values) { q.Set("code", "bad") }, nil, &ProviderError{}},
+		{"other audience", func(url.Values) {}, func() { p.audience = "other" }, ErrInvalidIDToken},
+		{"replayed nonce", func(url.Values) {}, func() { p.audience, p.nonce = "client", "old" }, ErrInvalidIDToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := signIn(t, p, func(q url.Values) {
+				test.callback(q)
+				if test.setup != nil {
+					test.setup()
+				}
+			})
+			var providerErr *ProviderError
+			if _, wantProvider := test.want.(*ProviderError); wantProvider {
+				if !errors.As(err, &providerErr) {
+					t.Errorf("err = %v, want a ProviderError", err)
+				}
+				return
+			}
+			if !errors.Is(err, test.want) {
+				t.Errorf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestRotatedProviderKeys(t *testing.T) {
+	p := newFakeProvider(t)
+	if _, err := signIn(t, p, func(url.Values) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a signature of an unknown key fails, even after downloading the keys again
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	p.signer, _ = jwt.New(jwt.Options{}, jwt.NewMemoryStore(), jwt.NewEd25519Key(private))
+	if _, err := signIn(t, p, func(url.Values) {}); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("err = %v, want ErrInvalidIDToken", err)
+	}
+	p.keys = p.signer.JWKS()
+	if _, err := signIn(t, p, func(url.Values) {}); err != nil {
+		t.Errorf("rotated key: %v", err)
+	}
+}
+
+func TestPlainOAuthProvider(t *testing.T) {
+	client := New(scs.New())
+	if err := client.Register(&Provider{Name: "github", ClientID: "id", RedirectURL: "http://app.test/cb"}); err == nil {
+		t.Error("providers without an issuer need the auth and token urls")
+	}
+
+	identity := &Identity{Claims: map[string]interface{}{"id": float64(4021), "login": "ada", "avatar_url": "https://a/x.png"}}
+	identity.fill()
+	if identity.Subject != "4021" || identity.Name != "ada" || identity.AvatarURL != "https://a/x.png" {
+		t.Errorf("identity = %+v", identity)
+	}
+}
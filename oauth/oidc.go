@@ -0,0 +1,128 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deenikarim/gudu/jwt"
+)
+
+// keysRefresh is the minimum time between two downloads of the JWKS of a provider,
+// which is downloaded again when an ID token names an unknown key
+const keysRefresh = 5 * time.Minute
+
+// discovery is the part of the OpenID provider metadata used by the client
+type discovery struct {
+	Issuer           string   `json:"issuer"`
+	AuthURL          string   `json:"authorization_endpoint"`
+	TokenURL         string   `json:"token_endpoint"`
+	UserInfoURL      string   `json:"userinfo_endpoint"`
+	JWKSURL          string   `json:"jwks_uri"`
+	TokenAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// discover fills the endpoints of an OpenID Connect provider that are not configured,
+// once; plain OAuth 2.0 providers are left alone
+func (c *Client) discover(ctx context.Context, provider *Provider) error {
+	if !provider.openID() {
+		return nil
+	}
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.discovered {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(provider.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	var metadata discovery
+	if err := c.doJSON(req, &metadata); err != nil {
+		return fmt.Errorf("oauth: discovery of %s: %w", provider.Name, err)
+	}
+	// the issuer of the metadata must be the configured one, or ID tokens of
+	// another issuer would be accepted
+	if metadata.Issuer != provider.Issuer {
+		return fmt.Errorf("oauth: discovery of %s returned issuer %q", provider.Name, metadata.Issuer)
+	}
+
+	for _, endpoint := range []struct {
+		field *string
+		value string
+	}{
+		{&provider.AuthURL, metadata.AuthURL},
+		{&provider.TokenURL, metadata.TokenURL},
+		{&provider.UserInfoURL, metadata.UserInfoURL},
+		{&provider.JWKSURL, metadata.JWKSURL},
+	} {
+		if *endpoint.field == "" {
+			*endpoint.field = endpoint.value
+		}
+	}
+	if len(metadata.TokenAuthMethods) > 0 && !slices.Contains(metadata.TokenAuthMethods, "client_secret_post") {
+		provider.BasicAuth = true
+	}
+	if provider.AuthURL == "" || provider.TokenURL == "" || provider.JWKSURL == "" {
+		return fmt.Errorf("oauth: discovery of %s is missing endpoints", provider.Name)
+	}
+	provider.discovered = true
+	return nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID
+// token. Providers rotate their keys, so the JWKS is downloaded again when no key
+// verifies the token.
+func (c *Client) verifyIDToken(ctx context.Context, provider *Provider, token, nonce string) (*jwt.Claims, error) {
+	if token == "" {
+		return nil, ErrInvalidIDToken
+	}
+	options := jwt.Options{Issuer: provider.Issuer, Audience: []string{provider.ClientID}}
+
+	keys, err := c.providerKeys(ctx, provider, false)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := jwt.Verify(token, options, keys...)
+	if errors.Is(err, jwt.ErrInvalidToken) {
+		if keys, err = c.providerKeys(ctx, provider, true); err != nil {
+			return nil, err
+		}
+		claims, err = jwt.Verify(token, options, keys...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if stored, _ := claims.Extra["nonce"].(string); stored != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// providerKeys returns the keys of the JWKS of the provider, downloading them when
+// there are none yet, or when refresh is set and the last download is old enough
+func (c *Client) providerKeys(ctx context.Context, provider *Provider, refresh bool) ([]jwt.Key, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if len(provider.keys) > 0 && (!refresh || time.Since(provider.keysAt) < keysRefresh) {
+		return provider.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwt.JWKS
+	if err := c.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("oauth: keys of %s: %w", provider.Name, err)
+	}
+	provider.keys = set.VerificationKeys()
+	provider.keysAt = time.Now()
+	return provider.keys, nil
+}
@@ -0,0 +1,410 @@
+package gudu
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PaginateOptions holds the settings of Paginate
+type PaginateOptions struct {
+	// DefaultPerPage is used when the request does not ask for a page size
+	DefaultPerPage int
+	// MaxPerPage caps the page size a client can ask for
+	MaxPerPage int
+	// PageParam, PerPageParam and CursorParam name the query parameters, by default
+	// page, per_page and cursor
+	PageParam    string
+	PerPageParam string
+	CursorParam  string
+}
+
+// Pagination is the page requested by a client, created by Paginate. Offset pagination
+// uses Page and PerPage; keyset pagination is used when the request carries a cursor
+// or when Keyset is called, and pages through the values of an indexed column.
+type Pagination struct {
+	Page    int
+	PerPage int
+	// Total is the number of items, -1 while unknown; set it with SetTotal
+	Total int64
+
+	cursor     *pageCursor
+	keyset     bool
+	nextCursor string
+	prevCursor string
+	options    PaginateOptions
+	url        url.URL
+}
+
+// pageCursor is the decoded form of an opaque cursor parameter
+type pageCursor struct {
+	Key      interface{} `json:"k"`
+	Backward bool        `json:"b,omitempty"`
+}
+
+// PageMeta describes the current page in a PageEnvelope
+type PageMeta struct {
+	Page       int    `json:"page,omitempty" xml:"page,omitempty"`
+	PerPage    int    `json:"per_page" xml:"per_page"`
+	Total      *int64 `json:"total,omitempty" xml:"total,omitempty"`
+	TotalPages *int64 `json:"total_pages,omitempty" xml:"total_pages,omitempty"`
+}
+
+// PageLinks holds the URLs of the neighbouring pages in a PageEnvelope
+type PageLinks struct {
+	First string `json:"first,omitempty" xml:"first,omitempty"`
+	Prev  string `json:"prev,omitempty" xml:"prev,omitempty"`
+	Next  string `json:"next,omitempty" xml:"next,omitempty"`
+	Last  string `json:"last,omitempty" xml:"last,omitempty"`
+}
+
+// PageEnvelope is the standard body of paginated API responses
+type PageEnvelope struct {
+	XMLName struct{}    `json:"-" xml:"page"`
+	Data    interface{} `json:"data" xml:"data"`
+	Meta    PageMeta    `json:"meta" xml:"meta"`
+	Links   PageLinks   `json:"links" xml:"links"`
+}
+
+// Paginate reads the page, per_page and cursor query parameters of the request. The
+// page size defaults to 20 and is capped at 100 unless options say otherwise, and the
+// page is capped so its offset fits in 32 bits; invalid values fall back to the
+// defaults instead of failing the request.
+func Paginate(r *http.Request, opts ...PaginateOptions) *Pagination {
+	options := PaginateOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.DefaultPerPage <= 0 {
+		options.DefaultPerPage = 20
+	}
+	if options.MaxPerPage <= 0 {
+		options.MaxPerPage = 100
+	}
+	if options.PageParam == "" {
+		options.PageParam = "page"
+	}
+	if options.PerPageParam == "" {
+		options.PerPageParam = "per_page"
+	}
+	if options.CursorParam == "" {
+		options.CursorParam = "cursor"
+	}
+
+	query := r.URL.Query()
+	p := &Pagination{Page: 1, PerPage: options.DefaultPerPage, Total: -1, options: options, url: *r.URL}
+
+	if perPage, err := strconv.Atoi(query.Get(options.PerPageParam)); err == nil && perPage > 0 {
+		p.PerPage = min(perPage, options.MaxPerPage)
+	}
+	if page, err := strconv.Atoi(query.Get(options.PageParam)); err == nil && page > 0 {
+		// capped so the offset of the page can not overflow into a negative OFFSET
+		p.Page = min(page, math.MaxInt32/p.PerPage)
+	}
+	if cursor, err := decodeCursor(query.Get(options.CursorParam)); err == nil {
+		p.cursor = cursor
+	}
+	return p
+}
+
+// isKeyset reports whether the page is a keyset page
+func (p *Pagination) isKeyset() bool {
+	return p.keyset || p.cursor != nil
+}
+
+// Offset returns the number of rows to skip for the current page
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Limit returns the page size
+func (p *Pagination) Limit() int {
+	return p.PerPage
+}
+
+// LimitOffset returns the "LIMIT n OFFSET m" clause of the current page, understood by
+// postgres, mysql and mariadb
+func (p *Pagination) LimitOffset() string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", p.Limit(), p.Offset())
+}
+
+// SetTotal records the total number of items, enabling the last page link
+func (p *Pagination) SetTotal(total int64) *Pagination {
+	p.Total = total
+	return p
+}
+
+// TotalPages returns the number of pages, -1 while the total is unknown
+func (p *Pagination) TotalPages() int64 {
+	if p.Total < 0 {
+		return -1
+	}
+	return (p.Total + int64(p.PerPage) - 1) / int64(p.PerPage)
+}
+
+// HasCursor reports whether the request asked for a keyset page
+func (p *Pagination) HasCursor() bool {
+	return p.cursor != nil
+}
+
+// Backward reports whether the keyset page goes backwards from the cursor; its rows
+// are fetched in reverse order and flipped back by KeysetPage
+func (p *Pagination) Backward() bool {
+	return p.cursor != nil && p.cursor.Backward
+}
+
+// Keyset returns the condition, ordering and arguments of a keyset query on an indexed,
+// unique column, e.g. for Keyset("id", "$1"):
+//
+//	"id > $1", "id ASC", [42]
+//
+// The condition is empty on the first page. Fetch KeysetLimit rows and pass them to
+// KeysetPage, which detects whether more rows follow.
+func (p *Pagination) Keyset(column, placeholder string) (condition, orderBy string, args []interface{}) {
+	p.keyset = true
+	orderBy = column + " ASC"
+	if p.Backward() {
+		orderBy = column + " DESC"
+	}
+	if p.cursor == nil {
+		return "", orderBy, nil
+	}
+	if p.cursor.Backward {
+		return column + " < " + placeholder, orderBy, []interface{}{p.cursor.Key}
+	}
+	return column + " > " + placeholder, orderBy, []interface{}{p.cursor.Key}
+}
+
+// KeysetLimit is the number of rows to fetch for a keyset page, one more than the page
+// size to find out whether another page follows
+func (p *Pagination) KeysetLimit() int {
+	return p.PerPage + 1
+}
+
+// KeysetPage trims rows fetched with Keyset and KeysetLimit to the page, restores their
+// ascending order and records the next and previous cursors from the keys of the
+// first and last row
+func KeysetPage[T any](p *Pagination, rows []T, key func(T) interface{}) []T {
+	p.keyset = true
+	more := len(rows) > p.PerPage
+	if more {
+		rows = rows[:p.PerPage]
+	}
+	if p.Backward() {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if len(rows) == 0 {
+		return rows
+	}
+
+	first, last := key(rows[0]), key(rows[len(rows)-1])
+	hasNext, hasPrev := more, p.cursor != nil
+	if p.Backward() {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		p.nextCursor = encodeCursor(pageCursor{Key: last})
+	}
+	if hasPrev {
+		p.prevCursor = encodeCursor(pageCursor{Key: first, Backward: true})
+	}
+	return rows
+}
+
+// NextURL returns the URL of the next page, "" on the last page
+func (p *Pagination) NextURL() string {
+	switch {
+	case p.nextCursor != "":
+		return p.pageURL(0, p.nextCursor)
+	case p.isKeyset():
+		return ""
+	case p.Total >= 0 && int64(p.Page) >= p.TotalPages():
+		return ""
+	}
+	return p.pageURL(p.Page+1, "")
+}
+
+// PrevURL returns the URL of the previous page, "" on the first page
+func (p *Pagination) PrevURL() string {
+	switch {
+	case p.prevCursor != "":
+		return p.pageURL(0, p.prevCursor)
+	case p.isKeyset() || p.Page <= 1:
+		return ""
+	}
+	return p.pageURL(p.Page-1, "")
+}
+
+// FirstURL returns the URL of the first page
+func (p *Pagination) FirstURL() string {
+	return p.pageURL(1, "")
+}
+
+// LastURL returns the URL of the last page, "" while the total is unknown or for
+// keyset pages
+func (p *Pagination) LastURL() string {
+	if p.Total < 0 || p.isKeyset() {
+		return ""
+	}
+	return p.pageURL(int(max(p.TotalPages(), 1)), "")
+}
+
+// PageURL returns the URL of an offset page, keeping the other query parameters
+func (p *Pagination) PageURL(page int) string {
+	return p.pageURL(page, "")
+}
+
+// pageURL builds the request URL for a page number or a cursor
+func (p *Pagination) pageURL(page int, cursor string) string {
+	u := p.url
+	query := u.Query()
+	query.Del(p.options.PageParam)
+	query.Del(p.options.CursorParam)
+	if cursor != "" {
+		query.Set(p.options.CursorParam, cursor)
+	} else if page > 1 {
+		query.Set(p.options.PageParam, strconv.Itoa(page))
+	}
+	if p.PerPage != p.options.DefaultPerPage {
+		query.Set(p.options.PerPageParam, strconv.Itoa(p.PerPage))
+	}
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// Envelope wraps the items of the page in the standard response envelope
+func (p *Pagination) Envelope(data interface{}) *PageEnvelope {
+	envelope := &PageEnvelope{
+		Data: data,
+		Meta: PageMeta{PerPage: p.PerPage},
+		Links: PageLinks{
+			Prev: p.PrevURL(),
+			Next: p.NextURL(),
+			Last: p.LastURL(),
+		},
+	}
+	if !p.isKeyset() {
+		envelope.Meta.Page = p.Page
+		envelope.Links.First = p.FirstURL()
+	}
+	if p.Total >= 0 {
+		total, pages := p.Total, p.TotalPages()
+		envelope.Meta.Total, envelope.Meta.TotalPages = &total, &pages
+	}
+	return envelope
+}
+
+// Links returns the RFC 8288 Link header value of the page
+func (p *Pagination) Links() string {
+	var links []string
+	for _, link := range []struct{ rel, url string }{
+		{"first", p.FirstURL()}, {"prev", p.PrevURL()}, {"next", p.NextURL()}, {"last", p.LastURL()},
+	} {
+		if link.url == "" || (link.rel == "first" && p.isKeyset()) {
+			continue
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, link.url, link.rel))
+	}
+	return strings.Join(links, ", ")
+}
+
+// Paginated sets the Link header of the page and, when known, X-Total-Count
+func (r *Response) Paginated(p *Pagination) *Response {
+	if links := p.Links(); links != "" {
+		r.Writer.Header().Set("Link", links)
+	}
+	if p.Total >= 0 {
+		r.Writer.Header().Set("X-Total-Count", strconv.FormatInt(p.Total, 10))
+	}
+	return r
+}
+
+// paginationPartial renders the page links of a Pagination
+var paginationPartial = template.Must(template.New("pagination").Parse(
+	`<nav class="pagination" aria-label="Pagination"><ul>` +
+		`{{with .Prev}}<li><a href="{{.}}" rel="prev">&laquo; Previous</a></li>{{end}}` +
+		`{{range .Pages}}{{if eq .Number 0}}<li><span>&hellip;</span></li>{{else if .Current}}<li><span aria-current="page">{{.Number}}</span></li>{{else}}<li><a href="{{.URL}}">{{.Number}}</a></li>{{end}}{{end}}` +
+		`{{with .Next}}<li><a href="{{.}}" rel="next">Next &raquo;</a></li>{{end}}` +
+		`</ul></nav>`))
+
+// paginationPage is a numbered link of the pagination partial; Number 0 is a gap
+type paginationPage struct {
+	Number  int
+	URL     string
+	Current bool
+}
+
+// PaginationLinks renders the pagination partial, the previous and next links and,
+// when the total is known, the numbered pages around the current one. It is the
+// paginate template function: {{ paginate .Pagination }} in Go templates and
+// {{ paginate(pagination) | raw }} in Jet.
+func PaginationLinks(p *Pagination) template.HTML {
+	if p == nil {
+		return ""
+	}
+	data := struct {
+		Prev, Next string
+		Pages      []paginationPage
+	}{Prev: p.PrevURL(), Next: p.NextURL()}
+
+	if pages := int(p.TotalPages()); pages > 1 && !p.isKeyset() {
+		last := 0
+		for n := 1; n <= pages; n++ {
+			if n != 1 && n != pages && (n < p.Page-2 || n > p.Page+2) {
+				continue
+			}
+			if last != 0 && n > last+1 {
+				data.Pages = append(data.Pages, paginationPage{})
+			}
+			data.Pages = append(data.Pages, paginationPage{Number: n, URL: p.PageURL(n), Current: n == p.Page})
+			last = n
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := paginationPartial.Execute(&buf, data); err != nil {
+		return ""
+	}
+	return template.HTML(buf.String())
+}
+
+// encodeCursor returns the opaque form of a cursor
+func encodeCursor(c pageCursor) string {
+	content, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// decodeCursor parses an opaque cursor parameter
+func decodeCursor(s string) (*pageCursor, error) {
+	if s == "" {
+		return nil, fmt.Errorf("no cursor")
+	}
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &pageCursor{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(c); err != nil {
+		return nil, err
+	}
+	// numeric keys go back to the database as integers rather than strings
+	if number, ok := c.Key.(json.Number); ok {
+		if n, err := number.Int64(); err == nil {
+			c.Key = n
+		} else if f, err := number.Float64(); err == nil {
+			c.Key = f
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,187 @@
+package gudu
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pageOf paginates a GET request of the target
+func pageOf(target string, opts ...PaginateOptions) *Pagination {
+	return Paginate(httptest.NewRequest(http.MethodGet, target, nil), opts...)
+}
+
+func TestPaginateBoundsTheParameters(t *testing.T) {
+	tests := []struct {
+		target        string
+		page, perPage int
+	}{
+		{"/posts", 1, 20},
+		{"/posts?page=3&per_page=10", 3, 10},
+		{"/posts?page=0&per_page=-5", 1, 20},
+		{"/posts?page=two&per_page=ten", 1, 20},
+		{"/posts?per_page=5000", 1, 100},
+		{"/posts?page=9223372036854775807&per_page=100", math.MaxInt32 / 100, 100},
+	}
+	for _, tt := range tests {
+		p := pageOf(tt.target)
+		if p.Page != tt.page || p.PerPage != tt.perPage {
+			t.Errorf("%s: page %d per page %d, want %d and %d", tt.target, p.Page, p.PerPage, tt.page, tt.perPage)
+		}
+		if p.Offset() < 0 || p.Offset() > math.MaxInt32 {
+			t.Errorf("%s: offset %d", tt.target, p.Offset())
+		}
+	}
+
+	p := pageOf("/posts?p=2&size=15", PaginateOptions{DefaultPerPage: 5, MaxPerPage: 10, PageParam: "p", PerPageParam: "size"})
+	if p.Page != 2 || p.PerPage != 10 || p.LimitOffset() != "LIMIT 10 OFFSET 10" {
+		t.Errorf("custom options: %s", p.LimitOffset())
+	}
+}
+
+func TestPaginationOffsetLinks(t *testing.T) {
+	p := pageOf("/posts?q=go&page=2&per_page=10")
+	if next := p.NextURL(); next != "/posts?page=3&per_page=10&q=go" {
+		t.Errorf("next without a total = %s", next)
+	}
+	if p.LastURL() != "" {
+		t.Error("the last page is unknown without a total")
+	}
+
+	p.SetTotal(45)
+	want := map[string]string{
+		"first": "/posts?per_page=10&q=go",
+		"prev":  "/posts?per_page=10&q=go",
+		"next":  "/posts?page=3&per_page=10&q=go",
+		"last":  "/posts?page=5&per_page=10&q=go",
+	}
+	got := map[string]string{"first": p.FirstURL(), "prev": p.PrevURL(), "next": p.NextURL(), "last": p.LastURL()}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("links = %v", got)
+	}
+	if links := p.Links(); links != `</posts?per_page=10&q=go>; rel="first", </posts?per_page=10&q=go>; rel="prev", `+
+		`</posts?page=3&per_page=10&q=go>; rel="next", </posts?page=5&per_page=10&q=go>; rel="last"` {
+		t.Errorf("Link = %s", links)
+	}
+
+	last := pageOf("/posts?page=5&per_page=10").SetTotal(45)
+	if last.NextURL() != "" || pageOf("/posts").PrevURL() != "" {
+		t.Error("the last page has no next page, the first no previous one")
+	}
+
+	w := httptest.NewRecorder()
+	(&Response{Writer: w}).Paginated(p)
+	if w.Header().Get("X-Total-Count") != "45" || !strings.Contains(w.Header().Get("Link"), `rel="last"`) {
+		t.Errorf("headers %v", w.Header())
+	}
+}
+
+func TestPaginationEnvelope(t *testing.T) {
+	p := pageOf("/posts?page=2&per_page=10").SetTotal(45)
+	content, err := json.Marshal(p.Envelope([]string{"a", "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Data  []string          `json:"data"`
+		Meta  map[string]int    `json:"meta"`
+		Links map[string]string `json:"links"`
+	}
+	if err := json.Unmarshal(content, &body); err != nil {
+		t.Fatal(err)
+	}
+	meta := map[string]int{"page": 2, "per_page": 10, "total": 45, "total_pages": 5}
+	if len(body.Data) != 2 || !reflect.DeepEqual(body.Meta, meta) || len(body.Links) != 4 {
+		t.Errorf("envelope %s", content)
+	}
+
+	// unknown totals are left out
+	content, _ = json.Marshal(pageOf("/posts").Envelope(nil))
+	if strings.Contains(string(content), "total") || strings.Contains(string(content), `"last"`) {
+		t.Errorf("envelope without a total %s", content)
+	}
+}
+
+// keysetRows returns the rows of a keyset query over the ids 1 to 25, as a database would
+func keysetRows(p *Pagination) []int {
+	condition, orderBy, args := p.Keyset("id", "$1")
+	var rows []int
+	for id := 1; id <= 25; id++ {
+		if condition != "" {
+			key := int(args[0].(int64))
+			if (strings.Contains(condition, ">") && id <= key) || (strings.Contains(condition, "<") && id >= key) {
+				continue
+			}
+		}
+		rows = append(rows, id)
+	}
+	if strings.HasSuffix(orderBy, "DESC") {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	return rows[:min(len(rows), p.KeysetLimit())]
+}
+
+func TestKeysetPagination(t *testing.T) {
+	identity := func(id int) interface{} { return id }
+
+	first := pageOf("/posts?per_page=10")
+	if condition, orderBy, args := first.Keyset("id", "$1"); condition != "" || orderBy != "id ASC" || args != nil {
+		t.Errorf("first page: %q %q %v", condition, orderBy, args)
+	}
+	rows := KeysetPage(first, keysetRows(first), identity)
+	if len(rows) != 10 || rows[9] != 10 || first.PrevURL() != "" || first.NextURL() == "" {
+		t.Fatalf("first page %v, prev %q", rows, first.PrevURL())
+	}
+	if links := first.Links(); strings.Contains(links, `"first"`) || strings.Contains(links, `"last"`) {
+		t.Errorf("keyset pages have no first and last links: %s", links)
+	}
+
+	// the cursor of the next link goes back to the database as an integer
+	second := pageOf(first.NextURL())
+	condition, _, args := second.Keyset("id", "$1")
+	if !second.HasCursor() || condition != "id > $1" || !reflect.DeepEqual(args, []interface{}{int64(10)}) {
+		t.Fatalf("second page: %q %#v", condition, args)
+	}
+	rows = KeysetPage(second, keysetRows(second), identity)
+	if rows[0] != 11 || rows[9] != 20 || second.PrevURL() == "" {
+		t.Fatalf("second page %v", rows)
+	}
+
+	// going back fetches in reverse and restores the ascending order
+	back := pageOf(second.PrevURL())
+	if condition, orderBy, _ := back.Keyset("id", "$1"); !back.Backward() || condition != "id < $1" || orderBy != "id DESC" {
+		t.Fatalf("previous page: %q %q", condition, orderBy)
+	}
+	rows = KeysetPage(back, keysetRows(back), identity)
+	if rows[0] != 1 || rows[9] != 10 || back.NextURL() == "" || back.PrevURL() != "" {
+		t.Errorf("previous page %v, prev %q", rows, back.PrevURL())
+	}
+
+	third := pageOf(second.NextURL())
+	rows = KeysetPage(third, keysetRows(third), identity)
+	if len(rows) != 5 || third.NextURL() != "" {
+		t.Errorf("last page %v, next %q", rows, third.NextURL())
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, key := range []interface{}{int64(42), 2.5, "2024-05-01T10:00:00Z"} {
+		c, err := decodeCursor(encodeCursor(pageCursor{Key: key, Backward: true}))
+		if err != nil || c.Key != key || !c.Backward {
+			t.Errorf("%#v came back as %#v, %v", key, c, err)
+		}
+	}
+	// invalid cursors are ignored like the other invalid parameters
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24"} {
+		if p := pageOf("/posts?cursor=" + url.QueryEscape(cursor)); p.HasCursor() {
+			t.Errorf("cursor %q was accepted: %#v", cursor, p.cursor)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package gudu
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deenikarim/gudu/auth"
+)
+
+// passwordResetConfig holds the password reset settings, read from the environment
+type passwordResetConfig struct {
+	url        string
+	subject    string
+	rules      []string
+	maxMails   int
+	mailWindow time.Duration
+}
+
+// loadPasswordResetConfig reads the password reset settings. AUTH_RESET_URL is the
+// page with the new password form, relative URLs are resolved against SERVER_NAME;
+// AUTH_PASSWORD_RULES are the Validator rules of new passwords. At most
+// AUTH_RESET_MAX_MAILS links are mailed to an address per AUTH_RESET_MAIL_WINDOW.
+func loadPasswordResetConfig() passwordResetConfig {
+	rules := strings.Split(getEnvOrDefault("AUTH_PASSWORD_RULES", "required;min:8;confirmed;password"), ";")
+	config := passwordResetConfig{
+		url:        getEnvOrDefault("AUTH_RESET_URL", "/reset-password"),
+		subject:    getEnvOrDefault("AUTH_RESET_SUBJECT", "Reset your password"),
+		rules:      rules,
+		mailWindow: envDuration("AUTH_RESET_MAIL_WINDOW"),
+	}
+	config.maxMails, _ = strconv.Atoi(os.Getenv("AUTH_RESET_MAX_MAILS"))
+	if config.maxMails <= 0 {
+		config.maxMails = 3
+	}
+	if config.mailWindow <= 0 {
+		config.mailWindow = 10 * time.Minute
+	}
+	return config
+}
+
+// passwordResetStatus is the answer to every reset request, so it does not reveal
+// whether an account exists
+const passwordResetStatus = "If an account exists for this email address, a password reset link has been sent."
+
+// ForgotPassword handles the forgot-password form, register it with Gudu.Handle:
+//
+//	mux.Post("/forgot-password", app.Handle(app.ForgotPassword))
+//
+// The email field is validated, then the reset mail is sent in the background, so
+// every request gets the same answer in the same time: a redirect back with the
+// message in the "status" session key, or 202 with a JSON message for APIs. Requests
+// over the limits of throttlePasswordReset get the same answer without a mail.
+func (g *Gudu) ForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Email string `json:"email" xml:"email" form:"email" validate:"required;email"`
+	}
+	if err := g.Bind(r, &input); err != nil {
+		return g.authFormError(w, r, err)
+	}
+
+	email := strings.TrimSpace(input.Email)
+	allowed, err := g.throttlePasswordReset(r, email)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := g.sendPasswordReset(ctx, email); err != nil && g.ErrorLog != nil {
+				g.ErrorLog.Println("password reset:", err)
+			}
+		}()
+	}
+	return g.authFormStatus(w, r, http.StatusAccepted, passwordResetStatus, backURL(r))
+}
+
+// throttlePasswordReset counts a reset mail of the email address and of the client,
+// reporting whether it may be sent: at most AUTH_RESET_MAX_MAILS per address, so an
+// inbox can not be flooded, and four times as many per client address
+func (g *Gudu) throttlePasswordReset(r *http.Request, email string) (bool, error) {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	limits := []struct {
+		throttle *auth.Throttle
+		key      string
+	}{
+		{g.resetThrottle, "reset:" + hex.EncodeToString(sum[:16])},
+		{g.resetThrottle.WithMax(4 * g.config.passwordReset.maxMails), "reset-client:" + host},
+	}
+
+	for _, limit := range limits {
+		if wait, err := limit.throttle.Locked(limit.key); err != nil || wait > 0 {
+			return false, err
+		}
+	}
+	for _, limit := range limits {
+		if _, err := limit.throttle.Hit(limit.key); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sendPasswordReset mails a signed reset link to the user of the email address, if
+// there is an active one
+func (g *Gudu) sendPasswordReset(ctx context.Context, email string) error {
+	_, token, err := g.Auth.CreateResetToken(ctx, email)
+	if errors.Is(err, auth.ErrUserNotFound) || errors.Is(err, auth.ErrInactive) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ttl := g.Auth.Config().ResetTTL
+	link, err := g.SignedURL(g.absoluteURL(g.config.passwordReset.url), url.Values{"token": {token}}, ttl)
+	if err != nil {
+		return err
+	}
+	return g.sendAuthMail(email, g.config.passwordReset.subject, "password-reset", map[string]interface{}{
+		"Email":   email,
+		"Link":    link,
+		"Minutes": int(ttl / time.Minute),
+	})
+}
+
+// ResetPassword handles the new password form of the page the reset link opens,
+// register it with Gudu.Handle; protect the page itself with ValidateSignature:
+//
+//	mux.With(app.ValidateSignature).Get("/reset-password", handlers.ResetPasswordPage)
+//	mux.Post("/reset-password", app.Handle(app.ResetPassword))
+//
+// The form posts the token query parameter of the link with the password and
+// password_confirmation fields. The password must pass AUTH_PASSWORD_RULES; the token
+// works once, and every session and remember-me cookie of the user ends. Browsers are
+// redirected to the login page with a "status" message, APIs get 200.
+func (g *Gudu) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Token                string `json:"token" xml:"token" form:"token" validate:"required"`
+		Password             string `json:"password" xml:"password" form:"password"`
+		PasswordConfirmation string `json:"password_confirmation" xml:"password_confirmation" form:"password_confirmation"`
+	}
+	if err := g.Bind(r, &input); err != nil {
+		return g.authFormError(w, r, err)
+	}
+
+	data := url.Values{"password": {input.Password}, "password_confirmation": {input.PasswordConfirmation}}
+	v := g.NewValidator(data, nil, map[string][]string{"password": g.config.passwordReset.rules}, nil)
+	if !v.Validate() {
+		return g.authFormError(w, r, v.Errors)
+	}
+
+	if _, err := g.Auth.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return g.authFormError(w, r, ValidationErrors{"token": {"This password reset link is invalid or has expired."}})
+		}
+		return err
+	}
+	return g.authFormStatus(w, r, http.StatusOK, "Your password has been reset, you can now log in.", g.Auth.Config().LoginPath)
+}
+
+// authFormStatus answers a form of the auth flows: browsers are redirected to location
+// with the message in the "status" session key, APIs get the status with a JSON message
+func (g *Gudu) authFormStatus(w http.ResponseWriter, r *http.Request, status int, message, location string) error {
+	resp := g.ResponseFor(w, r)
+	if resp.problemMediaType() == "text/html" {
+		g.Sessions.Put(r.Context(), "status", message)
+		http.Redirect(w, r, location, http.StatusSeeOther)
+		return nil
+	}
+	return resp.Negotiate(map[string]string{"message": message}, status)
+}
+
+// authFormError answers a rejected auth form: browsers are sent back with the first
+// validation message in the "error" session key, other errors go to HandleError
+func (g *Gudu) authFormError(w http.ResponseWriter, r *http.Request, err error) error {
+	var validation ValidationErrors
+	if !errors.As(err, &validation) || g.ResponseFor(w, r).problemMediaType() != "text/html" {
+		return err
+	}
+
+	fields := make([]string, 0, len(validation))
+	for field := range validation {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	if len(fields) > 0 && len(validation[fields[0]]) > 0 {
+		g.Sessions.Put(r.Context(), "error", validation[fields[0]][0])
+	}
+	http.Redirect(w, r, backURL(r), http.StatusSeeOther)
+	return nil
+}
+
+// backURL returns the page a form was posted from, when it is one of this host, and
+// the path of the request otherwise
+func backURL(r *http.Request) string {
+	if referer, err := url.Parse(r.Referer()); err == nil && referer.Host == r.Host && referer.Path != "" {
+		return referer.RequestURI()
+	}
+	return r.URL.Path
+}
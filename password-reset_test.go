@@ -0,0 +1,63 @@
+package gudu
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deenikarim/gudu/auth"
+)
+
+// resetRequest posts the forgot-password form of a client as JSON
+func resetRequest(email, client string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/forgot-password", strings.NewReader(`{"email": "`+email+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	r.RemoteAddr = client + ":1234"
+	return r
+}
+
+func TestPasswordResetMailsAreThrottled(t *testing.T) {
+	g := testGudu(t)
+	g.config.passwordReset.maxMails = 2
+	g.resetThrottle = auth.NewThrottle(auth.NewMemoryStore(), 2, time.Minute)
+
+	allowed := func(email, client string) bool {
+		ok, err := g.throttlePasswordReset(resetRequest(email, client), email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// per address, whatever the client and the case of the address
+	if !allowed("ada@example.com", "10.0.0.1") || !allowed("Ada@Example.com", "10.0.0.2") {
+		t.Fatal("the first mails are sent")
+	}
+	if allowed("ada@example.com", "10.0.0.3") {
+		t.Error("an address receives at most AUTH_RESET_MAX_MAILS mails")
+	}
+
+	// per client, four times the limit of an address
+	sent := 0
+	for i := 0; i < 10; i++ {
+		if allowed("user"+strconv.Itoa(i)+"@example.com", "10.0.0.9") {
+			sent++
+		}
+	}
+	if sent != 8 {
+		t.Errorf("a client sent %d mails, want 8", sent)
+	}
+
+	// a throttled request gets the answer of every other request
+	w := httptest.NewRecorder()
+	if err := g.ForgotPassword(w, resetRequest("ada@example.com", "10.0.0.4")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), passwordResetStatus) {
+		t.Errorf("throttled request = %d %s", w.Code, w.Body.String())
+	}
+}
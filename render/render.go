@@ -2,6 +2,7 @@ package render
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/CloudyKit/jet/v6"
 	"github.com/alexedwards/scs/v2"
@@ -24,6 +25,9 @@ type Render struct {
 	GoTemplateCache   sync.Map
 	CustomsFuncs      template.FuncMap
 	Session           *scs.SessionManager
+	// Authorize answers the can template function for the request, which denies
+	// everything when it is nil
+	Authorize func(r *http.Request, ability string, subject any) bool
 	// DefaultData       *TemplateData
 	DevelopmentMode bool
 	once            sync.Once
@@ -41,6 +45,23 @@ type TemplateData struct {
 	ServerName          string
 	FormData            url.Values
 	Errors              map[string][]string
+	CSPNonce            string
+	// request is the request rendered, for request scoped template functions
+	request *http.Request
+}
+
+// cspNonceKey is the request context key holding the Content-Security-Policy nonce
+type cspNonceKey struct{}
+
+// WithCSPNonce returns a copy of ctx carrying the Content-Security-Policy nonce
+func WithCSPNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, cspNonceKey{}, nonce)
+}
+
+// CSPNonceFromContext returns the Content-Security-Policy nonce of the request, if any
+func CSPNonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey{}).(string)
+	return nonce
 }
 
 // AddDefaultsData add common dynamic data on every webpage
@@ -52,6 +73,8 @@ func (r *Render) AddDefaultsData(td *TemplateData, rr *http.Request) *TemplateDa
 	td.ServerName = r.ServerName
 	td.Port = r.Port
 	td.Secure = r.Secure
+	td.CSPNonce = CSPNonceFromContext(rr.Context())
+	td.request = rr
 	if r.Session.Exists(rr.Context(), "user_id") {
 		td.IsUserAuthenticated = true
 	}
@@ -69,6 +92,52 @@ func (r *Render) AddCustomFuncs(funcMaps template.FuncMap) {
 	}
 }
 
+// templateFuncs returns the built-in Go template functions merged with the custom ones
+func (r *Render) templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		// cspNonce returns the request nonce to use as {{ cspNonce . }} in nonce attributes
+		"cspNonce": func(td *TemplateData) string {
+			if td == nil {
+				return ""
+			}
+			return td.CSPNonce
+		},
+		// can reports whether the user may perform an ability, as
+		// {{ if can . "update" .GenericData.post }} or {{ if can . "manage-users" }}
+		"can": func(td *TemplateData, ability string, subject ...any) bool {
+			if td == nil {
+				return false
+			}
+			return r.can(td.request, ability, subject)
+		},
+	}
+	for name, fn := range r.CustomsFuncs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// can asks Authorize whether the user of the request may perform the ability on the
+// optional subject
+func (r *Render) can(rr *http.Request, ability string, subject []any) bool {
+	if r.Authorize == nil || rr == nil {
+		return false
+	}
+	var model any
+	if len(subject) > 0 {
+		model = subject[0]
+	}
+	return r.Authorize(rr, ability, model)
+}
+
+// AddGlobalFunc registers a template function for both the Go and the Jet engines
+func (r *Render) AddGlobalFunc(name string, fn any) {
+	r.AddCustomFuncs(template.FuncMap{name: fn})
+	if r.JetViews != nil {
+		r.JetViews.AddGlobal(name, fn)
+	}
+}
+
 // RenderPage specifies default template rendering engine
 func (r *Render) RenderPage(w http.ResponseWriter, rr *http.Request, templateName string, variables, data any) error {
 	switch strings.ToLower(r.RendererEngine) {
@@ -98,6 +167,12 @@ func (r *Render) RenderJetPage(w http.ResponseWriter, rr *http.Request, template
 
 	td = r.AddDefaultsData(td, rr)
 
+	// request scoped template functions, used as {{ cspNonce() }}
+	nonce := td.CSPNonce
+	varsData.Set("cspNonce", func() string { return nonce })
+	// {{ if can("update", post) }}
+	varsData.Set("can", func(ability string, subject ...any) bool { return r.can(rr, ability, subject) })
+
 	t, err := r.JetViews.GetTemplate(fmt.Sprintf("%s.jet", templateName))
 	if err != nil {
 		log.Println(err)
@@ -129,17 +204,43 @@ func (r *Render) ParseTemplates() error {
 	for _, page := range pageFiles {
 		files := append(layoutFiles, page)
 		name := filepath.Base(page)
-		tmpl, err := template.New(name).Funcs(r.CustomsFuncs).ParseFiles(files...)
+		tmpl, err := template.New(name).Funcs(r.templateFuncs()).ParseFiles(files...)
 		if err != nil {
 			return fmt.Errorf("error parsing template files: %v", err)
 		}
 
 		r.GoTemplateCache.Store(name, tmpl)
 	}
+
+	// error pages, cached as errors/{status}.gohtml
+	errorFiles, err := filepath.Glob(filepath.Join("views", "errors/*.gohtml"))
+	if err != nil {
+		return fmt.Errorf("error globbing error pages: %v", err)
+	}
+
+	for _, page := range errorFiles {
+		files := append(append([]string{}, layoutFiles...), page)
+		name := filepath.Base(page)
+		tmpl, err := template.New(name).Funcs(r.templateFuncs()).ParseFiles(files...)
+		if err != nil {
+			return fmt.Errorf("error parsing error page %s: %v", page, err)
+		}
+
+		r.GoTemplateCache.Store("errors/"+name, tmpl)
+	}
 	log.Println("Parsed and cached templates")
 	return nil
 }
 
+// ErrorPage returns the template name of the error page for a status code,
+// views/errors/{status}.gohtml or views/errors/{status}.jet depending on the engine
+func (r *Render) ErrorPage(status int) string {
+	if strings.ToLower(r.RendererEngine) == "go" {
+		return fmt.Sprintf("errors/%d.gohtml", status)
+	}
+	return fmt.Sprintf("errors/%d", status)
+}
+
 // cacheTemplates ensures templates are cached once in production mode.
 func (r *Render) cacheTemplates() {
 	// Ensures the function inside is executed only once
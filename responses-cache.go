@@ -0,0 +1,137 @@
+package gudu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ETag modes used by Response.ETagMode
+const (
+	ETagOff    = ""
+	ETagStrong = "strong"
+	ETagWeak   = "weak"
+)
+
+// GenerateETag returns an entity tag for the content, prefixed with W/ when weak
+func GenerateETag(content []byte, weak bool) string {
+	sum := sha256.Sum256(content)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// setETag sets an ETag for the content according to the configured ETagMode, unless
+// the handler already set one
+func (r *Response) setETag(content []byte, statusCode int) {
+	if r.ETagMode == ETagOff || statusCode != http.StatusOK || r.Writer.Header().Get("ETag") != "" {
+		return
+	}
+	r.Writer.Header().Set("ETag", GenerateETag(content, r.ETagMode == ETagWeak))
+}
+
+// ETag sets the ETag of the current response
+func (r *Response) ETag(tag string, weak bool) *Response {
+	if !strings.HasPrefix(tag, `"`) {
+		tag = strconv.Quote(tag)
+	}
+	if weak {
+		tag = "W/" + tag
+	}
+	r.Writer.Header().Set("ETag", tag)
+	return r
+}
+
+// LastModified sets the Last-Modified header of the current response
+func (r *Response) LastModified(modTime time.Time) *Response {
+	r.Writer.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	return r
+}
+
+// CacheControl sets the Cache-Control header of the current response to the directives
+func (r *Response) CacheControl(directives ...string) *Response {
+	r.Writer.Header().Set("Cache-Control", strings.Join(directives, ", "))
+	return r
+}
+
+// CachePublic allows shared caches to store the response for maxAge
+func (r *Response) CachePublic(maxAge time.Duration) *Response {
+	return r.CacheControl("public", "max-age="+strconv.Itoa(int(maxAge.Seconds())))
+}
+
+// CachePrivate allows only the browser cache to store the response for maxAge
+func (r *Response) CachePrivate(maxAge time.Duration) *Response {
+	return r.CacheControl("private", "max-age="+strconv.Itoa(int(maxAge.Seconds())))
+}
+
+// CacheImmutable marks the response as never changing, e.g. for fingerprinted assets
+func (r *Response) CacheImmutable(maxAge time.Duration) *Response {
+	return r.CacheControl("public", "max-age="+strconv.Itoa(int(maxAge.Seconds())), "immutable")
+}
+
+// NoCache requires caches to revalidate the response before every reuse
+func (r *Response) NoCache() *Response {
+	return r.CacheControl("no-cache")
+}
+
+// NoStore forbids any cache from storing the response
+func (r *Response) NoStore() *Response {
+	return r.CacheControl("no-store")
+}
+
+// isNotModified evaluates If-None-Match and If-Modified-Since against the response
+// headers and reports whether a 304 Not Modified should be sent instead
+func isNotModified(r *http.Request, headers http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := headers.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETagMatch(candidate, etag) {
+				return true
+			}
+		}
+		// If-Modified-Since is ignored when If-None-Match is present
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	lastModified := headers.Get("Last-Modified")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// weakETagMatch compares two entity tags ignoring the weak indicator
+func weakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// writeNotModified sends a 304 keeping only the headers allowed on it
+func writeNotModified(w http.ResponseWriter) {
+	headers := w.Header()
+	for _, key := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+		headers.Del(key)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,245 @@
+package gudu
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/deenikarim/gudu/render"
+)
+
+// ErrNotAcceptable is returned by Negotiate when none of the available media types
+// satisfies the Accept header of the request; a 406 has already been sent
+var ErrNotAcceptable = errors.New("no acceptable representation")
+
+// Encoder serializes data into a representation of one media type
+type Encoder func(data interface{}) ([]byte, error)
+
+// mediaEncoder is a media type offered during content negotiation
+type mediaEncoder struct {
+	mediaType string
+	encode    Encoder
+}
+
+// defaultEncoders are the media types every Response can negotiate, in order of
+// preference when the client accepts several equally
+func defaultEncoders() []mediaEncoder {
+	return []mediaEncoder{
+		{mediaType: "application/json", encode: json.Marshal},
+		{mediaType: "application/xml", encode: xml.Marshal},
+		{mediaType: "text/plain", encode: encodeText},
+		{mediaType: "text/xml", encode: xml.Marshal},
+	}
+}
+
+// RegisterEncoder adds or replaces the encoder of a media type, e.g. text/csv,
+// application/yaml or application/msgpack. New media types are offered after the
+// built-in ones.
+func (r *Response) RegisterEncoder(mediaType string, encoder Encoder) *Response {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	r.encodersMu.Lock()
+	defer r.encodersMu.Unlock()
+
+	for i, e := range r.encoders {
+		if e.mediaType == mediaType {
+			r.encoders[i].encode = encoder
+			return r
+		}
+	}
+	r.encoders = append(r.encoders, mediaEncoder{mediaType: mediaType, encode: encoder})
+	return r
+}
+
+// Negotiate sends data in the representation preferred by the Accept header of the
+// request of a Response made by Gudu.ResponseFor: JSON, XML, plain text or any
+// registered encoder. When a view name is given, text/html is offered as well and the
+// view is rendered through the Renderer, with data as its template data or, for other
+// values, as GenericData["data"]. A request without an Accept header gets the first
+// offer, JSON; a request accepting none of the offers gets a 406 listing the available
+// media types.
+func (r *Response) Negotiate(data interface{}, status int, view ...string) error {
+	offers := r.offers(len(view) > 0 && view[0] != "")
+	addVary(r.Writer.Header(), "Accept")
+
+	accept := ""
+	if r.Request != nil {
+		accept = r.Request.Header.Get("Accept")
+	}
+
+	mediaType := negotiateMediaType(accept, offers)
+	if mediaType == "" {
+		available := make([]string, 0, len(offers))
+		for _, offer := range offers {
+			available = append(available, offer.mediaType)
+		}
+		r.Header(contentType, "text/plain; charset=utf-8")
+		_ = r.Send([]byte(http.StatusText(http.StatusNotAcceptable)+", available: "+strings.Join(available, ", ")),
+			http.StatusNotAcceptable)
+		return ErrNotAcceptable
+	}
+
+	if mediaType == "text/html" {
+		return r.negotiateView(view[0], data, status)
+	}
+
+	var encoder Encoder
+	for _, offer := range offers {
+		if offer.mediaType == mediaType {
+			encoder = offer.encode
+		}
+	}
+
+	content, err := encoder(data)
+	if err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		r.Header(contentType, mediaType+"; charset=utf-8")
+	} else {
+		r.Header(contentType, mediaType)
+	}
+	r.setETag(content, status)
+
+	if err := r.Send(content, status); err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	return nil
+}
+
+// negotiateView renders a view into a buffer so the status code can still be chosen
+// and rendering errors reported before anything is sent
+func (r *Response) negotiateView(view string, data interface{}, status int) error {
+	if r.Renderer == nil {
+		err := errors.New("negotiate: no renderer configured")
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	td, ok := data.(*render.TemplateData)
+	if !ok {
+		td = &render.TemplateData{GenericData: map[string]any{"data": data}}
+	}
+
+	buf := &bufferResponseWriter{header: make(http.Header)}
+	if err := r.Renderer.RenderPage(buf, r.Request, view, nil, td); err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	return r.HTML(buf.body.String(), status)
+}
+
+// offers returns the media types available for negotiation, text/html only when a
+// view can be rendered
+func (r *Response) offers(withView bool) []mediaEncoder {
+	r.encodersMu.RLock()
+	defer r.encodersMu.RUnlock()
+
+	offers := make([]mediaEncoder, 0, len(r.encoders)+1)
+	offers = append(offers, r.encoders...)
+	if len(offers) == 0 {
+		offers = defaultEncoders()
+	}
+	if withView {
+		// listed after JSON so clients without a preference still get the API format
+		offers = append(offers[:1], append([]mediaEncoder{{mediaType: "text/html"}}, offers[1:]...)...)
+	}
+	return offers
+}
+
+// acceptRange is one media range of an Accept header
+type acceptRange struct {
+	mediaType string
+	subtype   string
+	q         float64
+}
+
+// negotiateMediaType returns the offer with the highest quality in the Accept header,
+// matching each offer against its most specific media range; ties keep the order of
+// the offers. An empty header accepts the first offer.
+func negotiateMediaType(header string, offers []mediaEncoder) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0].mediaType
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		value, q := parseQuality(part)
+		mediaType, subtype, found := strings.Cut(strings.ToLower(value), "/")
+		if !found {
+			continue
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, subtype: subtype, q: q})
+	}
+
+	// most specific ranges first, so the first match decides the quality of an offer
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return rangeSpecificity(ranges[i]) > rangeSpecificity(ranges[j])
+	})
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		mediaType, subtype, _ := strings.Cut(offer.mediaType, "/")
+		for _, rng := range ranges {
+			if (rng.mediaType == "*" || rng.mediaType == mediaType) && (rng.subtype == "*" || rng.subtype == subtype) {
+				if rng.q > bestQ {
+					best, bestQ = offer.mediaType, rng.q
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+// rangeSpecificity ranks type/subtype above type/* above */*
+func rangeSpecificity(rng acceptRange) int {
+	switch {
+	case rng.mediaType == "*":
+		return 0
+	case rng.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// encodeText renders data as plain text
+func encodeText(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case error:
+		return []byte(v.Error()), nil
+	}
+	return []byte(fmt.Sprint(data)), nil
+}
+
+// bufferResponseWriter is a http.ResponseWriter collecting the body in memory
+type bufferResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *bufferResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,113 @@
+package gudu
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	offers := defaultEncoders()
+	withView := (&Response{}).offers(true)
+
+	tests := []struct {
+		accept string
+		offers []mediaEncoder
+		want   string
+	}{
+		{"", offers, "application/json"},
+		{"*/*", offers, "application/json"},
+		{"TEXT/Plain", offers, "text/plain"},
+		{"application/xml;q=0.9, text/plain", offers, "text/plain"},
+		{"application/xml, application/json", offers, "application/json"},
+		{"text/*;q=0.5, text/xml", offers, "text/xml"},
+		{"text/*, text/plain;q=0.2", offers, "text/xml"},
+		{"*/*;q=0.1, application/*;q=0.3, application/json;q=0", offers, "application/xml"},
+		{"image/png", offers, ""},
+		{"application/json;q=0", offers, ""},
+		{"json", offers, ""},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", withView, "text/html"},
+		{"*/*", withView, "application/json"},
+		{"text/html", offers, ""},
+		{"*/*", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateMediaType(tt.accept, tt.offers); got != tt.want {
+			t.Errorf("Accept %q = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// negotiated negotiates data for a request with the Accept header
+func negotiated(g *Gudu, accept string, data interface{}) (*httptest.ResponseRecorder, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	return w, g.ResponseFor(w, r).Negotiate(data, http.StatusOK)
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	g := testGudu(t)
+
+	w, err := negotiated(g, "image/png, application/json;q=0", testPerson{Name: "ada"})
+	if !errors.Is(err, ErrNotAcceptable) || w.Code != http.StatusNotAcceptable {
+		t.Fatalf("Negotiate = %d, %v, want 406 and ErrNotAcceptable", w.Code, err)
+	}
+	if body := w.Body.String(); !strings.HasSuffix(body, "available: application/json, application/xml, text/plain, text/xml") {
+		t.Errorf("body %q, want the available media types", body)
+	}
+	if w.Header().Get("Vary") != "Accept" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("headers %v", w.Header())
+	}
+
+	w, err = negotiated(g, "text/plain;q=0.5, application/json;q=0.1", testPerson{Name: "ada"})
+	if err != nil || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" || w.Body.String() != "{ada}" {
+		t.Errorf("text = %q %q, %v", w.Header().Get("Content-Type"), w.Body.String(), err)
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	g := testGudu(t)
+	g.Response = g.NewResponse()
+	g.Response.
+		RegisterEncoder("text/csv", func(data interface{}) ([]byte, error) {
+			return []byte("name\n" + data.(testPerson).Name + "\n"), nil
+		}).
+		RegisterEncoder(" Application/JSON ", func(data interface{}) ([]byte, error) {
+			return []byte(`{"person":"` + data.(testPerson).Name + `"}`), nil
+		})
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"text/csv", "text/csv; charset=utf-8", "name\nada\n"},
+		{"*/*", "application/json", `{"person":"ada"}`},
+		{"text/*", "text/plain; charset=utf-8", "{ada}"},
+		{"text/csv;q=0.9, application/xml;q=0.8", "text/csv; charset=utf-8", "name\nada\n"},
+	}
+	for _, tt := range tests {
+		w, err := negotiated(g, tt.accept, testPerson{Name: "ada"})
+		if err != nil || w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Errorf("Accept %q = %q %q, %v, want %q %q", tt.accept, w.Header().Get("Content-Type"), w.Body.String(), err,
+				tt.contentType, tt.body)
+		}
+	}
+
+	// replaced encoders keep their place, new ones are offered last
+	w, _ := negotiated(g, "image/png", testPerson{Name: "ada"})
+	if !strings.HasSuffix(w.Body.String(), "available: application/json, application/xml, text/plain, text/xml, text/csv") {
+		t.Errorf("406 body %q", w.Body.String())
+	}
+
+	errEncode := errors.New("unsupported value")
+	g.Response.RegisterEncoder("text/csv", func(data interface{}) ([]byte, error) {
+		return nil, errEncode
+	})
+	if w, err := negotiated(g, "text/csv", testPerson{Name: "ada"}); !errors.Is(err, errEncode) || w.Code != http.StatusInternalServerError {
+		t.Errorf("failing encoder = %d, %v", w.Code, err)
+	}
+}
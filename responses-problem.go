@@ -0,0 +1,293 @@
+package gudu
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// problem media types defined by RFC 7807
+const (
+	problemJSON = "application/problem+json"
+	problemXML  = "application/problem+xml"
+)
+
+// Problem is an RFC 7807 problem details object. Extensions holds additional members,
+// such as "errors" for validation failures; they are written next to the standard ones.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// Problemer is implemented by domain errors that describe themselves as a Problem
+type Problemer interface {
+	Problem() *Problem
+}
+
+// StatusCoder is implemented by errors carrying the HTTP status they map to
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// NewProblem creates a Problem for the status code, titled with its status text
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With sets an extension member of the problem
+func (p *Problem) With(key string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]interface{})
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+// clone returns a copy of the problem with its own extensions, so responses never
+// change a Problem the caller may share, such as a package level error
+func (p *Problem) clone() *Problem {
+	c := *p
+	if p.Extensions != nil {
+		c.Extensions = make(map[string]interface{}, len(p.Extensions))
+		for key, value := range p.Extensions {
+			c.Extensions[key] = value
+		}
+	}
+	return &c
+}
+
+// Error makes a Problem usable as an error, so handlers can return it directly
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return fmt.Sprintf("%s: %s", p.Title, p.Detail)
+	}
+	return p.Title
+}
+
+// MarshalJSON writes the standard members and the extensions as one flat object
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	if p.Type != "" {
+		members["type"] = p.Type
+	}
+	if p.Title != "" {
+		members["title"] = p.Title
+	}
+	if p.Status != 0 {
+		members["status"] = p.Status
+	}
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+	return json.Marshal(members)
+}
+
+// MarshalXML writes the problem in the urn:ietf:rfc:7807 namespace, extensions as
+// child elements named after their key
+func (p *Problem) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{
+		Name: xml.Name{Local: "problem"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "urn:ietf:rfc:7807"}},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	members := []struct {
+		name  string
+		value interface{}
+		empty bool
+	}{
+		{"type", p.Type, p.Type == ""},
+		{"title", p.Title, p.Title == ""},
+		{"status", p.Status, p.Status == 0},
+		{"detail", p.Detail, p.Detail == ""},
+		{"instance", p.Instance, p.Instance == ""},
+	}
+	for _, member := range members {
+		if member.empty {
+			continue
+		}
+		if err := e.EncodeElement(member.value, xml.StartElement{Name: xml.Name{Local: member.name}}); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(p.Extensions))
+	for key := range p.Extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := p.Extensions[key]
+		element := xml.StartElement{Name: xml.Name{Local: key}}
+		// encoding/xml cannot write maps, fall back to their text form
+		if _, ok := value.(xml.Marshaler); !ok && value != nil && reflect.TypeOf(value).Kind() == reflect.Map {
+			value = fmt.Sprint(value)
+		}
+		if err := e.EncodeElement(value, element); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// ProblemFromError maps an error to a Problem: a copy of a Problem or Problemer is used,
+// ValidationErrors become a 422 with an "errors" member, sql.ErrNoRows a 404 and a
+// StatusCoder its status. Anything else is a 500 whose detail is not exposed.
+func ProblemFromError(err error) *Problem {
+	var problem *Problem
+	var problemer Problemer
+	var validation ValidationErrors
+	var coder StatusCoder
+
+	switch {
+	case errors.As(err, &problem):
+		return problem.clone()
+	case errors.As(err, &problemer):
+		if problem := problemer.Problem(); problem != nil {
+			return problem.clone()
+		}
+	case errors.As(err, &validation):
+		return NewProblem(http.StatusUnprocessableEntity, "The given data was invalid.").With("errors", validation)
+	case errors.Is(err, sql.ErrNoRows):
+		return NewProblem(http.StatusNotFound, "")
+	case errors.As(err, &coder):
+		status := coder.StatusCode()
+		if status >= http.StatusInternalServerError {
+			return NewProblem(status, "")
+		}
+		return NewProblem(status, err.Error())
+	}
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// Problem sends the problem as application/problem+json, or as
+// application/problem+xml when the request prefers XML. In debug mode a stack trace
+// is added as the "stack" member. The defaults are filled in on a copy of p.
+func (r *Response) Problem(p *Problem) error {
+	p = p.clone()
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" && r.Request != nil {
+		p.Instance = r.Request.URL.Path
+	}
+	if r.Debug {
+		p.With("stack", strings.Split(strings.TrimSpace(string(debug.Stack())), "\n"))
+	}
+
+	mediaType, content, err := problemJSON, []byte(nil), error(nil)
+	if r.problemMediaType() == problemXML {
+		mediaType = problemXML
+		content, err = xml.Marshal(p)
+		if err == nil {
+			content = append([]byte(xml.Header), content...)
+		}
+	} else {
+		content, err = json.Marshal(p)
+	}
+	if err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	addVary(r.Writer.Header(), "Accept")
+	r.Header(contentType, mediaType)
+	if err := r.Send(content, p.Status); err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	return nil
+}
+
+// ProblemError sends the Problem an error maps to, see ProblemFromError. In debug mode
+// the error message is added as the "exception" member.
+func (r *Response) ProblemError(err error) error {
+	p := ProblemFromError(err)
+	if r.Debug && err != nil {
+		p.With("exception", err.Error())
+	}
+	return r.Problem(p)
+}
+
+// problemMediaType returns the problem format preferred by the request, or text/html
+// for clients such as browsers that prefer a page
+func (r *Response) problemMediaType() string {
+	accept := ""
+	if r.Request != nil {
+		accept = r.Request.Header.Get("Accept")
+	}
+	offers := []mediaEncoder{
+		{mediaType: problemJSON}, {mediaType: "application/json"},
+		{mediaType: problemXML}, {mediaType: "application/xml"},
+		{mediaType: "text/html"}, {mediaType: "text/plain"},
+	}
+	switch negotiateMediaType(accept, offers) {
+	case problemXML, "application/xml":
+		return problemXML
+	case "text/html", "text/plain":
+		return "text/html"
+	}
+	return problemJSON
+}
+
+// Error makes ValidationErrors usable as an error
+func (e ValidationErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "validation failed: " + strings.Join(fields, ", ")
+}
+
+// MarshalXML writes the validation errors as <error field="name">message</error> elements
+func (e ValidationErrors) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, message := range e[field] {
+			element := xml.StartElement{
+				Name: xml.Name{Local: "error"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "field"}, Value: field}},
+			}
+			if err := enc.EncodeElement(message, element); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
@@ -0,0 +1,37 @@
+package gudu
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// errPostNotFound is a problem shared by every request, as domain errors usually are
+var errPostNotFound = NewProblem(http.StatusNotFound, "The post does not exist.").With("code", "post_not_found")
+
+func TestProblemLeavesSharedProblemsUntouched(t *testing.T) {
+	g := testGudu(t)
+	g.Response = g.NewResponse()
+
+	for _, path := range []string{"/posts/1", "/posts/2"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		response := g.ResponseFor(w, r)
+		response.Debug = true
+		_ = response.ProblemError(fmt.Errorf("loading the post: %w", errPostNotFound))
+
+		if !strings.Contains(w.Body.String(), `"instance":"`+path+`"`) {
+			t.Errorf("%s: body %s", path, w.Body.String())
+		}
+	}
+
+	if errPostNotFound.Instance != "" || len(errPostNotFound.Extensions) != 1 {
+		t.Errorf("the shared problem was changed: instance %q, extensions %v",
+			errPostNotFound.Instance, errPostNotFound.Extensions)
+	}
+	if ProblemFromError(errPostNotFound) == errPostNotFound {
+		t.Error("ProblemFromError returns a copy of the problem")
+	}
+}
@@ -3,12 +3,17 @@ package gudu
 import (
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"io"
-	"mime/multipart"
+	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/deenikarim/gudu/render"
 )
 
 const contentType = "Content-Type"
@@ -17,13 +22,48 @@ const contentType = "Content-Type"
 type Response struct {
 	Writer  http.ResponseWriter
 	Headers http.Header
+	// ETagMode enables ETag generation for JSON, XML and HTML responses: ETagStrong,
+	// ETagWeak or ETagOff
+	ETagMode string
+	// Request is the current request of a Response made by Gudu.ResponseFor, read by
+	// Negotiate, File and the problem responses; the shared g.Response has none
+	Request *http.Request
+	// Renderer renders the views of negotiated HTML responses
+	Renderer *render.Render
+	// Debug adds stack traces and error messages to problem responses
+	Debug bool
+
+	encodersMu sync.RWMutex
+	encoders   []mediaEncoder
 }
 
 // NewResponse Initializes a new Response object.
 func (g *Gudu) NewResponse() *Response {
 	return &Response{
-		Headers: make(http.Header),
+		Headers:  make(http.Header),
+		encoders: defaultEncoders(),
+	}
+}
+
+// ResponseFor returns a Response bound to the writer and request of one request,
+// with the settings and encoders of g.Response. Use it rather than g.Response in
+// handlers that negotiate or serve files, g.Response is shared by every request.
+func (g *Gudu) ResponseFor(w http.ResponseWriter, r *http.Request) *Response {
+	resp := &Response{
+		Writer:   w,
+		Headers:  make(http.Header),
+		Request:  r,
+		Debug:    g.DebugMode,
+		encoders: defaultEncoders(),
+	}
+	if g.Response != nil {
+		resp.ETagMode = g.Response.ETagMode
+		resp.Renderer = g.Response.Renderer
+		g.Response.encodersMu.RLock()
+		resp.encoders = append([]mediaEncoder(nil), g.Response.encoders...)
+		g.Response.encodersMu.RUnlock()
 	}
+	return resp
 }
 
 // WriteJSON sets the content type to JSON, marshals the data,
@@ -114,6 +154,7 @@ func (r *Response) JSON(data interface{}, statusCode int) error {
 
 	// calling the header method here to add a single header
 	r.Header(contentType, "application/json")
+	r.setETag(content, statusCode)
 
 	// Send the JSON content with the given status code
 	if err := r.Send(content, statusCode); err != nil {
@@ -136,6 +177,7 @@ func (r *Response) XML(data interface{}, statusCode int) error {
 
 	// calling the header method here to add a single header
 	r.Header(contentType, "application/xml")
+	r.setETag(content, statusCode)
 
 	// Send the XML content with the given status code
 	if err := r.Send(content, statusCode); err != nil {
@@ -149,6 +191,7 @@ func (r *Response) XML(data interface{}, statusCode int) error {
 // HTML method sets the content type to HTML and sends the response
 func (r *Response) HTML(content string, status int) error {
 	r.Header(contentType, "text/html")
+	r.setETag([]byte(content), status)
 	if err := r.Send([]byte(content), status); err != nil {
 		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
 		return err
@@ -190,6 +233,9 @@ func (r *Response) RedirectTemporary(url string) error {
 }
 
 // SetCORS sets CORS(Cross-Origin Resource Sharing)headers to allow all origins
+//
+// Deprecated: use the Gudu.CORS middleware, which also answers preflight requests
+// and sets the Vary header.
 func (r *Response) SetCORS() *Response {
 	r.Header("Access-Control-Allow-Origin", "*")
 	r.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -198,6 +244,8 @@ func (r *Response) SetCORS() *Response {
 }
 
 // SetCORSWithOrigin sets CORS(Cross-Origin Resource Sharing)headers to allow a specific origin
+//
+// Deprecated: use the Gudu.CORS middleware with CORSOptions.AllowedOrigins.
 func (r *Response) SetCORSWithOrigin(origin string) *Response {
 	r.Header("Access-Control-Allow-Origin", origin)
 	r.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -256,58 +304,93 @@ func (r *Response) StreamDownload(callBack func(writer io.Writer), fileName stri
 	return nil
 }
 
-// File method sets headers for displaying a file in the browser
-// and streams it to the client
+// StreamDownloadSeeker streams content to the client as a download. Unlike
+// StreamDownload the size is known, so Content-Length, byte ranges for resumed
+// downloads, If-Range and the conditional headers of rr derived from modTime are
+// supported; a zero modTime disables Last-Modified.
+func (r *Response) StreamDownloadSeeker(content io.ReadSeeker, fileName string, modTime time.Time, headers map[string]string, rr *http.Request) error {
+	r.Writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+
+	for key, value := range headers {
+		r.Writer.Header().Set(key, value)
+	}
+
+	http.ServeContent(r.Writer, rr, fileName, modTime, content)
+	return nil
+}
+
+// File method sets headers for displaying a file in the browser and serves it to the
+// client with byte range support, so media can be seeked and downloads resumed. The
+// Content-Type is derived from the extension or sniffed from the content, and the
+// Last-Modified and ETag headers answer conditional and If-Range requests, which needs
+// a Response made by Gudu.ResponseFor.
 func (r *Response) File(fileRoad, fileName string, headers map[string]string) error {
 	filePath := path.Join(fileRoad, fileName)
 	fileToShow := filepath.Clean(filePath)
 
 	file, err := os.Open(fileToShow)
 	if err != nil {
-		http.Error(r.Writer, "file not found", http.StatusInternalServerError)
+		http.Error(r.Writer, "file not found", http.StatusNotFound)
 		return err
 	}
 	defer func(file *os.File) {
 		_ = file.Close()
 	}(file)
 
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	if info.IsDir() {
+		http.Error(r.Writer, "file not found", http.StatusNotFound)
+		return fmt.Errorf("%s is a directory", fileToShow)
+	}
+
 	for key, value := range headers {
 		r.Writer.Header().Set(key, value)
 	}
+	if r.Writer.Header().Get("ETag") == "" {
+		r.Writer.Header().Set("ETag", fileETag(info))
+	}
 
-	r.Writer.WriteHeader(http.StatusOK)
+	http.ServeContent(r.Writer, r.currentRequest(), info.Name(), info.ModTime(), file)
+	return nil
+}
 
-	if _, err := io.Copy(r.Writer, file); err != nil {
-		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
-		return err
+// currentRequest returns the request of a Response made by Gudu.ResponseFor, or a plain
+// GET without conditional or range headers
+func (r *Response) currentRequest() *http.Request {
+	if r.Request != nil {
+		return r.Request
 	}
-	return nil
+	return &http.Request{Method: http.MethodGet, Header: make(http.Header)}
 }
 
-// HandleFileUpload handles file uploads and saves them to the specified directory
+// fileETag derives a strong ETag from the size and modification time of a file,
+// avoiding a read of the whole file
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// HandleFileUpload handles file uploads and saves them to the specified directory.
+// The file is stored under a generated name, the client supplied name is never used
+// as a path.
+//
+// Deprecated: use Gudu.Upload, which accepts several files per field and enforces
+// size and type limits.
 func (r *Response) HandleFileUpload(fieldName, uploadDir string, req *http.Request) (string, error) {
-	file, fileHeader, err := req.FormFile(fieldName)
+	_, fileHeader, err := req.FormFile(fieldName)
 	if err != nil {
 		return "", err
 	}
-	defer func(file multipart.File) {
-		_ = file.Close()
-	}(file)
 
-	filePath := filepath.Join(uploadDir, fileHeader.Filename)
-	outFile, err := os.Create(filePath)
+	file, err := saveUpload(fileHeader, fieldName, UploadOptions{Dir: uploadDir})
 	if err != nil {
-		return "", err
-	}
-	defer func(outFile *os.File) {
-		_ = outFile.Close()
-	}(outFile)
-
-	if _, err := io.Copy(outFile, file); err != nil {
 		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
 		return "", err
 	}
-	return filePath, nil
+	return file.Path, nil
 }
 
 // =================== error response =================
@@ -328,6 +411,11 @@ func (r *Response) ErrorForbidden() {
 	r.errorStatus(http.StatusForbidden)
 }
 
+// errorStatus sends an RFC 7807 problem, or plain text to clients preferring HTML
 func (r *Response) errorStatus(status int) {
-	http.Error(r.Writer, http.StatusText(status), status)
+	if r.problemMediaType() == "text/html" {
+		http.Error(r.Writer, http.StatusText(status), status)
+		return
+	}
+	_ = r.Problem(NewProblem(status, ""))
 }
@@ -0,0 +1,65 @@
+package gudu
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseForServesRanges(t *testing.T) {
+	g := testGudu(t)
+	g.Response = g.NewResponse()
+	if err := os.WriteFile(filepath.Join(g.RootPath, "video.txt"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/video", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+	if err := g.ResponseFor(w, r).File(g.RootPath, "video.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("File = %d %q, want 206 \"234\"", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	err := g.ResponseFor(w, r).StreamDownloadSeeker(strings.NewReader("0123456789"), "data.txt", time.Time{}, nil, r)
+	if err != nil || w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("StreamDownloadSeeker = %d %q, %v", w.Code, w.Body.String(), err)
+	}
+}
+
+// testPerson is negotiated as JSON and XML
+type testPerson struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func TestResponseForNegotiatesPerRequest(t *testing.T) {
+	g := testGudu(t)
+	g.Response = g.NewResponse()
+	g.Response.RegisterEncoder("text/csv", func(data interface{}) ([]byte, error) {
+		return []byte("name\nada\n"), nil
+	})
+
+	negotiate := func(accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		_ = g.ResponseFor(w, r).Negotiate(testPerson{Name: "ada"}, http.StatusOK)
+		return w
+	}
+	if w := negotiate("text/csv"); w.Body.String() != "name\nada\n" {
+		t.Errorf("csv = %q, the encoders of g.Response are used", w.Body.String())
+	}
+	if w := negotiate("application/xml, application/json;q=0.5"); !strings.HasPrefix(w.Header().Get("Content-Type"), "application/xml") {
+		t.Errorf("content type = %q", w.Header().Get("Content-Type"))
+	}
+	if g.Response.Request != nil {
+		t.Error("the shared response keeps no request")
+	}
+}
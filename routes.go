@@ -0,0 +1,282 @@
+package gudu
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes is a thin layer over a chi router adding route names, prefixed groups with
+// shared middleware and reverse URL generation through Gudu.URL
+type Routes struct {
+	mux      chi.Router
+	prefix   string
+	registry *routeRegistry
+}
+
+// Route is a registered route that can be given a name
+type Route struct {
+	method   string
+	pattern  string
+	registry *routeRegistry
+}
+
+// routeRegistry holds the named routes shared by a router and all its groups
+type routeRegistry struct {
+	mu     sync.RWMutex
+	routes map[string]string
+	errs   []error
+}
+
+// routeParamPattern matches a chi url parameter such as {id} or {id:[0-9]+}
+var routeParamPattern = regexp.MustCompile(`\{([^{}:]+)(?::((?:[^{}]|\{[^{}]*\})+))?\}`)
+
+// NewRoutes wraps a chi router with route naming
+func NewRoutes(mux chi.Router) *Routes {
+	return &Routes{
+		mux:      mux,
+		registry: &routeRegistry{routes: make(map[string]string)},
+	}
+}
+
+// Mux returns the underlying chi router
+func (rt *Routes) Mux() chi.Router {
+	return rt.mux
+}
+
+// Use appends middlewares to the router or group
+func (rt *Routes) Use(middlewares ...func(http.Handler) http.Handler) {
+	rt.mux.Use(middlewares...)
+}
+
+// With returns a router applying the extra middlewares to the routes registered on it
+func (rt *Routes) With(middlewares ...func(http.Handler) http.Handler) *Routes {
+	return &Routes{mux: rt.mux.With(middlewares...), prefix: rt.prefix, registry: rt.registry}
+}
+
+// Group registers routes sharing middleware, without adding a path prefix
+func (rt *Routes) Group(fn func(r *Routes)) {
+	rt.mux.Group(func(r chi.Router) {
+		fn(&Routes{mux: r, prefix: rt.prefix, registry: rt.registry})
+	})
+}
+
+// Route registers routes below a path prefix
+func (rt *Routes) Route(prefix string, fn func(r *Routes)) {
+	rt.mux.Route(prefix, func(r chi.Router) {
+		fn(&Routes{mux: r, prefix: joinRoutePattern(rt.prefix, prefix), registry: rt.registry})
+	})
+}
+
+// Mount attaches another handler or router below a path prefix
+func (rt *Routes) Mount(prefix string, handler http.Handler) {
+	rt.mux.Mount(prefix, handler)
+}
+
+// Handle registers a handler for all methods
+func (rt *Routes) Handle(pattern string, handler http.Handler) *Route {
+	rt.mux.Handle(pattern, handler)
+	return rt.route("*", pattern)
+}
+
+// Method registers a handler for the given method
+func (rt *Routes) Method(method, pattern string, handler http.Handler) *Route {
+	rt.mux.Method(method, pattern, handler)
+	return rt.route(method, pattern)
+}
+
+// Get registers a GET handler
+func (rt *Routes) Get(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodGet, pattern, handlerFn)
+}
+
+// Post registers a POST handler
+func (rt *Routes) Post(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodPost, pattern, handlerFn)
+}
+
+// Put registers a PUT handler
+func (rt *Routes) Put(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodPut, pattern, handlerFn)
+}
+
+// Patch registers a PATCH handler
+func (rt *Routes) Patch(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodPatch, pattern, handlerFn)
+}
+
+// Delete registers a DELETE handler
+func (rt *Routes) Delete(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodDelete, pattern, handlerFn)
+}
+
+// Options registers an OPTIONS handler
+func (rt *Routes) Options(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodOptions, pattern, handlerFn)
+}
+
+// Head registers a HEAD handler
+func (rt *Routes) Head(pattern string, handlerFn http.HandlerFunc) *Route {
+	return rt.Method(http.MethodHead, pattern, handlerFn)
+}
+
+// route creates the Route for a freshly registered pattern
+func (rt *Routes) route(method, pattern string) *Route {
+	return &Route{method: method, pattern: joinRoutePattern(rt.prefix, pattern), registry: rt.registry}
+}
+
+// Name gives the route a name used to build its URL; registering the same name twice
+// is recorded as an error reported by Routes.Validate
+func (r *Route) Name(name string) *Route {
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+
+	if existing, ok := r.registry.routes[name]; ok {
+		r.registry.errs = append(r.registry.errs,
+			fmt.Errorf("duplicate route name %q for %s %s, already used by %s", name, r.method, r.pattern, existing))
+		return r
+	}
+	r.registry.routes[name] = r.pattern
+	return r
+}
+
+// Pattern returns the full path pattern of the route, including group prefixes
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+// Validate reports configuration errors such as duplicate route names
+func (rt *Routes) Validate() error {
+	rt.registry.mu.RLock()
+	defer rt.registry.mu.RUnlock()
+	return errors.Join(rt.registry.errs...)
+}
+
+// Named returns the named routes and their patterns
+func (rt *Routes) Named() map[string]string {
+	rt.registry.mu.RLock()
+	defer rt.registry.mu.RUnlock()
+
+	named := make(map[string]string, len(rt.registry.routes))
+	for name, pattern := range rt.registry.routes {
+		named[name] = pattern
+	}
+	return named
+}
+
+// URL builds the path of a named route. Params fill the {placeholders} of the pattern,
+// escaped and checked against their regular expression; the remaining params are
+// added as the query string.
+func (rt *Routes) URL(name string, params map[string]interface{}) (string, error) {
+	rt.registry.mu.RLock()
+	pattern, ok := rt.registry.routes[name]
+	rt.registry.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("route %q is not defined", name)
+	}
+
+	used := make(map[string]bool)
+	var buildErr error
+
+	path := routeParamPattern.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		parts := routeParamPattern.FindStringSubmatch(placeholder)
+		key, expr := parts[1], parts[2]
+
+		value, ok := params[key]
+		if !ok {
+			buildErr = errors.Join(buildErr, fmt.Errorf("route %q requires parameter %q", name, key))
+			return placeholder
+		}
+		used[key] = true
+		str := fmt.Sprint(value)
+
+		if expr != "" {
+			if re, err := regexp.Compile("^(?:" + expr + ")$"); err == nil && !re.MatchString(str) {
+				buildErr = errors.Join(buildErr, fmt.Errorf("route %q parameter %q value %q does not match %s", name, key, str, expr))
+			}
+		}
+		return url.PathEscape(str)
+	})
+
+	// a trailing wildcard takes the "*" param, keeping its slashes
+	if strings.HasSuffix(path, "*") {
+		rest := ""
+		if value, ok := params["*"]; ok {
+			used["*"] = true
+			segments := strings.Split(strings.TrimPrefix(fmt.Sprint(value), "/"), "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			rest = strings.Join(segments, "/")
+		}
+		path = strings.TrimSuffix(path, "*") + rest
+	}
+
+	if buildErr != nil {
+		return "", buildErr
+	}
+
+	query := url.Values{}
+	for key, value := range params {
+		if used[key] {
+			continue
+		}
+		switch v := value.(type) {
+		case []string:
+			query[key] = v
+		default:
+			query.Set(key, fmt.Sprint(v))
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	return path, nil
+}
+
+// joinRoutePattern joins a group prefix and a route pattern
+func joinRoutePattern(prefix, pattern string) string {
+	if prefix == "" {
+		return pattern
+	}
+	joined := strings.TrimSuffix(prefix, "/*") + "/" + strings.TrimPrefix(pattern, "/")
+	if pattern == "/" || pattern == "" {
+		joined = strings.TrimSuffix(joined, "/")
+		if joined == "" {
+			joined = "/"
+		}
+	}
+	return joined
+}
+
+// URL builds the path of a named route, see Routes.URL
+func (g *Gudu) URL(name string, params ...map[string]interface{}) (string, error) {
+	if g.Routes == nil {
+		return "", errors.New("named routes are not initialized")
+	}
+	var p map[string]interface{}
+	if len(params) > 0 {
+		p = params[0]
+	}
+	return g.Routes.URL(name, p)
+}
+
+// routeFunc is the route template function: {{ route "users.show" "id" .User.ID }} in Go
+// templates and {{ route("users.show", "id", user.ID) }} in Jet
+func (g *Gudu) routeFunc(name string, pairs ...interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("route %q needs parameter name and value pairs", name)
+	}
+	params := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		params[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return g.URL(name, params)
+}
@@ -0,0 +1,104 @@
+package gudu
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// testRoutes registers named routes echoing their url parameters
+func testRoutes() *Routes {
+	routes := NewRoutes(chi.NewRouter())
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		params := chi.RouteContext(r.Context()).URLParams
+		_, _ = w.Write([]byte(strings.Join(params.Values, "|")))
+	}
+	routes.Get("/", echo).Name("home")
+	routes.Route("/users", func(r *Routes) {
+		r.Get("/{id:[0-9]+}", echo).Name("users.show")
+		r.Get("/{id:[0-9]+}/posts/{slug}", echo).Name("users.posts")
+	})
+	routes.Get("/archive/{date:\\d{4}-\\d{2}}", echo).Name("archive")
+	routes.Get("/files/*", echo).Name("files")
+	return routes
+}
+
+func TestRoutesURL(t *testing.T) {
+	routes := testRoutes()
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"home", nil, "/"},
+		{"users.show", map[string]interface{}{"id": 7}, "/users/7"},
+		{"users.posts", map[string]interface{}{"id": "7", "slug": "hello world/ä?"}, "/users/7/posts/hello%20world%2F%C3%A4%3F"},
+		{"users.show", map[string]interface{}{"id": 7, "tab": "likes", "tag": []string{"go", "web"}}, "/users/7?tab=likes&tag=go&tag=web"},
+		{"archive", map[string]interface{}{"date": "2024-05"}, "/archive/2024-05"},
+		{"files", map[string]interface{}{"*": "/reports/2024 q1.pdf"}, "/files/reports/2024%20q1.pdf"},
+		{"files", nil, "/files/"},
+	}
+	for _, tt := range tests {
+		got, err := routes.URL(tt.name, tt.params)
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%s, %v) = %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+}
+
+func TestRoutesURLRoundTrips(t *testing.T) {
+	routes := testRoutes()
+	for name, params := range map[string]map[string]interface{}{
+		"users.posts": {"id": 7, "slug": "hello world/ä?"},
+		"files":       {"*": "reports/2024 q1.pdf"},
+	} {
+		target, err := routes.URL(name, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		routes.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: %s = %d", name, target, w.Code)
+		}
+	}
+}
+
+func TestRoutesURLErrors(t *testing.T) {
+	routes := testRoutes()
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"missing", nil, `route "missing" is not defined`},
+		{"users.show", nil, `requires parameter "id"`},
+		{"users.posts", map[string]interface{}{"id": 7}, `requires parameter "slug"`},
+		{"users.show", map[string]interface{}{"id": "seven"}, `parameter "id" value "seven" does not match`},
+		{"users.show", map[string]interface{}{"id": "7/../admin"}, "does not match"},
+		{"archive", map[string]interface{}{"date": "2024-5"}, "does not match"},
+	}
+	for _, tt := range tests {
+		got, err := routes.URL(tt.name, tt.params)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("URL(%s, %v) = %q, %v, want an error containing %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+
+	g := testGudu(t)
+	if _, err := g.URL("home"); err == nil {
+		t.Error("Gudu.URL without routes succeeded")
+	}
+	g.Routes = routes
+	if got, err := g.routeFunc("users.show", "id", 7); err != nil || got != "/users/7" {
+		t.Errorf("route function = %q, %v", got, err)
+	}
+	if _, err := g.routeFunc("users.show", "id"); err == nil {
+		t.Error("the route function accepted an odd number of arguments")
+	}
+}
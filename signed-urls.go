@@ -0,0 +1,166 @@
+package gudu
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	// ErrInvalidSignature is returned for URLs without a valid signature
+	ErrInvalidSignature = errors.New("invalid url signature")
+	// ErrSignatureExpired is returned for signed URLs past their expiry
+	ErrSignatureExpired = errors.New("signed url has expired")
+)
+
+// query parameters added by SignedURL
+const (
+	signatureParam = "signature"
+	expiresParam   = "expires"
+)
+
+// SignedURL returns the path, or absolute URL, with the params, an expiry and an HMAC
+// signature made with the application KEY, e.g. for download, unsubscribe or
+// confirmation links sent by mail. A ttl of zero never expires. The signature covers
+// the path and query only, so links stay valid behind proxies and on other hosts.
+func (g *Gudu) SignedURL(rawURL string, params url.Values, ttl time.Duration) (string, error) {
+	keys := g.signingKeys()
+	if len(keys) == 0 {
+		return "", errors.New("signed urls need the KEY environment variable")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Del(signatureParam)
+	query.Del(expiresParam)
+	if ttl != 0 {
+		query.Set(expiresParam, strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	}
+	query.Set(signatureParam, urlSignature(keys[0], u.EscapedPath(), query))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// VerifySignedURL checks the signature and expiry of a URL made by SignedURL,
+// accepting signatures of the current and the previous keys (PREVIOUS_KEYS)
+func (g *Gudu) VerifySignedURL(u *url.URL) error {
+	query := u.Query()
+	signature := query.Get(signatureParam)
+	if signature == "" {
+		return ErrInvalidSignature
+	}
+
+	valid := false
+	for _, key := range g.signingKeys() {
+		if hmac.Equal([]byte(signature), []byte(urlSignature(key, u.EscapedPath(), query))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	if expires := query.Get(expiresParam); expires != "" {
+		expiresAt, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		if time.Now().Unix() > expiresAt {
+			return ErrSignatureExpired
+		}
+	}
+	return nil
+}
+
+// ValidateSignature middleware rejects requests whose URL is not signed by SignedURL
+// or has expired with 403 Forbidden
+func (g *Gudu) ValidateSignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := g.VerifySignedURL(r.URL); err != nil {
+			g.HandleError(w, r, signatureProblem(err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// signatureProblem maps the errors of VerifySignedURL to 403 problems
+func signatureProblem(err error) error {
+	if errors.Is(err, ErrSignatureExpired) {
+		return NewProblem(http.StatusForbidden, "This link has expired.")
+	}
+	return NewProblem(http.StatusForbidden, "This link is invalid.")
+}
+
+// SignedDownloads returns a handler serving the files of dir as downloads through
+// signed links. Mount it on a wildcard route and link to its files with SignedURL:
+//
+//	g.Router.Handle("/downloads/*", g.SignedDownloads("storage/private"))
+//	link, err := g.SignedURL("/downloads/reports/2024.pdf", nil, time.Hour)
+//
+// Relative folders are below the application root.
+func (g *Gudu) SignedDownloads(dir string) http.Handler {
+	if !filepath.IsAbs(dir) && g.RootPath != "" {
+		dir = filepath.Join(g.RootPath, dir)
+	}
+	return g.ValidateSignature(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// clean the path as if rooted, so it can not leave dir
+		fileName := strings.TrimPrefix(path.Clean("/"+chi.URLParam(r, "*")), "/")
+		if fileName == "" {
+			g.HandleError(w, r, NewProblem(http.StatusNotFound, ""))
+			return
+		}
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(fileName)))
+		if err != nil || info.IsDir() {
+			g.HandleError(w, r, NewProblem(http.StatusNotFound, ""))
+			return
+		}
+
+		resp := g.ResponseFor(w, r)
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		_ = resp.DownloadFile(filepath.Join(dir, filepath.FromSlash(path.Dir(fileName))), path.Base(fileName), r)
+	}))
+}
+
+// signingKeys returns the keys signed URLs are verified with, the current KEY first
+func (g *Gudu) signingKeys() []string {
+	var keys []string
+	if g.EncryptionKey != "" {
+		keys = append(keys, g.EncryptionKey)
+	}
+	return append(keys, g.PreviousKeys...)
+}
+
+// urlSignature signs the path and the query without its signature. The key is derived
+// from KEY, so signatures never reveal anything about the encryption key.
+func urlSignature(key, escapedPath string, query url.Values) string {
+	unsigned := url.Values{}
+	for name, values := range query {
+		if name != signatureParam {
+			unsigned[name] = values
+		}
+	}
+
+	mac := hmac.New(sha256.New, deriveKey(key, "gudu signed url"))
+	mac.Write([]byte(escapedPath + "?" + unsigned.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
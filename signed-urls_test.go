@@ -0,0 +1,139 @@
+package gudu
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// verify parses and verifies a signed URL
+func verify(t *testing.T, g *Gudu, signed string) error {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g.VerifySignedURL(u)
+}
+
+func TestSignedURLRejectsTampering(t *testing.T) {
+	g := testGudu(t)
+	g.EncryptionKey = testKey
+
+	signed, err := g.SignedURL("https://app.example/unsubscribe?list=news", url.Values{"user": {"7"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(t, g, signed); err != nil {
+		t.Fatalf("%s: %v", signed, err)
+	}
+	// the signature covers the path and query, not the host
+	if err := verify(t, g, strings.Replace(signed, "app.example", "other.example", 1)); err != nil {
+		t.Errorf("another host: %v", err)
+	}
+
+	tampered := map[string]string{
+		"user":      strings.Replace(signed, "user=7", "user=8", 1),
+		"path":      strings.Replace(signed, "/unsubscribe", "/delete", 1),
+		"added":     signed + "&admin=1",
+		"expiry":    strings.Replace(signed, "expires=", "expires=9", 1),
+		"signature": strings.Replace(signed, "signature=", "signature=x", 1),
+		"unsigned":  "https://app.example/unsubscribe?list=news&user=7",
+	}
+	for name, target := range tampered {
+		if err := verify(t, g, target); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: %v, want ErrInvalidSignature", name, err)
+		}
+	}
+}
+
+func TestSignedURLExpiry(t *testing.T) {
+	g := testGudu(t)
+	g.EncryptionKey = testKey
+
+	expired, _ := g.SignedURL("/confirm", nil, -time.Second)
+	if err := verify(t, g, expired); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("expired: %v, want ErrSignatureExpired", err)
+	}
+	forever, _ := g.SignedURL("/confirm", nil, 0)
+	if strings.Contains(forever, "expires=") || verify(t, g, forever) != nil {
+		t.Errorf("a ttl of zero never expires: %s", forever)
+	}
+}
+
+func TestSignedURLPreviousKeys(t *testing.T) {
+	g := testGudu(t)
+	g.EncryptionKey = previousKey
+	signed, _ := g.SignedURL("/confirm", nil, time.Hour)
+
+	g.EncryptionKey, g.PreviousKeys = testKey, []string{previousKey}
+	if err := verify(t, g, signed); err != nil {
+		t.Errorf("signed with a previous key: %v", err)
+	}
+	g.PreviousKeys = nil
+	if err := verify(t, g, signed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("signed with a retired key: %v, want ErrInvalidSignature", err)
+	}
+
+	g.EncryptionKey = ""
+	if _, err := g.SignedURL("/confirm", nil, time.Hour); err == nil {
+		t.Error("signed urls need a key")
+	}
+}
+
+func TestSignedDownloads(t *testing.T) {
+	g := testGudu(t)
+	g.EncryptionKey = testKey
+	dir := filepath.Join(g.RootPath, "private")
+	if err := os.MkdirAll(filepath.Join(dir, "reports"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "reports", "2024.pdf"), []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(g.RootPath, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := chi.NewRouter()
+	mux.Handle("/downloads/*", g.SignedDownloads("private"))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	link, _ := g.SignedURL("/downloads/reports/2024.pdf", nil, time.Hour)
+	w := get(link)
+	if w.Code != http.StatusOK || w.Body.String() != "report" {
+		t.Fatalf("%s = %d %q", link, w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") || w.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+
+	if w := get("/downloads/reports/2024.pdf"); w.Code != http.StatusForbidden {
+		t.Errorf("unsigned = %d, want 403", w.Code)
+	}
+	expired, _ := g.SignedURL("/downloads/reports/2024.pdf", nil, -time.Second)
+	if w := get(expired); w.Code != http.StatusForbidden {
+		t.Errorf("expired = %d, want 403", w.Code)
+	}
+	// a signed link can not reach files outside the folder
+	escape, _ := g.SignedURL("/downloads/%2e%2e/secret.txt", nil, time.Hour)
+	if w := get(escape); w.Code != http.StatusNotFound && w.Code != http.StatusForbidden {
+		t.Errorf("%s served a file outside the folder: %q", escape, w.Body.String())
+	}
+	missing, _ := g.SignedURL("/downloads/reports/2023.pdf", nil, time.Hour)
+	if w := get(missing); w.Code != http.StatusNotFound {
+		t.Errorf("missing = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package gudu
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/deenikarim/gudu/assets"
+)
+
+// staticConfig holds where the public directory lives and the URL it is served from
+type staticConfig struct {
+	url    string
+	dir    string
+	maxAge int
+}
+
+// loadStaticConfig reads the static file settings from the environment
+func loadStaticConfig() staticConfig {
+	maxAge, err := strconv.Atoi(os.Getenv("STATIC_MAX_AGE"))
+	if err != nil {
+		maxAge = 3600
+	}
+	return staticConfig{
+		url:    strings.TrimRight(getEnvOrDefault("STATIC_URL", "/public"), "/"),
+		dir:    getEnvOrDefault("STATIC_DIR", "public"),
+		maxAge: maxAge,
+	}
+}
+
+// staticRoot returns the absolute path of the public directory
+func (g *Gudu) staticRoot() string {
+	if filepath.IsAbs(g.config.static.dir) {
+		return g.config.static.dir
+	}
+	return filepath.Join(g.RootPath, g.config.static.dir)
+}
+
+// loadAssetManifest loads the manifest written by "gudu assets build"; in debug mode
+// it is re-read whenever it changes
+func (g *Gudu) loadAssetManifest() error {
+	manifestPath := filepath.Join(g.staticRoot(), "build", assets.ManifestFile)
+	manifest, err := assets.NewManifest(manifestPath, g.config.static.url, g.DebugMode)
+	if err != nil {
+		return err
+	}
+	g.Assets = manifest
+	return nil
+}
+
+// Asset returns the public URL of an asset such as "css/app.css", resolved to its
+// fingerprinted file through the asset manifest when it has been built
+func (g *Gudu) Asset(name string) string {
+	if g.Assets == nil {
+		return g.config.static.url + "/" + strings.TrimPrefix(path.Clean("/"+name), "/")
+	}
+	return g.Assets.URL(name)
+}
+
+// StaticHandler serves the public directory. Fingerprinted files are sent with
+// far-future immutable cache headers, other files with STATIC_MAX_AGE, and gzip
+// precompressed siblings are used when present. Directory listings are not served.
+func (g *Gudu) StaticHandler() http.Handler {
+	root := g.staticRoot()
+	files := g.PrecompressedFileServer(root)
+
+	return http.StripPrefix(g.config.static.url, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch {
+		case assets.IsFingerprinted(name):
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		case g.DebugMode:
+			w.Header().Set("Cache-Control", "no-cache")
+		default:
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(g.config.static.maxAge))
+		}
+
+		files.ServeHTTP(w, r)
+	}))
+}
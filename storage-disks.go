@@ -0,0 +1,202 @@
+package gudu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deenikarim/gudu/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// storageConfig holds the named disks and the default disk name
+type storageConfig struct {
+	defaultDisk string
+	disks       map[string]storage.Config
+}
+
+// loadStorageConfig reads the disks listed in STORAGE_DISKS, each configured by
+// STORAGE_{NAME}_DRIVER, _ROOT, _URL, _ENDPOINT, _REGION, _BUCKET, _KEY, _SECRET and
+// _PATH_STYLE. The local disk is private, its files are served through temporary URLs
+// below /files by TemporaryFiles; the public disk is served from the public folder.
+func loadStorageConfig() storageConfig {
+	names := splitEnvList("STORAGE_DISKS")
+	if len(names) == 0 {
+		names = []string{"local", "public"}
+	}
+	defaults := map[string]storage.Config{
+		"local":  {Driver: "local", Root: "storage/app", URL: "/files"},
+		"public": {Driver: "local", Root: "public/storage", URL: "/public/storage"},
+	}
+
+	config := storageConfig{
+		defaultDisk: getEnvOrDefault("STORAGE_DISK", names[0]),
+		disks:       make(map[string]storage.Config, len(names)),
+	}
+	for _, name := range names {
+		prefix := "STORAGE_" + strings.ToUpper(name) + "_"
+		disk := defaults[name]
+		pathStyle, _ := strconv.ParseBool(os.Getenv(prefix + "PATH_STYLE"))
+
+		config.disks[name] = storage.Config{
+			Driver:    getEnvOrDefault(prefix+"DRIVER", disk.Driver),
+			Root:      getEnvOrDefault(prefix+"ROOT", disk.Root),
+			URL:       getEnvOrDefault(prefix+"URL", disk.URL),
+			Endpoint:  os.Getenv(prefix + "ENDPOINT"),
+			Region:    os.Getenv(prefix + "REGION"),
+			Bucket:    os.Getenv(prefix + "BUCKET"),
+			AccessKey: os.Getenv(prefix + "KEY"),
+			SecretKey: os.Getenv(prefix + "SECRET"),
+			PathStyle: pathStyle,
+		}
+	}
+	return config
+}
+
+// createDisks creates the configured disks, local roots relative to the application
+// root; temporary URLs of local disks are signed URLs, see SignedURL
+func (g *Gudu) createDisks() error {
+	g.Disks = make(map[string]storage.Disk, len(g.config.storage.disks))
+	for name, config := range g.config.storage.disks {
+		if config.Root != "" && !filepath.IsAbs(config.Root) {
+			config.Root = filepath.Join(g.RootPath, config.Root)
+		}
+		if config.Signer == nil {
+			config.Signer = g.signDiskURL
+		}
+		disk, err := storage.New(config)
+		if err != nil {
+			return fmt.Errorf("disk %s: %w", name, err)
+		}
+		g.Disks[name] = disk
+	}
+	return nil
+}
+
+// Disk returns the named disk, or the default disk (STORAGE_DISK) without a name; it
+// is nil when no such disk is configured
+func (g *Gudu) Disk(name ...string) storage.Disk {
+	diskName := g.config.storage.defaultDisk
+	if len(name) > 0 && name[0] != "" {
+		diskName = name[0]
+	}
+	return g.Disks[diskName]
+}
+
+// DiskFile serves a file of a disk for display in the browser. Files of local and
+// memory disks support byte ranges and conditional requests like File.
+func (r *Response) DiskFile(disk storage.Disk, filePath string, headers map[string]string) error {
+	return r.serveDiskFile(disk, filePath, "", headers)
+}
+
+// DiskDownload serves a file of a disk as a download named fileName, by default the
+// base name of the path
+func (r *Response) DiskDownload(disk storage.Disk, filePath, fileName string, headers map[string]string) error {
+	if fileName == "" {
+		fileName = path.Base(filePath)
+	}
+	return r.serveDiskFile(disk, filePath, fileName, headers)
+}
+
+// serveDiskFile streams a disk file, as an attachment when fileName is set
+func (r *Response) serveDiskFile(disk storage.Disk, filePath, fileName string, headers map[string]string) error {
+	info, err := disk.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(r.Writer, "file not found", http.StatusNotFound)
+		} else {
+			http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		}
+		return err
+	}
+	content, err := disk.Get(filePath)
+	if err != nil {
+		http.Error(r.Writer, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	defer func(content io.ReadCloser) {
+		_ = content.Close()
+	}(content)
+
+	if fileName != "" {
+		r.Writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	}
+	if info.ContentType != "" {
+		r.Writer.Header().Set(contentType, info.ContentType)
+	}
+	for key, value := range headers {
+		r.Writer.Header().Set(key, value)
+	}
+
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		if r.Writer.Header().Get("ETag") == "" && !info.LastModified.IsZero() {
+			r.Writer.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.LastModified.UnixNano(), info.Size))
+		}
+		http.ServeContent(r.Writer, r.currentRequest(), path.Base(filePath), info.LastModified, seeker)
+		return nil
+	}
+
+	// remote disks stream without range support
+	if r.Writer.Header().Get(contentType) == "" {
+		r.Writer.Header().Set(contentType, "application/octet-stream")
+	}
+	r.Writer.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if !info.LastModified.IsZero() {
+		r.Writer.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	r.Writer.WriteHeader(http.StatusOK)
+	if r.currentRequest().Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.Copy(r.Writer, content)
+	return err
+}
+
+// TemporaryURL returns a URL granting access to a file of the default disk until it
+// expires
+func (g *Gudu) TemporaryURL(filePath string, expires time.Duration) (string, error) {
+	disk := g.Disk()
+	if disk == nil {
+		return "", fmt.Errorf("no default disk %q configured", g.config.storage.defaultDisk)
+	}
+	return disk.TemporaryURL(filePath, expires)
+}
+
+// signDiskURL signs the temporary URLs of local disks
+func (g *Gudu) signDiskURL(rawURL string, expires time.Duration) (string, error) {
+	return g.SignedURL(rawURL, nil, expires)
+}
+
+// TemporaryFiles returns a handler serving the files of the named local disk through
+// the temporary URLs of the disk, whose signatures it checks like ValidateSignature.
+// Mount it on a wildcard route at the URL of the disk:
+//
+//	g.Router.Handle("/files/*", g.TemporaryFiles("local"))
+//	link, err := g.TemporaryURL("invoices/2024.pdf", time.Hour)
+func (g *Gudu) TemporaryFiles(name string) http.Handler {
+	return g.ValidateSignature(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		disk := g.Disk(name)
+		// clean the path as if rooted, so it can not leave the disk
+		filePath := strings.TrimPrefix(path.Clean("/"+chi.URLParam(r, "*")), "/")
+		if disk == nil || filePath == "" {
+			g.HandleError(w, r, NewProblem(http.StatusNotFound, ""))
+			return
+		}
+		if exists, err := disk.Exists(filePath); err != nil || !exists {
+			g.HandleError(w, r, NewProblem(http.StatusNotFound, ""))
+			return
+		}
+
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		_ = g.ResponseFor(w, r).DiskFile(disk, filePath, nil)
+	}))
+}
@@ -0,0 +1,56 @@
+package gudu
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deenikarim/gudu/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTemporaryFilesServesSignedURLs(t *testing.T) {
+	g := testGudu(t)
+	g.EncryptionKey, g.PreviousKeys = previousKey, nil
+	g.config.storage = storageConfig{
+		defaultDisk: "local",
+		disks:       map[string]storage.Config{"local": {Driver: "local", Root: "storage/app", URL: "/files"}},
+	}
+	if err := g.createDisks(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Disk().Put("invoices/2024.pdf", strings.NewReader("invoice")); err != nil {
+		t.Fatal(err)
+	}
+	mux := chi.NewRouter()
+	mux.Handle("/files/*", g.TemporaryFiles("local"))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	link, err := g.TemporaryURL("invoices/2024.pdf", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// links of the previous key keep working while rotating KEY
+	g.EncryptionKey, g.PreviousKeys = testKey, []string{previousKey}
+	if w := get(link); w.Code != http.StatusOK || w.Body.String() != "invoice" {
+		t.Errorf("%s = %d %q", link, w.Code, w.Body.String())
+	}
+
+	if w := get(strings.Replace(link, "2024", "2023", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("a link to another file = %d, want 403", w.Code)
+	}
+	if w := get("/files/invoices/2024.pdf"); w.Code != http.StatusForbidden {
+		t.Errorf("an unsigned link = %d, want 403", w.Code)
+	}
+	expired, _ := g.SignedURL("/files/invoices/2024.pdf", nil, -time.Minute)
+	if w := get(expired); w.Code != http.StatusForbidden {
+		t.Errorf("an expired link = %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// LocalDisk stores files in a folder of the local filesystem
+type LocalDisk struct {
+	// Root is the folder holding the files
+	Root string
+	// BaseURL is the public URL the folder is served from
+	BaseURL string
+	// Signer signs temporary URLs; without it TemporaryURL is not supported
+	Signer URLSigner
+}
+
+// NewLocalDisk creates a disk rooted at the folder
+func NewLocalDisk(root, baseURL string, signer URLSigner) *LocalDisk {
+	return &LocalDisk{Root: root, BaseURL: baseURL, Signer: signer}
+}
+
+// fullPath returns the filesystem path of a disk path, always inside Root
+func (d *LocalDisk) fullPath(p string) string {
+	return filepath.Join(d.Root, filepath.FromSlash(cleanPath(p)))
+}
+
+// Put writes the content through a temporary file renamed into place, so readers never
+// see a partial file
+func (d *LocalDisk) Put(p string, content io.Reader, _ ...PutOptions) error {
+	target := d.fullPath(p)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Get opens the file, an *os.File
+func (d *LocalDisk) Get(p string) (io.ReadCloser, error) {
+	file, err := os.Open(d.fullPath(p))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		_ = file.Close()
+		return nil, ErrNotFound
+	}
+	return file, nil
+}
+
+// Stat returns the metadata of the file
+func (d *LocalDisk) Stat(p string) (FileInfo, error) {
+	info, err := os.Stat(d.fullPath(p))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return FileInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return d.fileInfo(cleanPath(p), info), nil
+}
+
+// fileInfo converts the metadata of a file
+func (d *LocalDisk) fileInfo(p string, info fs.FileInfo) FileInfo {
+	return FileInfo{
+		Path:         p,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		ContentType:  mime.TypeByExtension(path.Ext(p)),
+	}
+}
+
+// Delete removes the file
+func (d *LocalDisk) Delete(p string) error {
+	err := os.Remove(d.fullPath(p))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List walks the folder below the prefix
+func (d *LocalDisk) List(prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	root := d.fullPath(prefix)
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, d.fileInfo(filepath.ToSlash(rel), info))
+		return nil
+	})
+	return files, err
+}
+
+// Exists reports whether the file exists
+func (d *LocalDisk) Exists(p string) (bool, error) {
+	_, err := d.Stat(p)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Size returns the size of the file
+func (d *LocalDisk) Size(p string) (int64, error) {
+	info, err := d.Stat(p)
+	return info.Size, err
+}
+
+// URL returns the public URL of the file
+func (d *LocalDisk) URL(p string) string {
+	return joinURL(d.BaseURL, p)
+}
+
+// TemporaryURL returns the URL of the file signed by Signer with the expiry; the
+// application serving BaseURL checks the signature
+func (d *LocalDisk) TemporaryURL(p string, expires time.Duration) (string, error) {
+	if d.Signer == nil {
+		return "", ErrNotSupported
+	}
+	if expires <= 0 {
+		return "", errors.New("storage: temporary urls need a positive expiry")
+	}
+	return d.Signer(d.URL(p), expires)
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDisk keeps files in memory, for tests and throwaway data
+type MemoryDisk struct {
+	// BaseURL is used to build the URLs of the files
+	BaseURL string
+
+	mu    sync.RWMutex
+	files map[string]memoryFile
+}
+
+// memoryFile is a file of a MemoryDisk
+type memoryFile struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// NewMemoryDisk creates an empty in-memory disk
+func NewMemoryDisk(baseURL string) *MemoryDisk {
+	return &MemoryDisk{BaseURL: baseURL, files: make(map[string]memoryFile)}
+}
+
+// Put stores a copy of the content
+func (d *MemoryDisk) Put(p string, content io.Reader, opts ...PutOptions) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	p = cleanPath(p)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files[p] = memoryFile{data: data, contentType: contentType(p, opts), lastModified: time.Now()}
+	return nil
+}
+
+// Get returns a reader over the file, which is also an io.ReadSeeker
+func (d *MemoryDisk) Get(p string) (io.ReadCloser, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	file, ok := d.files[cleanPath(p)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return readSeekNopCloser{bytes.NewReader(file.data)}, nil
+}
+
+// Stat returns the metadata of the file
+func (d *MemoryDisk) Stat(p string) (FileInfo, error) {
+	p = cleanPath(p)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	file, ok := d.files[p]
+	if !ok {
+		return FileInfo{}, ErrNotFound
+	}
+	return FileInfo{Path: p, Size: int64(len(file.data)), LastModified: file.lastModified, ContentType: file.contentType}, nil
+}
+
+// Delete removes the file
+func (d *MemoryDisk) Delete(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.files, cleanPath(p))
+	return nil
+}
+
+// List returns the files below the prefix, sorted by path
+func (d *MemoryDisk) List(prefix string) ([]FileInfo, error) {
+	prefix = cleanPath(prefix)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var files []FileInfo
+	for p, file := range d.files {
+		if strings.HasPrefix(p, prefix) {
+			files = append(files, FileInfo{Path: p, Size: int64(len(file.data)), LastModified: file.lastModified, ContentType: file.contentType})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Exists reports whether the file exists
+func (d *MemoryDisk) Exists(p string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.files[cleanPath(p)]
+	return ok, nil
+}
+
+// Size returns the size of the file
+func (d *MemoryDisk) Size(p string) (int64, error) {
+	info, err := d.Stat(p)
+	return info.Size, err
+}
+
+// URL returns the URL of the file below BaseURL
+func (d *MemoryDisk) URL(p string) string {
+	return joinURL(d.BaseURL, p)
+}
+
+// TemporaryURL returns the URL with the expiry, memory disks do not sign URLs
+func (d *MemoryDisk) TemporaryURL(p string, expires time.Duration) (string, error) {
+	return d.URL(p) + "?expires=" + time.Now().Add(expires).UTC().Format(time.RFC3339), nil
+}
+
+// readSeekNopCloser adds a no-op Close to a bytes.Reader
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
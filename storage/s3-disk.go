@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3 compatible disk
+type S3Options struct {
+	// Endpoint is the service address, e.g. https://s3.eu-west-1.amazonaws.com or
+	// http://localhost:9000 for MinIO; empty selects AWS for the region
+	Endpoint string
+	// Region signs the requests, us-east-1 when empty
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key
+	PathStyle bool
+	// PublicURL is the base URL of public objects, e.g. a CDN; by default the object
+	// address is used
+	PublicURL string
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// S3Disk stores files in a bucket of an S3 compatible object storage, signing its
+// requests with AWS Signature Version 4. Objects are uploaded in a single request.
+type S3Disk struct {
+	options  S3Options
+	endpoint *url.URL
+}
+
+// s3Error is the error document of a failed request
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3ListResult is the response of ListObjectsV2
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// NewS3Disk creates a disk for the bucket
+func NewS3Disk(options S3Options) (*S3Disk, error) {
+	if options.Bucket == "" {
+		return nil, errors.New("storage: an s3 disk needs a bucket")
+	}
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	if options.Endpoint == "" {
+		options.Endpoint = "https://s3." + options.Region + ".amazonaws.com"
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	endpoint, err := url.Parse(strings.TrimRight(options.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint: %w", err)
+	}
+	return &S3Disk{options: options, endpoint: endpoint}, nil
+}
+
+// objectURL returns the address of an object, or of the bucket for an empty key
+func (d *S3Disk) objectURL(key string) *url.URL {
+	u := *d.endpoint
+	if d.options.PathStyle {
+		u.Path = u.Path + "/" + d.options.Bucket + "/" + key
+	} else {
+		u.Host = d.options.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	// keep the AWS encoding of the key, it is part of the signature
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+// do signs and sends a request, mapping 404 to ErrNotFound and other failures to the
+// error returned by the service
+func (d *S3Disk) do(method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := d.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	d.signRequest(req, body, time.Now().UTC())
+
+	resp, err := d.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer func(body io.ReadCloser) {
+			_ = body.Close()
+		}(resp.Body)
+		var serviceErr s3Error
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if xml.Unmarshal(content, &serviceErr) == nil && serviceErr.Code != "" {
+			return nil, fmt.Errorf("storage: s3 %s %s: %s: %s", method, key, serviceErr.Code, serviceErr.Message)
+		}
+		return nil, fmt.Errorf("storage: s3 %s %s: %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+// Put uploads the content, buffered in memory to sign its checksum
+func (d *S3Disk) Put(p string, content io.Reader, opts ...PutOptions) error {
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	key := cleanPath(p)
+	header := http.Header{}
+	header.Set("Content-Type", contentType(key, opts))
+
+	resp, err := d.do(http.MethodPut, key, nil, body, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Get streams the object
+func (d *S3Disk) Get(p string) (io.ReadCloser, error) {
+	resp, err := d.do(http.MethodGet, cleanPath(p), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat reads the metadata of the object with a HEAD request
+func (d *S3Disk) Stat(p string) (FileInfo, error) {
+	key := cleanPath(p)
+	resp, err := d.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	_ = resp.Body.Close()
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return FileInfo{Path: key, Size: size, LastModified: modified, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// Delete removes the object
+func (d *S3Disk) Delete(p string) error {
+	resp, err := d.do(http.MethodDelete, cleanPath(p), nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// List pages through ListObjectsV2 for the prefix
+func (d *S3Disk) List(prefix string) ([]FileInfo, error) {
+	prefix = cleanPath(prefix)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var files []FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := d.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			files = append(files, FileInfo{Path: object.Key, Size: object.Size, LastModified: object.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Exists reports whether the object exists
+func (d *S3Disk) Exists(p string) (bool, error) {
+	_, err := d.Stat(p)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Size returns the size of the object
+func (d *S3Disk) Size(p string) (int64, error) {
+	info, err := d.Stat(p)
+	return info.Size, err
+}
+
+// URL returns the public URL of the object
+func (d *S3Disk) URL(p string) string {
+	if d.options.PublicURL != "" {
+		return joinURL(d.options.PublicURL, p)
+	}
+	return d.objectURL(cleanPath(p)).String()
+}
+
+// TemporaryURL returns a presigned GET URL valid for the duration, at most 7 days
+func (d *S3Disk) TemporaryURL(p string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("storage: s3 temporary urls expire after 1 second to 7 days, got %s", expires)
+	}
+	return d.presign(http.MethodGet, cleanPath(p), expires, time.Now().UTC()), nil
+}
+
+// s3Hash returns the hex encoded SHA-256 of data
+func s3Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a file does not exist on a disk
+var ErrNotFound = errors.New("storage: file not found")
+
+// ErrNotSupported is returned by drivers that can not perform an operation, such as
+// temporary URLs on a local disk without a signer
+var ErrNotSupported = errors.New("storage: operation not supported")
+
+// Disk is a place files are stored. Paths are slash separated and relative to the
+// root of the disk; drivers reject paths escaping it.
+type Disk interface {
+	// Put stores the content at path, replacing an existing file
+	Put(path string, content io.Reader, opts ...PutOptions) error
+	// Get opens the file for reading; the caller closes it. Local and memory disks
+	// return an io.ReadSeeker, so downloads can serve byte ranges.
+	Get(path string) (io.ReadCloser, error)
+	// Stat returns the metadata of the file
+	Stat(path string) (FileInfo, error)
+	// Delete removes the file; deleting a missing file is not an error
+	Delete(path string) error
+	// List returns the files below the prefix, recursively
+	List(prefix string) ([]FileInfo, error)
+	// Exists reports whether the file exists
+	Exists(path string) (bool, error)
+	// Size returns the size of the file in bytes
+	Size(path string) (int64, error)
+	// URL returns the public URL of the file
+	URL(path string) string
+	// TemporaryURL returns a URL granting access to the file until it expires
+	TemporaryURL(path string, expires time.Duration) (string, error)
+}
+
+// PutOptions holds optional metadata for Disk.Put
+type PutOptions struct {
+	// ContentType is stored with the file where the driver supports it; by default it
+	// is derived from the extension
+	ContentType string
+}
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	Path         string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+}
+
+// URLSigner signs a URL so it is valid until it expires, such as the SignedURL of the
+// application
+type URLSigner func(rawURL string, expires time.Duration) (string, error)
+
+// Config describes a disk, usually read from the environment
+type Config struct {
+	// Driver is local, memory or s3
+	Driver string
+	// Root is the folder of a local disk
+	Root string
+	// URL is the public base URL of the files, e.g. /storage or a CDN address
+	URL string
+	// Signer signs the temporary URLs of local disks
+	Signer URLSigner
+	// Endpoint, Region, Bucket, AccessKey and SecretKey locate an S3 compatible
+	// bucket; PathStyle selects endpoint/bucket/key addressing, needed by MinIO
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// New creates the disk described by the config
+func New(config Config) (Disk, error) {
+	switch strings.ToLower(config.Driver) {
+	case "", "local":
+		if config.Root == "" {
+			return nil, errors.New("storage: a local disk needs a root folder")
+		}
+		return NewLocalDisk(config.Root, config.URL, config.Signer), nil
+	case "memory":
+		return NewMemoryDisk(config.URL), nil
+	case "s3":
+		return NewS3Disk(S3Options{
+			Endpoint:  config.Endpoint,
+			Region:    config.Region,
+			Bucket:    config.Bucket,
+			AccessKey: config.AccessKey,
+			SecretKey: config.SecretKey,
+			PathStyle: config.PathStyle,
+			PublicURL: config.URL,
+		})
+	}
+	return nil, fmt.Errorf("storage: unknown driver %q", config.Driver)
+}
+
+// cleanPath normalizes a disk path, removing any leading slash and ".." elements that
+// would escape the root
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, `\`, "/")), "/")
+}
+
+// contentType returns the configured content type or the one of the extension
+func contentType(p string, opts []PutOptions) string {
+	if len(opts) > 0 && opts[0].ContentType != "" {
+		return opts[0].ContentType
+	}
+	if t := mime.TypeByExtension(path.Ext(p)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// joinURL joins a base URL and a disk path
+func joinURL(base, p string) string {
+	return strings.TrimRight(base, "/") + "/" + cleanPath(p)
+}
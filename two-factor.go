@@ -0,0 +1,268 @@
+package gudu
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deenikarim/gudu/auth"
+	"github.com/deenikarim/gudu/twofactor"
+)
+
+// twoFactorConfig holds the two-factor authentication settings, read from the
+// environment
+type twoFactorConfig struct {
+	enabled bool
+	issuer  string
+	skew    int
+}
+
+// loadTwoFactorConfig reads the two-factor settings. AUTH_TWO_FACTOR turns two-factor
+// authentication on once the users table has the columns of `gudu make two-factor`;
+// AUTH_TWO_FACTOR_ISSUER names the application in authenticator apps, APP_NAME by
+// default; AUTH_TWO_FACTOR_WINDOW is the number of 30 second periods codes may be early
+// or late.
+func loadTwoFactorConfig() twoFactorConfig {
+	config := twoFactorConfig{issuer: getEnvOrDefault("AUTH_TWO_FACTOR_ISSUER", os.Getenv("APP_NAME"))}
+	config.enabled, _ = strconv.ParseBool(os.Getenv("AUTH_TWO_FACTOR"))
+	config.skew, _ = strconv.Atoi(os.Getenv("AUTH_TWO_FACTOR_WINDOW"))
+	return config
+}
+
+// recoveryCodesKey is the session key of new recovery codes, shown once by
+// TwoFactorSetup
+const recoveryCodesKey = "two_factor.recovery_codes"
+
+// qrCodeSize is the width and height of the QR codes in pixels
+const qrCodeSize = 256
+
+// TwoFactorSetup is the two-factor authentication state of a user for the settings
+// page. The secret and QR code are set while the setup waits for confirmation, the
+// recovery codes right after they were generated.
+type TwoFactorSetup struct {
+	Enabled       bool         `json:"enabled" xml:"enabled"`
+	Secret        string       `json:"secret,omitempty" xml:"secret,omitempty"`
+	URI           string       `json:"uri,omitempty" xml:"uri,omitempty"`
+	QRCode        template.URL `json:"qr_code,omitempty" xml:"qr_code,omitempty"`
+	RecoveryCodes []string     `json:"recovery_codes,omitempty" xml:"recovery_codes>code,omitempty"`
+}
+
+// TwoFactorSetup returns the two-factor state of the logged-in user for the settings
+// page, e.g. as GenericData "twoFactor" of the views of `gudu make two-factor`
+func (g *Gudu) TwoFactorSetup(r *http.Request) (*TwoFactorSetup, error) {
+	user, err := g.twoFactorUser(r)
+	if err != nil {
+		return nil, err
+	}
+	secret, confirmed, err := g.Auth.TwoFactorSecret(r.Context(), user.AuthID())
+	if err != nil {
+		return nil, err
+	}
+	setup := &TwoFactorSetup{Enabled: confirmed}
+	if secret != "" && !confirmed {
+		if err := g.fillTwoFactorSetup(r.Context(), setup, user, secret); err != nil {
+			return nil, err
+		}
+	}
+	if codes := g.Sessions.PopString(r.Context(), recoveryCodesKey); codes != "" {
+		setup.RecoveryCodes = strings.Split(codes, "\n")
+	}
+	return setup, nil
+}
+
+// fillTwoFactorSetup sets the secret, its otpauth:// URI and the QR code of the URI
+func (g *Gudu) fillTwoFactorSetup(ctx context.Context, setup *TwoFactorSetup, user auth.User, secret string) error {
+	setup.Secret = secret
+	setup.URI = g.Auth.TOTP.URI(secret, g.twoFactorAccount(ctx, user))
+	qrCode, err := twofactor.QRCodeDataURI(setup.URI, qrCodeSize)
+	if err != nil {
+		return err
+	}
+	setup.QRCode = template.URL(qrCode)
+	return nil
+}
+
+// twoFactorAccount names the user in authenticator apps: the email address when it is
+// known, the id otherwise
+func (g *Gudu) twoFactorAccount(ctx context.Context, user auth.User) string {
+	if g.Auth.Verifier != nil {
+		if email, _, err := g.Auth.Verifier.EmailVerified(ctx, user.AuthID()); err == nil && email != "" {
+			return email
+		}
+	}
+	return user.AuthID()
+}
+
+// twoFactorUser returns the logged-in user of the settings handlers
+func (g *Gudu) twoFactorUser(r *http.Request) (auth.User, error) {
+	user := g.AuthUser(r)
+	if user == nil {
+		return nil, NewProblem(http.StatusUnauthorized, "")
+	}
+	return user, nil
+}
+
+// TwoFactorChallenge handles the form of the page a login with two-factor
+// authentication waits on, register it with Gudu.Handle next to the page itself:
+//
+//	mux.Get("/two-factor-challenge", handlers.TwoFactorChallengePage)
+//	mux.Post("/two-factor-challenge", app.Handle(app.TwoFactorChallenge))
+//
+// The form posts the code of the authenticator app in the code field, or a recovery
+// code in the recovery_code field. Wrong codes send browsers back with a message in the
+// "error" session key and are throttled like passwords; expired logins are sent to
+// AUTH_LOGIN_PATH. Completed logins go to the intended page.
+func (g *Gudu) TwoFactorChallenge(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Code         string `json:"code" xml:"code" form:"code"`
+		RecoveryCode string `json:"recovery_code" xml:"recovery_code" form:"recovery_code"`
+	}
+	if err := g.Bind(r, &input); err != nil {
+		return g.authFormError(w, r, err)
+	}
+	input.Code, input.RecoveryCode = strings.TrimSpace(input.Code), strings.TrimSpace(input.RecoveryCode)
+	if input.Code == "" && input.RecoveryCode == "" {
+		return g.authFormError(w, r, ValidationErrors{"code": {"Enter the code of your authenticator app or a recovery code."}})
+	}
+
+	_, err := g.Auth.ChallengeTwoFactor(w, r, input.Code, input.RecoveryCode)
+	var lockout *auth.LockoutError
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return g.loginFailed(w, r, "Your login has expired, please log in again.")
+	case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+		field := "code"
+		if input.RecoveryCode != "" {
+			field = "recovery_code"
+		}
+		return g.authFormError(w, r, ValidationErrors{field: {auth.LoginMessage(err)}})
+	case errors.As(err, &lockout) && g.ResponseFor(w, r).problemMediaType() == "text/html":
+		return g.authFormError(w, r, ValidationErrors{"code": {auth.LoginMessage(err)}})
+	case err != nil:
+		return authProblem(err)
+	}
+	return g.authFormStatus(w, r, http.StatusOK, "You are signed in.", g.Auth.Intended(r))
+}
+
+// EnableTwoFactor starts the two-factor setup of the logged-in user, register it with
+// Gudu.Handle with the other settings handlers on routes guarded by RequireWeb:
+//
+//	mux.Post("/user/two-factor", app.Handle(app.EnableTwoFactor))
+//	mux.Post("/user/two-factor/confirm", app.Handle(app.ConfirmTwoFactor))
+//	mux.Post("/user/two-factor/recovery-codes", app.Handle(app.RegenerateRecoveryCodes))
+//	mux.Post("/user/two-factor/disable", app.Handle(app.DisableTwoFactor))
+//
+// A new secret is generated; browsers are sent back to the settings page, which shows
+// its QR code through TwoFactorSetup, APIs get the TwoFactorSetup. Logins ask for codes
+// once the user confirmed the secret.
+func (g *Gudu) EnableTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	user, err := g.twoFactorUser(r)
+	if err != nil {
+		return err
+	}
+	secret, err := g.Auth.SetupTwoFactor(r.Context(), user.AuthID())
+	if errors.Is(err, auth.ErrTwoFactorEnabled) {
+		return NewProblem(http.StatusConflict, "Two-factor authentication is already enabled.")
+	}
+	if err != nil {
+		return err
+	}
+
+	resp := g.ResponseFor(w, r)
+	if resp.problemMediaType() == "text/html" {
+		return g.authFormStatus(w, r, http.StatusOK,
+			"Scan the QR code with your authenticator app and enter a code to finish.", backURL(r))
+	}
+	setup := &TwoFactorSetup{}
+	if err := g.fillTwoFactorSetup(r.Context(), setup, user, secret); err != nil {
+		return err
+	}
+	return resp.Negotiate(setup, http.StatusOK)
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a code of the new secret in
+// the code field, and answers with the recovery codes
+func (g *Gudu) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Code string `json:"code" xml:"code" form:"code" validate:"required"`
+	}
+	if err := g.Bind(r, &input); err != nil {
+		return g.authFormError(w, r, err)
+	}
+	user, err := g.twoFactorUser(r)
+	if err != nil {
+		return err
+	}
+
+	codes, err := g.Auth.ConfirmTwoFactor(r.Context(), user.AuthID(), input.Code)
+	switch {
+	case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+		return g.authFormError(w, r, ValidationErrors{"code": {auth.LoginMessage(err)}})
+	case errors.Is(err, auth.ErrTwoFactorEnabled):
+		return NewProblem(http.StatusConflict, "Two-factor authentication is already enabled.")
+	case errors.Is(err, auth.ErrTwoFactorDisabled):
+		return NewProblem(http.StatusConflict, "Two-factor authentication was not set up.")
+	case err != nil:
+		return err
+	}
+	return g.recoveryCodes(w, r, codes, "Two-factor authentication is enabled, store your recovery codes in a safe place.")
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the logged-in user and
+// answers with the new ones
+func (g *Gudu) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	user, err := g.twoFactorUser(r)
+	if err != nil {
+		return err
+	}
+	codes, err := g.Auth.RegenerateRecoveryCodes(r.Context(), user.AuthID())
+	if errors.Is(err, auth.ErrTwoFactorDisabled) {
+		return NewProblem(http.StatusConflict, "Two-factor authentication is not enabled.")
+	}
+	if err != nil {
+		return err
+	}
+	return g.recoveryCodes(w, r, codes, "Your recovery codes were replaced, store the new ones in a safe place.")
+}
+
+// recoveryCodes answers with new recovery codes: browsers are sent back to the
+// settings page, which shows them once through TwoFactorSetup; APIs get them as JSON
+func (g *Gudu) recoveryCodes(w http.ResponseWriter, r *http.Request, codes []string, message string) error {
+	resp := g.ResponseFor(w, r)
+	if resp.problemMediaType() == "text/html" {
+		g.Sessions.Put(r.Context(), recoveryCodesKey, strings.Join(codes, "\n"))
+		return g.authFormStatus(w, r, http.StatusOK, message, backURL(r))
+	}
+	return resp.Negotiate(&TwoFactorSetup{Enabled: true, RecoveryCodes: codes}, http.StatusOK)
+}
+
+// DisableTwoFactor turns two-factor authentication off for the logged-in user, who
+// confirms with the current password in the password field
+func (g *Gudu) DisableTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Password string `json:"password" xml:"password" form:"password" validate:"required"`
+	}
+	if err := g.Bind(r, &input); err != nil {
+		return g.authFormError(w, r, err)
+	}
+	user, err := g.twoFactorUser(r)
+	if err != nil {
+		return err
+	}
+	matched, err := g.Hasher.Verify(input.Password, user.AuthPassword())
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return g.authFormError(w, r, ValidationErrors{"password": {"The password is incorrect."}})
+	}
+
+	if err := g.Auth.DisableTwoFactor(r.Context(), user.AuthID()); err != nil {
+		return err
+	}
+	return g.authFormStatus(w, r, http.StatusOK, "Two-factor authentication is disabled.", backURL(r))
+}
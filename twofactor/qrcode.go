@@ -0,0 +1,22 @@
+package twofactor
+
+import (
+	"encoding/base64"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QRCode encodes content, e.g. a URI, as a PNG image of size by size pixels with
+// medium error correction
+func QRCode(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, size)
+}
+
+// QRCodeDataURI returns the QR code of content as a data: URI for img elements
+func QRCodeDataURI(content string, size int) (string, error) {
+	png, err := QRCode(content, size)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
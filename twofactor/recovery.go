@@ -0,0 +1,68 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// recoveryAlphabet leaves out characters that are easily confused
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns n random recovery codes such as "k3m9p-x7w2q"; show
+// them to the user once and store their hashes
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		var code strings.Builder
+		for j, c := range b {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryAlphabet[int(c)%len(recoveryAlphabet)])
+		}
+		codes[i] = code.String()
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode hashes a recovery code for storage; case, spaces and dashes are
+// ignored
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashRecoveryCodes hashes every code
+func HashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = HashRecoveryCode(code)
+	}
+	return hashes
+}
+
+// UseRecoveryCode looks code up in the stored hashes. When it is one of them, the
+// hashes without it are returned to be stored, so each code works once.
+func UseRecoveryCode(hashes []string, code string) (remaining []string, ok bool) {
+	hash := []byte(HashRecoveryCode(code))
+	index := -1
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), hash) == 1 {
+			index = i
+		}
+	}
+	if index < 0 || strings.TrimSpace(code) == "" {
+		return hashes, false
+	}
+	remaining = make([]string, 0, len(hashes)-1)
+	remaining = append(remaining, hashes[:index]...)
+	return append(remaining, hashes[index+1:]...), true
+}
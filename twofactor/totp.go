@@ -0,0 +1,188 @@
+// Package twofactor implements the second factor of logins: time-based one-time
+// passwords (RFC 6238) as shown by authenticator apps, with otpauth:// URIs and QR
+// codes to set them up, replay protection, and single-use recovery codes stored as
+// hashes.
+package twofactor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSecret is returned for secrets that are not base32 encoded
+var ErrInvalidSecret = errors.New("twofactor: invalid secret")
+
+// encoding is the base32 alphabet of secrets, without padding as authenticator apps
+// expect
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Store remembers the time steps used per user, for replay protection. It is
+// satisfied by the gudu cache.Cache drivers through an adapter returning nil for
+// missing keys, and by auth.MemoryStore.
+type Store interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}, expires ...time.Duration) error
+	// SetIfAbsent atomically stores the value unless the key exists, reporting whether
+	// it stored it
+	SetIfAbsent(key string, value interface{}, expires ...time.Duration) (bool, error)
+}
+
+// Options configures the codes; zero values select the defaults, which are the ones
+// every authenticator app supports
+type Options struct {
+	// Issuer names the application in authenticator apps
+	Issuer string
+	// Digits is the length of the codes, 6 by default
+	Digits int
+	// Period is the lifetime of a code, 30 seconds by default
+	Period time.Duration
+	// Skew is the number of periods before and after the current one that are
+	// accepted for clock drift, 1 by default
+	Skew int
+}
+
+// TOTP generates and verifies time-based one-time passwords with HMAC-SHA1
+type TOTP struct {
+	options Options
+	store   Store
+	now     func() time.Time
+}
+
+// New creates a TOTP; verified codes are recorded in store so each can be used once
+func New(options Options, store Store) *TOTP {
+	if options.Digits <= 0 {
+		options.Digits = 6
+	}
+	if options.Period <= 0 {
+		options.Period = 30 * time.Second
+	}
+	if options.Skew <= 0 {
+		options.Skew = 1
+	}
+	return &TOTP{options: options, store: store, now: time.Now}
+}
+
+// GenerateSecret returns a random 160 bit secret, base32 encoded
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// decodeSecret accepts secrets as typed by users: lower case, with spaces or padding
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// URI returns the otpauth:// URI of the secret for the account, e.g. an email
+// address, which authenticator apps read from QR codes
+func (t *TOTP) URI(secret, account string) string {
+	label := url.PathEscape(account)
+	if t.options.Issuer != "" {
+		label = url.PathEscape(t.options.Issuer) + ":" + label
+	}
+	query := url.Values{
+		"secret":    {secret},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(t.options.Digits)},
+		"period":    {strconv.Itoa(int(t.options.Period / time.Second))},
+	}
+	if t.options.Issuer != "" {
+		query.Set("issuer", t.options.Issuer)
+	}
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// Code returns the code of the secret at the time
+func (t *TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return t.code(key, t.step(at)), nil
+}
+
+// step returns the time step of a time
+func (t *TOTP) step(at time.Time) int64 {
+	return at.Unix() / int64(t.options.Period/time.Second)
+}
+
+// code computes the HOTP value (RFC 4226) of a time step
+func (t *TOTP) code(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < t.options.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", t.options.Digits, value%modulo)
+}
+
+// Verify checks a code of the secret within the drift window. Codes are accepted once:
+// the time step of a valid code is claimed atomically under key, e.g. the user id, so
+// concurrent requests with the same code pass only once, and codes of that step or an
+// earlier one are rejected afterwards.
+func (t *TOTP) Verify(key, secret, code string) (bool, error) {
+	secretKey, err := decodeSecret(secret)
+	if err != nil {
+		return false, err
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != t.options.Digits {
+		return false, nil
+	}
+
+	now := t.step(t.now())
+	matched := int64(-1)
+	for step := now - int64(t.options.Skew); step <= now+int64(t.options.Skew); step++ {
+		if subtle.ConstantTimeCompare([]byte(t.code(secretKey, step)), []byte(code)) == 1 {
+			matched = step
+		}
+	}
+	if matched < 0 {
+		return false, nil
+	}
+	if t.store == nil {
+		return true, nil
+	}
+
+	storeKey := "twofactor:step:" + key
+	value, err := t.store.Get(storeKey)
+	if err != nil {
+		return false, err
+	}
+	if stored, ok := value.(string); ok {
+		if last, _ := strconv.ParseInt(stored, 10, 64); matched <= last {
+			return false, nil
+		}
+	}
+	window := time.Duration(2*t.options.Skew+1) * t.options.Period
+	first, err := t.store.SetIfAbsent("twofactor:used:"+key+":"+strconv.FormatInt(matched, 10), "used", window)
+	if err != nil || !first {
+		return false, err
+	}
+	return true, t.store.Set(storeKey, strconv.FormatInt(matched, 10), window)
+}
@@ -0,0 +1,166 @@
+package twofactor
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// memoryStore is a Store in a map
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: map[string]interface{}{}}
+}
+
+func (m *memoryStore) Get(key string) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[key], nil
+}
+
+func (m *memoryStore) Set(key string, value interface{}, _ ...time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+	return nil
+}
+
+func (m *memoryStore) SetIfAbsent(key string, value interface{}, _ ...time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; ok {
+		return false, nil
+	}
+	m.values[key] = value
+	return true, nil
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	totp := New(Options{Digits: 8}, nil)
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+	for unix, want := range vectors {
+		got, err := totp.Code(rfcSecret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Errorf("Code(%d) = %q, %v, want %q", unix, got, err, want)
+		}
+	}
+	if _, err := totp.Code("not base32!", time.Now()); err != ErrInvalidSecret {
+		t.Errorf("err = %v, want ErrInvalidSecret", err)
+	}
+}
+
+func TestVerifyDriftAndReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	totp := New(Options{}, newMemoryStore())
+	totp.now = func() time.Time { return now }
+
+	previous, _ := totp.Code(rfcSecret, now.Add(-30*time.Second))
+	current, _ := totp.Code(rfcSecret, now)
+	stale, _ := totp.Code(rfcSecret, now.Add(-90*time.Second))
+
+	if ok, _ := totp.Verify("1", rfcSecret, stale); ok {
+		t.Error("codes outside the drift window are rejected")
+	}
+	if ok, err := totp.Verify("1", rfcSecret, previous); !ok || err != nil {
+		t.Errorf("previous period: %v, %v", ok, err)
+	}
+	if ok, _ := totp.Verify("1", rfcSecret, previous); ok {
+		t.Error("a used code is rejected")
+	}
+	if ok, _ := totp.Verify("1", rfcSecret, current); !ok {
+		t.Error("a later code is accepted after an earlier one")
+	}
+	if ok, _ := totp.Verify("1", rfcSecret, previous); ok {
+		t.Error("an earlier code is rejected after a later one")
+	}
+	if ok, _ := totp.Verify("2", rfcSecret, current); !ok {
+		t.Error("replay protection is per key")
+	}
+}
+
+func TestVerifyAcceptsConcurrentReplaysOnce(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	totp := New(Options{}, newMemoryStore())
+	totp.now = func() time.Time { return now }
+	code, _ := totp.Code(rfcSecret, now)
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := totp.Verify("1", rfcSecret, code); ok && err == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted.Load() != 1 {
+		t.Errorf("the code was accepted %d times, want once", accepted.Load())
+	}
+}
+
+func TestURIAndQRCode(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("secret = %q, %v", secret, err)
+	}
+	uri := New(Options{Issuer: "Acme Inc"}, nil).URI(secret, "ada@example.com")
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Acme Inc:ada@example.com" ||
+		query.Get("secret") != secret || query.Get("issuer") != "Acme Inc" || query.Get("digits") != "6" {
+		t.Errorf("uri = %s", uri)
+	}
+
+	png, err := QRCode(uri, 256)
+	if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Fatalf("QRCode: %v", err)
+	}
+	dataURI, _ := QRCodeDataURI(uri, 256)
+	if !strings.HasPrefix(dataURI, "data:image/png;base64,") {
+		t.Errorf("data uri = %.40s", dataURI)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(8)
+	if err != nil || len(codes) != 8 || len(codes[0]) != 11 {
+		t.Fatalf("codes = %v, %v", codes, err)
+	}
+	hashes := HashRecoveryCodes(codes)
+
+	remaining, ok := UseRecoveryCode(hashes, " "+strings.ToUpper(codes[3])+" ")
+	if !ok || len(remaining) != 7 {
+		t.Fatalf("use = %v, %d left", ok, len(remaining))
+	}
+	if _, ok := UseRecoveryCode(remaining, codes[3]); ok {
+		t.Error("a used recovery code is rejected")
+	}
+	if _, ok := UseRecoveryCode(remaining, ""); ok {
+		t.Error("an empty recovery code is rejected")
+	}
+	if len(hashes) != 8 {
+		t.Error("the stored hashes are not changed")
+	}
+}
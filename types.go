@@ -2,6 +2,8 @@ package gudu
 
 import (
 	"database/sql"
+	"github.com/deenikarim/gudu/auth"
+	"github.com/deenikarim/gudu/oauth"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -18,6 +20,23 @@ type packageConfigs struct {
 	cookies          cookieConfig
 	databaseConfigs  databaseConfig
 	redis            redisConfig
+	cors             CORSOptions
+	security         SecurityHeadersOptions
+	compression      CompressionOptions
+	bind             BindOptions
+	uploads          UploadOptions
+	storage          storageConfig
+	jwt              jwtConfig
+	auth             auth.Config
+	passwordReset    passwordResetConfig
+	verification     verificationConfig
+	twoFactor        twoFactorConfig
+	oauth            []*oauth.Provider
+	compress         bool
+	etag             string
+	static           staticConfig
+	secure           bool
+	serverName       string
 }
 
 // cookieConfig for session configurations
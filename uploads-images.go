@@ -0,0 +1,118 @@
+package gudu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/deenikarim/gudu/images"
+	"github.com/deenikarim/gudu/storage"
+)
+
+// imageVariants holds the image variants of upload fields, see Gudu.ImageVariants
+type imageVariants struct {
+	mu     sync.RWMutex
+	fields map[string][]images.Variant
+}
+
+// ImageVariants defines the variants generated for images uploaded in a field, such as
+// thumbnails or avatars. Upload and SaveUploadedFile store each variant next to the
+// original, named after it with the variant name appended, e.g. 3f2a-thumb.jpg.
+// Uploads that are not JPEG, PNG or GIF images get no variants.
+func (g *Gudu) ImageVariants(field string, variants ...images.Variant) {
+	g.imageVariants.mu.Lock()
+	defer g.imageVariants.mu.Unlock()
+	if g.imageVariants.fields == nil {
+		g.imageVariants.fields = make(map[string][]images.Variant)
+	}
+	g.imageVariants.fields[field] = variants
+}
+
+// storeImageVariants generates and stores the variants of the field of an uploaded
+// image, in the background with UploadOptions.AsyncVariants
+func (g *Gudu) storeImageVariants(file *UploadedFile, options UploadOptions) error {
+	g.imageVariants.mu.RLock()
+	variants := g.imageVariants.fields[file.Field]
+	g.imageVariants.mu.RUnlock()
+	if len(variants) == 0 {
+		return nil
+	}
+	format, err := images.ParseFormat(file.MimeType)
+	if err != nil {
+		return nil
+	}
+
+	// variants go to the disk of the upload, or to a local disk over the upload folder
+	disk, dir := options.Disk, filepath.ToSlash(options.Dir)
+	if disk == nil {
+		disk, dir = storage.NewLocalDisk(options.Dir, "", nil), ""
+	}
+
+	base := strings.TrimSuffix(file.Name, path.Ext(file.Name))
+	diskPaths := make([]string, len(variants))
+	file.Variants = make(map[string]string, len(variants))
+	for i, variant := range variants {
+		name := base + "-" + variant.Name + variant.OutputFormat(format).Extension()
+		diskPaths[i] = path.Join(dir, name)
+		if options.Disk != nil {
+			file.Variants[variant.Name] = diskPaths[i]
+		} else {
+			file.Variants[variant.Name] = filepath.Join(options.Dir, name)
+		}
+	}
+
+	generate := func() error {
+		source, err := uploadSource(file, options)
+		if err != nil {
+			return err
+		}
+		defer func(source io.ReadCloser) {
+			_ = source.Close()
+		}(source)
+
+		outputs, err := images.Process(source, images.DecodeOptions{MaxPixels: options.MaxImagePixels}, variants...)
+		if errors.Is(err, images.ErrTooLarge) {
+			maxPixels := options.MaxImagePixels
+			if maxPixels <= 0 {
+				maxPixels = images.DefaultMaxPixels
+			}
+			return NewProblem(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("The image %s must not exceed %d pixels.", file.OriginalName, maxPixels))
+		}
+		if err != nil {
+			return err
+		}
+		for i, output := range outputs {
+			err := disk.Put(diskPaths[i], bytes.NewReader(output.Data), storage.PutOptions{ContentType: output.Format.MimeType()})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if options.AsyncVariants {
+		go func() {
+			if err := generate(); err != nil {
+				g.ErrorLog.Printf("image variants of %s: %v", file.Path, err)
+			}
+		}()
+		return nil
+	}
+	return generate()
+}
+
+// uploadSource opens a stored upload
+func uploadSource(file *UploadedFile, options UploadOptions) (io.ReadCloser, error) {
+	if options.Disk != nil {
+		return options.Disk.Get(file.Path)
+	}
+	return os.Open(file.Path)
+}
@@ -0,0 +1,366 @@
+package gudu
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/deenikarim/gudu/storage"
+)
+
+// UploadOptions holds the settings of Gudu.Upload
+type UploadOptions struct {
+	// Dir receives the stored files; relative paths are below the application root,
+	// or below the root of Disk when it is set
+	Dir string
+	// Disk stores the files on a storage disk instead of the local Dir
+	Disk storage.Disk
+	// MaxBodySize limits the whole multipart request body in bytes
+	MaxBodySize int64
+	// MaxFileSize limits each uploaded file in bytes
+	MaxFileSize int64
+	// MaxFiles limits the number of files accepted per field, 0 for no limit
+	MaxFiles int
+	// AllowedTypes lists the accepted media types, as sniffed from the content;
+	// "image/*" matches a whole family and an empty list accepts anything
+	AllowedTypes []string
+	// MultipartMemory is the part of the body kept in memory while parsing
+	MultipartMemory int64
+	// AsyncVariants generates the image variants of the field in the background; their
+	// paths are returned right away and failures are logged
+	AsyncVariants bool
+	// MaxImagePixels limits the width x height of the images variants are generated
+	// from, images.DefaultMaxPixels when zero
+	MaxImagePixels int
+}
+
+// UploadedFile describes a stored upload
+type UploadedFile struct {
+	// Field is the form field the file was sent in
+	Field string `json:"field"`
+	// OriginalName is the client supplied file name, kept as metadata only and never
+	// used to build paths
+	OriginalName string `json:"original_name"`
+	// Name is the generated file name and Path the full path it was stored at, a disk
+	// path when stored on a disk
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Size is the file size in bytes
+	Size int64 `json:"size"`
+	// MimeType is sniffed from the content, not taken from the client
+	MimeType string `json:"mime_type"`
+	// SHA256 is the hex encoded checksum of the content
+	SHA256 string `json:"sha256"`
+	// Variants maps the image variants of the field to the paths they are stored at
+	Variants map[string]string `json:"variants,omitempty"`
+}
+
+// loadUploadConfig reads the upload settings from the environment
+func loadUploadConfig() UploadOptions {
+	maxBodySize, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BODY_SIZE"), 10, 64)
+	if err != nil || maxBodySize <= 0 {
+		maxBodySize = 64 << 20
+	}
+	maxFileSize, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_FILE_SIZE"), 10, 64)
+	if err != nil || maxFileSize <= 0 {
+		maxFileSize = 10 << 20
+	}
+	maxFiles, _ := strconv.Atoi(os.Getenv("UPLOAD_MAX_FILES"))
+	asyncVariants, _ := strconv.ParseBool(os.Getenv("UPLOAD_ASYNC_VARIANTS"))
+	maxImagePixels, _ := strconv.Atoi(os.Getenv("UPLOAD_MAX_IMAGE_PIXELS"))
+
+	return UploadOptions{
+		Dir:             getEnvOrDefault("UPLOAD_DIR", "uploads"),
+		MaxBodySize:     maxBodySize,
+		MaxFileSize:     maxFileSize,
+		MaxFiles:        maxFiles,
+		AllowedTypes:    splitEnvList("UPLOAD_ALLOWED_TYPES"),
+		MultipartMemory: 32 << 20,
+		AsyncVariants:   asyncVariants,
+		MaxImagePixels:  maxImagePixels,
+	}
+}
+
+// Upload stores every file sent in the multipart form field. Files get a random name
+// with an extension matching their sniffed type, are written through a temporary file
+// and renamed into place, and are checked against the size and type limits. Limit
+// violations return a *Problem (413 or 415) and no file of the field is kept.
+func (g *Gudu) Upload(r *http.Request, field string, opts ...UploadOptions) ([]*UploadedFile, error) {
+	options := g.uploadOptions(opts...)
+
+	if r.MultipartForm == nil {
+		if options.MaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(nil, r.Body, options.MaxBodySize)
+		}
+		if err := r.ParseMultipartForm(options.MultipartMemory); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, NewProblem(http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("The request body must not exceed %d bytes.", maxBytesErr.Limit))
+			}
+			return nil, NewProblem(http.StatusBadRequest, "The multipart form is malformed: "+err.Error())
+		}
+	}
+
+	headers := r.MultipartForm.File[field]
+	if options.MaxFiles > 0 && len(headers) > options.MaxFiles {
+		return nil, NewProblem(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("The %s field accepts at most %d files.", field, options.MaxFiles))
+	}
+
+	files := make([]*UploadedFile, 0, len(headers))
+	for _, header := range headers {
+		file, err := g.saveUploadWithVariants(header, field, options)
+		if err != nil {
+			for _, stored := range files {
+				removeUpload(stored, options)
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// SaveUploadedFile stores a single file, e.g. one bound by Gudu.Bind, with the same
+// checks as Upload
+func (g *Gudu) SaveUploadedFile(header *multipart.FileHeader, field string, opts ...UploadOptions) (*UploadedFile, error) {
+	return g.saveUploadWithVariants(header, field, g.uploadOptions(opts...))
+}
+
+// saveUploadWithVariants stores one file and the image variants of its field
+func (g *Gudu) saveUploadWithVariants(header *multipart.FileHeader, field string, options UploadOptions) (*UploadedFile, error) {
+	file, err := saveUpload(header, field, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.storeImageVariants(file, options); err != nil {
+		removeUpload(file, options)
+		return nil, err
+	}
+	return file, nil
+}
+
+// removeUpload deletes a stored file and its variants
+func removeUpload(file *UploadedFile, options UploadOptions) {
+	paths := []string{file.Path}
+	for _, variantPath := range file.Variants {
+		paths = append(paths, variantPath)
+	}
+	for _, p := range paths {
+		if options.Disk != nil {
+			_ = options.Disk.Delete(p)
+		} else {
+			_ = os.Remove(p)
+		}
+	}
+}
+
+// uploadOptions returns the configured options or the given ones, resolving the
+// upload directory against the application root
+func (g *Gudu) uploadOptions(opts ...UploadOptions) UploadOptions {
+	options := g.config.uploads
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.Dir == "" {
+		options.Dir = "uploads"
+	}
+	if options.Disk == nil && !filepath.IsAbs(options.Dir) && g.RootPath != "" {
+		options.Dir = filepath.Join(g.RootPath, options.Dir)
+	}
+	if options.MultipartMemory <= 0 {
+		options.MultipartMemory = 32 << 20
+	}
+	return options
+}
+
+// saveUpload checks and atomically stores one uploaded file
+func saveUpload(header *multipart.FileHeader, field string, options UploadOptions) (*UploadedFile, error) {
+	if options.MaxFileSize > 0 && header.Size > options.MaxFileSize {
+		return nil, uploadTooLarge(header, options)
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func(src multipart.File) {
+		_ = src.Close()
+	}(src)
+
+	// sniff the type from the magic bytes before anything is written
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	mimeType := http.DetectContentType(head)
+	if !uploadTypeAllowed(mimeType, options.AllowedTypes) {
+		return nil, NewProblem(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("The file %s has the type %s, which is not accepted.", header.Filename, mediaTypeOnly(mimeType)))
+	}
+
+	// files for a disk are staged in the temporary folder before they are put
+	tmpDir := options.Dir
+	if options.Disk != nil {
+		tmpDir = os.TempDir()
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	reader := io.MultiReader(bytes.NewReader(head), src)
+	if options.MaxFileSize > 0 {
+		// read one byte more than allowed to notice a body larger than announced
+		reader = io.LimitReader(reader, options.MaxFileSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if err != nil {
+		return nil, err
+	}
+	if options.MaxFileSize > 0 && size > options.MaxFileSize {
+		return nil, uploadTooLarge(header, options)
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	name, err := uploadName(header.Filename, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	target := filepath.Join(options.Dir, name)
+	if options.Disk != nil {
+		target = path.Join(filepath.ToSlash(options.Dir), name)
+		if err := putUpload(options.Disk, target, tmp.Name(), mimeType); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := os.Rename(tmp.Name(), target); err != nil {
+			return nil, err
+		}
+		committed = true
+	}
+
+	return &UploadedFile{
+		Field:        field,
+		OriginalName: filepath.Base(strings.ReplaceAll(header.Filename, `\`, "/")),
+		Name:         name,
+		Path:         target,
+		Size:         size,
+		MimeType:     mediaTypeOnly(mimeType),
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// putUpload copies a staged upload to the disk
+func putUpload(disk storage.Disk, target, staged, mimeType string) error {
+	file, err := os.Open(staged)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	return disk.Put(target, file, storage.PutOptions{ContentType: mediaTypeOnly(mimeType)})
+}
+
+// uploadTooLarge is the problem reported for a file above the size limit
+func uploadTooLarge(header *multipart.FileHeader, options UploadOptions) error {
+	return NewProblem(http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("The file %s must not exceed %d bytes.", header.Filename, options.MaxFileSize))
+}
+
+// uploadTypeAllowed reports whether the sniffed type is in the allowlist
+func uploadTypeAllowed(mimeType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mimeType = mediaTypeOnly(mimeType)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mimeType || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadName generates a random file name. The extension of the original name is
+// kept when it matches the sniffed type, otherwise one is derived from the type.
+func uploadName(original, mimeType string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	ext := strings.ToLower(filepath.Ext(original))
+	if !isSafeExtension(ext) {
+		ext = ""
+	}
+	known, _ := mime.ExtensionsByType(mediaTypeOnly(mimeType))
+	if len(known) > 0 {
+		matches := false
+		for _, candidate := range known {
+			if candidate == ext {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			ext = known[0]
+		}
+	} else if mediaTypeOnly(mimeType) == "application/octet-stream" {
+		ext = ".bin"
+	}
+
+	return hex.EncodeToString(random) + ext, nil
+}
+
+// isSafeExtension reports whether ext is a short extension made of letters and digits
+func isSafeExtension(ext string) bool {
+	if len(ext) < 2 || len(ext) > 10 {
+		return false
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaTypeOnly strips parameters such as charset from a media type
+func mediaTypeOnly(mimeType string) string {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
@@ -0,0 +1,156 @@
+package gudu
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// uploadFile is a file of a multipart test request
+type uploadFile struct {
+	name    string
+	content []byte
+}
+
+// uploadRequest builds a multipart request sending the files in the field
+func uploadRequest(t *testing.T, field string, files ...uploadFile) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := writer.CreateFormFile(field, file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(file.content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	return r
+}
+
+// pngData returns the bytes of a 1x1 PNG image
+func pngData(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadedNames lists the files left in the upload folder
+func uploadedNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// problemStatus returns the status of a *Problem error, 0 for other errors
+func problemStatus(err error) int {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem.Status
+	}
+	return 0
+}
+
+func TestUploadIgnoresHostileFilenames(t *testing.T) {
+	g := testGudu(t)
+	dir := filepath.Join(g.RootPath, "uploads")
+	hostile := []string{"../../evil.png", `..\..\evil.png`, "/etc/passwd", "photo.png.php", "<script>.png"}
+
+	files := make([]uploadFile, len(hostile))
+	for i, name := range hostile {
+		files[i] = uploadFile{name: name, content: pngData(t)}
+	}
+	stored, err := g.Upload(uploadRequest(t, "photos", files...), "photos", UploadOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated := regexp.MustCompile(`^[0-9a-f]{32}\.png$`)
+	for i, file := range stored {
+		if !generated.MatchString(file.Name) || filepath.Dir(file.Path) != dir {
+			t.Errorf("%q was stored as %s", hostile[i], file.Path)
+		}
+		if strings.ContainsAny(file.OriginalName, `/\`) {
+			t.Errorf("%q keeps a path in its original name %q", hostile[i], file.OriginalName)
+		}
+	}
+	for _, escaped := range []string{filepath.Join(g.RootPath, "evil.png"), filepath.Join(g.RootPath, "..", "evil.png")} {
+		if _, err := os.Stat(escaped); err == nil {
+			t.Errorf("%s was written outside the upload folder", escaped)
+		}
+	}
+}
+
+func TestUploadSizeLimits(t *testing.T) {
+	g := testGudu(t)
+	dir := filepath.Join(g.RootPath, "uploads")
+	small := uploadFile{name: "a.txt", content: []byte("small")}
+	large := uploadFile{name: "b.txt", content: bytes.Repeat([]byte("x"), 64)}
+
+	// a file above the limit discards the files of the field stored before it
+	_, err := g.Upload(uploadRequest(t, "docs", small, large), "docs", UploadOptions{Dir: dir, MaxFileSize: 32})
+	if problemStatus(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("large file: %v, want a 413 problem", err)
+	}
+	if names := uploadedNames(t, dir); len(names) != 0 {
+		t.Errorf("files were kept after a failed upload: %v", names)
+	}
+
+	_, err = g.Upload(uploadRequest(t, "docs", large), "docs", UploadOptions{Dir: dir, MaxBodySize: 32})
+	if problemStatus(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: %v, want a 413 problem", err)
+	}
+	_, err = g.Upload(uploadRequest(t, "docs", small, small), "docs", UploadOptions{Dir: dir, MaxFiles: 1})
+	if problemStatus(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("too many files: %v, want a 413 problem", err)
+	}
+
+	stored, err := g.Upload(uploadRequest(t, "docs", small), "docs", UploadOptions{Dir: dir, MaxFileSize: 5})
+	if err != nil || len(stored) != 1 || stored[0].Size != 5 {
+		t.Errorf("a file at the limit is stored: %v %v", stored, err)
+	}
+}
+
+func TestUploadSniffsContent(t *testing.T) {
+	g := testGudu(t)
+	dir := filepath.Join(g.RootPath, "uploads")
+	onlyImages := UploadOptions{Dir: dir, AllowedTypes: []string{"image/*"}}
+
+	// the type comes from the content, not from the name or the client
+	html := uploadFile{name: "photo.png", content: []byte("<html><script>alert(1)</script></html>")}
+	if _, err := g.Upload(uploadRequest(t, "photo", html), "photo", onlyImages); problemStatus(err) != http.StatusUnsupportedMediaType {
+		t.Errorf("html named photo.png: %v, want a 415 problem", err)
+	}
+
+	disguised := uploadFile{name: "notes.txt", content: pngData(t)}
+	stored, err := g.Upload(uploadRequest(t, "photo", disguised), "photo", onlyImages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored[0].MimeType != "image/png" || filepath.Ext(stored[0].Name) != ".png" {
+		t.Errorf("png named notes.txt stored as %s %s", stored[0].MimeType, stored[0].Name)
+	}
+}